@@ -15,7 +15,6 @@
 package auth
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -46,20 +45,22 @@ type AzureEnvironment struct {
 	StorageEndpointSuffix                             string `json:"storageEndpointSuffix"`
 }
 
-type AzureManagementCertificate struct {
-	Cert string `json:"cert"`
-	Key  string `json:"key"`
+// AzureServicePrincipal holds the credentials used to authenticate to
+// Azure Resource Manager. It is a mantle extension to the profile format.
+type AzureServicePrincipal struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
 }
 
 type AzureSubscription struct {
-	EnvironmentName       string                     `json:"environmentName"`
-	ID                    string                     `json:"id"`
-	IsDefault             bool                       `json:"isDefault"`
-	ManagementCertificate AzureManagementCertificate `json:"managementCertificate"`
-	ManagementEndpointURL string                     `json:"managementEndpointUrl"`
-	Name                  string                     `json:"name"`
-	RegisteredProviders   []string                   `json:"registeredProviders"`
-	State                 string                     `json:"state"`
+	EnvironmentName     string                `json:"environmentName"`
+	ID                  string                `json:"id"`
+	IsDefault           bool                  `json:"isDefault"`
+	Name                string                `json:"name"`
+	RegisteredProviders []string              `json:"registeredProviders"`
+	State               string                `json:"state"`
+	TenantID            string                `json:"tenantId"`
+	ServicePrincipal    AzureServicePrincipal `json:"servicePrincipal"`
 }
 
 // AzureProfile represents a parsed Azure Profile Configuration File.
@@ -69,21 +70,24 @@ type AzureProfile struct {
 }
 
 // AsOptions converts all subscriptions into a slice of azure.Options.
-// If there is an environment with a name matching the subscription, that environment's storage endpoint will be copied to the options.
+// If there is an environment with a name matching the subscription, that environment's endpoints will be copied to the options.
 func (ap *AzureProfile) AsOptions() []azure.Options {
 	var o []azure.Options
 
 	for _, sub := range ap.Subscriptions {
 		newo := azure.Options{
-			SubscriptionName:      sub.Name,
-			SubscriptionID:        sub.ID,
-			ManagementURL:         sub.ManagementEndpointURL,
-			ManagementCertificate: bytes.Join([][]byte{[]byte(sub.ManagementCertificate.Key), []byte(sub.ManagementCertificate.Cert)}, []byte("\n")),
+			SubscriptionName: sub.Name,
+			SubscriptionID:   sub.ID,
+			TenantID:         sub.TenantID,
+			ClientID:         sub.ServicePrincipal.ClientID,
+			ClientSecret:     sub.ServicePrincipal.ClientSecret,
 		}
 
-		// find the storage endpoint for the subscription
+		// find the endpoints for the subscription
 		for _, e := range ap.Environments {
 			if e.Name == sub.EnvironmentName {
+				newo.ActiveDirectoryURL = e.ActiveDirectoryEndpointURL
+				newo.ResourceManagerURL = e.ResourceManagerEndpointURL
 				newo.StorageEndpointSuffix = e.StorageEndpointSuffix
 				break
 			}
@@ -0,0 +1,173 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/register"
+)
+
+var (
+	cmdBench = &cobra.Command{
+		Use:   "bench [glob pattern]",
+		Short: "Run kola benchmarks",
+		Long: `Run all kola benchmarks (default) or those matching a glob pattern.
+
+Benchmarks run one at a time on fresh machines. The metrics they
+report are written to reports/benchmarks.json in the output directory,
+which can be compared with that of another OS version using bench-diff.
+`,
+		Run:    runBench,
+		PreRun: preRun,
+	}
+
+	cmdBenchDiff = &cobra.Command{
+		Use:   "bench-diff old.json new.json",
+		Short: "Compare the results of two kola benchmark runs",
+		Long: `Compare the metrics in two benchmarks.json files written by kola bench.
+
+With --fail-threshold, exit with an error if any metric got worse by
+more than that fraction, e.g. 0.1 for 10%.
+`,
+		Run: runBenchDiff,
+	}
+
+	benchList          bool
+	benchFailThreshold float64
+)
+
+func init() {
+	cmdBench.Flags().BoolVar(&benchList, "list", false, "List benchmark names instead of running them")
+	root.AddCommand(cmdBench)
+
+	cmdBenchDiff.Flags().Float64Var(&benchFailThreshold, "fail-threshold", 0, "Fail if a metric got worse by more than this fraction")
+	root.AddCommand(cmdBenchDiff)
+}
+
+func runBench(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "Extra arguments specified. Usage: 'kola bench [glob pattern]'\n")
+		os.Exit(2)
+	}
+	pattern := "*"
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+
+	if benchList {
+		listBenchmarks()
+		return
+	}
+
+	var err error
+	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	runErr := kola.RunBenchmarks(pattern, kolaPlatform, outputDir)
+
+	// needs to be after RunBenchmarks() because harness empties the directory
+	if err := writeProps(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", runErr)
+		os.Exit(1)
+	}
+}
+
+func listBenchmarks() {
+	var benchmarks []*register.Benchmark
+	for _, b := range register.Benchmarks {
+		benchmarks = append(benchmarks, b)
+	}
+	sort.Slice(benchmarks, func(i, j int) bool {
+		return benchmarks[i].Name < benchmarks[j].Name
+	})
+
+	var w = tabwriter.NewWriter(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "Benchmark Name\tPlatforms\tArchitectures")
+	fmt.Fprintln(w, "\t")
+	for _, b := range benchmarks {
+		fmt.Fprintf(w, "%v\n", item{
+			b.Name,
+			b.Platforms,
+			b.ExcludePlatforms,
+			b.Architectures})
+	}
+	w.Flush()
+}
+
+func runBenchDiff(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: 'kola bench-diff old.json new.json'\n")
+		os.Exit(2)
+	}
+
+	old, err := reporters.ReadBenchmarkReport(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	new, err := reporters.ReadBenchmarkReport(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if old.Platform != new.Platform {
+		plog.Warningf("Comparing results from different platforms: %s and %s", old.Platform, new.Platform)
+	}
+
+	var worse int
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "Benchmark\tMetric\t%s\t%s\tChange\t\n", old.Version, new.Version)
+	for _, c := range reporters.DiffBenchmarks(old, new) {
+		var verdict string
+		if c.New.Value != c.Old.Value {
+			if c.Improved() {
+				verdict = "better"
+			} else {
+				verdict = "worse"
+				if benchFailThreshold > 0 && math.Abs(c.Change()) > benchFailThreshold {
+					verdict = "WORSE"
+					worse++
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.4g %s\t%.4g %s\t%+.1f%%\t%s\n",
+			c.Benchmark, c.New.Name,
+			c.Old.Value, c.Old.Unit, c.New.Value, c.New.Unit,
+			100*c.Change(), verdict)
+	}
+	w.Flush()
+
+	if worse > 0 {
+		fmt.Fprintf(os.Stderr, "%d metrics got worse by more than %.0f%%\n", worse, 100*benchFailThreshold)
+		os.Exit(1)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/bootperf"
 	"github.com/coreos/mantle/platform"
 )
 
@@ -36,11 +37,31 @@ Note that this actually uses systemd-analyze plot rather than
 systemd-bootchart since the latter requires setting a different
 init process.
 
+With --boots, boot that many instances one after another instead and
+record how long each boot phase and unit took, from systemd-analyze
+time, blame and critical-chain. The results are written as JSON to
+--output. With --baseline, they are compared against earlier results
+for the same platform, and kola fails if the boot or any unit got
+slower than the thresholds allow.
+
 This must run as root!
 `}
 
+var (
+	bootchartBoots      int
+	bootchartOutput     string
+	bootchartBaseline   string
+	bootchartThresholds = bootperf.DefaultThresholds
+)
+
 func init() {
 	root.AddCommand(cmdBootchart)
+	cmdBootchart.Flags().IntVar(&bootchartBoots, "boots", 0, "Number of instances to boot to measure boot performance")
+	cmdBootchart.Flags().StringVar(&bootchartOutput, "output", "bootperf.json", "File to write boot performance results to")
+	cmdBootchart.Flags().StringVar(&bootchartBaseline, "baseline", "", "Boot performance results to compare against")
+	cmdBootchart.Flags().Float64Var(&bootchartThresholds.Relative, "threshold-relative", bootchartThresholds.Relative, "Allowed slowdown as a fraction of the baseline")
+	cmdBootchart.Flags().Float64Var(&bootchartThresholds.Absolute, "threshold-absolute", bootchartThresholds.Absolute, "Allowed slowdown in seconds")
+	cmdBootchart.Flags().Float64Var(&bootchartThresholds.Sigmas, "threshold-sigmas", bootchartThresholds.Sigmas, "Allowed slowdown in standard errors")
 }
 
 func runBootchart(cmd *cobra.Command, args []string) {
@@ -48,6 +69,13 @@ func runBootchart(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "No args accepted\n")
 		os.Exit(2)
 	}
+	if bootchartBoots > 0 {
+		if err := runBootPerf(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	var err error
 	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
@@ -80,3 +108,71 @@ func runBootchart(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("%s", out)
 }
+
+// runBootPerf boots bootchartBoots machines one at a time, so they don't
+// compete for the host, and records and checks their boot timings.
+func runBootPerf() error {
+	var baseline *bootperf.Results
+	if bootchartBaseline != "" {
+		var err error
+		if baseline, err = bootperf.ReadFile(bootchartBaseline); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
+	if err != nil {
+		return fmt.Errorf("Setup failed: %v", err)
+	}
+
+	cluster, err := kola.NewCluster(kolaPlatform, &platform.RuntimeConfig{
+		OutputDir: outputDir,
+	})
+	if err != nil {
+		return fmt.Errorf("Cluster failed: %v", err)
+	}
+	defer cluster.Destroy()
+
+	results := bootperf.Results{Platform: kolaPlatform}
+	for i := 0; i < bootchartBoots; i++ {
+		m, err := cluster.NewMachine(nil)
+		if err != nil {
+			return fmt.Errorf("Machine failed: %v", err)
+		}
+		boot, err := bootperf.Collect(m)
+		if err == nil && results.Version == "" {
+			out, _, _ := m.SSH(". /etc/os-release && echo $VERSION")
+			results.Version = string(out)
+		}
+		m.Destroy()
+		if err != nil {
+			return fmt.Errorf("%s: %v", m.ID(), err)
+		}
+		plog.Infof("Boot %d/%d took %.3fs", i+1, bootchartBoots, boot.Total)
+		results.Boots = append(results.Boots, *boot)
+	}
+
+	results.Summarize()
+	total := results.Phases["total"]
+	fmt.Printf("Booted %d instances in %.3fs ± %.3fs (min %.3fs, max %.3fs)\n",
+		total.N, total.Mean, total.StdDev, total.Min, total.Max)
+	if err := results.WriteFile(bootchartOutput); err != nil {
+		return err
+	}
+
+	if baseline == nil {
+		return nil
+	}
+	regressions, err := bootperf.Compare(baseline, &results, bootchartThresholds)
+	if err != nil {
+		return err
+	}
+	for _, r := range regressions {
+		fmt.Printf("Regression: %s\n", r)
+	}
+	if len(regressions) > 0 {
+		return fmt.Errorf("boot performance regressed from %s", bootchartBaseline)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/platform"
+)
+
+var (
+	cmdJournalDump = &cobra.Command{
+		Run:   runJournalDump,
+		Use:   "journal-dump [options] journal-raw.txt.gz",
+		Short: "Convert a recorded journal to another format",
+		Long: `
+Convert a journal recorded by kola, in journalctl's export format, to
+another format. The input may be gzipped, as journal-raw.txt.gz is.
+
+The units format writes one file per systemd unit to the directory given
+with --output.
+`}
+
+	journalDumpFormat string
+	journalDumpOutput string
+	journalDumpUTC    bool
+)
+
+func init() {
+	cmdJournalDump.Flags().StringVarP(&journalDumpFormat, "format", "f", journal.FormatShort, "output format: "+strings.Join(append([]string{journal.FormatShort}, platform.JournalFormats...), ", "))
+	cmdJournalDump.Flags().StringVarP(&journalDumpOutput, "output", "o", "", "output file, or directory for the units format (default stdout)")
+	cmdJournalDump.Flags().BoolVar(&journalDumpUTC, "utc", false, "show times in UTC")
+	root.AddCommand(cmdJournalDump)
+}
+
+func runJournalDump(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expected a single journal file\n")
+		os.Exit(2)
+	}
+
+	if err := journalDump(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func journalDump(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if strings.HasSuffix(path, ".gz") {
+		z, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("reading %v: %v", path, err)
+		}
+		r = z
+	}
+
+	var f journal.Formatter
+	var out io.Closer = os.Stdout
+	if journalDumpFormat == platform.JournalUnits {
+		if journalDumpOutput == "" {
+			return fmt.Errorf("the %v format needs an output directory", platform.JournalUnits)
+		}
+		uw := journal.NewUnitWriter(journalDumpOutput, journal.ShortWriter)
+		f, out = uw, uw
+	} else {
+		w := os.Stdout
+		if journalDumpOutput != "" {
+			w, err = os.Create(journalDumpOutput)
+			if err != nil {
+				return err
+			}
+		}
+		out = w
+		f, err = journal.NewFormatter(journalDumpFormat, w)
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if journalDumpUTC {
+		f.SetTimezone(time.UTC)
+	}
+
+	src := journal.NewExportReader(r)
+	for {
+		entry, err := src.ReadEntry()
+		// journals of machines that were still running end abruptly
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			out.Close()
+			return fmt.Errorf("reading %v: %v", path, err)
+		}
+		if err := f.WriteEntry(entry); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
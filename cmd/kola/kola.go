@@ -22,11 +22,13 @@ import (
 	"sort"
 	"text/tabwriter"
 
+	"github.com/coreos/go-semver/semver"
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
 	"github.com/coreos/mantle/cli"
 	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/external"
 	"github.com/coreos/mantle/kola/register"
 
 	// register OS test suite
@@ -60,10 +62,14 @@ will be ignored.
 		Short: "List kola test names",
 		Run:   runList,
 	}
+
+	listJSON bool
 )
 
 func init() {
 	root.AddCommand(cmdRun)
+
+	cmdList.Flags().BoolVar(&listJSON, "json", false, "Output all test metadata as JSON")
 	root.AddCommand(cmdList)
 }
 
@@ -87,7 +93,29 @@ func preRun(cmd *cobra.Command, args []string) {
 	}
 }
 
+// setupTests registers the tests in the directories given with --external
+// and parses --tags.
+func setupTests() {
+	for _, dir := range externalTests {
+		if err := external.Register(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(3)
+		}
+	}
+
+	if tagExpr != "" {
+		tags, err := register.ParseTagExpr(tagExpr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(3)
+		}
+		kola.Tags = tags
+	}
+}
+
 func runRun(cmd *cobra.Command, args []string) {
+	setupTests()
+
 	if len(args) > 1 {
 		fmt.Fprintf(os.Stderr, "Extra arguments specified. Usage: 'kola run [glob pattern]'\n")
 		os.Exit(2)
@@ -135,6 +163,11 @@ func writeProps() error {
 		AMI          string `json:"ami"`
 		InstanceType string `json:"type"`
 	}
+	type Azure struct {
+		Location string `json:"location"`
+		Image    string `json:"image"`
+		Size     string `json:"size"`
+	}
 	type DO struct {
 		Region string `json:"region"`
 		Size   string `json:"size"`
@@ -162,6 +195,7 @@ func writeProps() error {
 		Platform string   `json:"platform"`
 		Board    string   `json:"board"`
 		AWS      AWS      `json:"aws"`
+		Azure    Azure    `json:"azure"`
 		DO       DO       `json:"do"`
 		ESX      ESX      `json:"esx"`
 		GCE      GCE      `json:"gce"`
@@ -176,6 +210,11 @@ func writeProps() error {
 			AMI:          kola.AWSOptions.AMI,
 			InstanceType: kola.AWSOptions.InstanceType,
 		},
+		Azure: Azure{
+			Location: kola.AzureOptions.Location,
+			Image:    kola.AzureOptions.Image,
+			Size:     kola.AzureOptions.Size,
+		},
 		DO: DO{
 			Region: kola.DOOptions.Region,
 			Size:   kola.DOOptions.Size,
@@ -202,29 +241,106 @@ func writeProps() error {
 }
 
 func runList(cmd *cobra.Command, args []string) {
-	var w = tabwriter.NewWriter(os.Stdout, 0, 8, 0, '\t', 0)
-	var testlist []item
+	setupTests()
 
-	for name, test := range register.Tests {
-		testlist = append(testlist, item{
-			name,
-			test.Platforms,
-			test.ExcludePlatforms,
-			test.Architectures})
+	var tests []*register.Test
+	for _, test := range register.Tests {
+		if test.MatchTags(kola.Tags) {
+			tests = append(tests, test)
+		}
 	}
-
-	sort.Slice(testlist, func(i, j int) bool {
-		return testlist[i].Name < testlist[j].Name
+	sort.Slice(tests, func(i, j int) bool {
+		return tests[i].Name < tests[j].Name
 	})
 
+	if listJSON {
+		if err := writeTestsJSON(tests); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var w = tabwriter.NewWriter(os.Stdout, 0, 8, 0, '\t', 0)
 	fmt.Fprintln(w, "Test Name\tPlatforms\tArchitectures")
 	fmt.Fprintln(w, "\t")
-	for _, item := range testlist {
-		fmt.Fprintf(w, "%v\n", item)
+	for _, test := range tests {
+		fmt.Fprintf(w, "%v\n", item{
+			test.Name,
+			test.Platforms,
+			test.ExcludePlatforms,
+			test.Architectures})
 	}
 	w.Flush()
 }
 
+func writeTestsJSON(tests []*register.Test) error {
+	type jsonTest struct {
+		Name             string   `json:"name"`
+		Description      string   `json:"description,omitempty"`
+		Owner            string   `json:"owner,omitempty"`
+		Tags             []string `json:"tags"`
+		Platforms        []string `json:"platforms"`
+		ExcludePlatforms []string `json:"exclude_platforms"`
+		Architectures    []string `json:"architectures"`
+		ClusterSize      int      `json:"cluster_size"`
+		MinVersion       string   `json:"min_version,omitempty"`
+		EndVersion       string   `json:"end_version,omitempty"`
+		Flags            []string `json:"flags"`
+		Timeout          string   `json:"timeout,omitempty"`
+		NativeFuncs      []string `json:"native_funcs"`
+	}
+
+	var out []jsonTest
+	for _, test := range tests {
+		t := jsonTest{
+			Name:             test.Name,
+			Description:      test.Description,
+			Owner:            test.Owner,
+			Tags:             nonNil(test.Tags),
+			Platforms:        nonNil(test.Platforms),
+			ExcludePlatforms: nonNil(test.ExcludePlatforms),
+			Architectures:    nonNil(test.Architectures),
+			ClusterSize:      test.ClusterSize,
+			Flags:            []string{},
+			NativeFuncs:      []string{},
+		}
+		if (test.MinVersion != semver.Version{}) {
+			t.MinVersion = test.MinVersion.String()
+		}
+		if (test.EndVersion != semver.Version{}) {
+			t.EndVersion = test.EndVersion.String()
+		}
+		for _, flag := range test.Flags {
+			t.Flags = append(t.Flags, flag.String())
+		}
+		if test.Timeout != 0 {
+			t.Timeout = test.Timeout.String()
+		}
+		for name := range test.NativeFuncs {
+			t.NativeFuncs = append(t.NativeFuncs, name)
+		}
+		for name := range test.NativeTests {
+			t.NativeFuncs = append(t.NativeFuncs, name)
+		}
+		sort.Strings(t.NativeFuncs)
+		out = append(out, t)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "    ")
+	return enc.Encode(out)
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that it encodes as
+// [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
 type item struct {
 	Name             string
 	Platforms        []string
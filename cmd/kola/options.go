@@ -21,6 +21,8 @@ import (
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network"
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/sdk"
 )
@@ -28,8 +30,11 @@ import (
 var (
 	outputDir          string
 	kolaPlatform       string
+	externalTests      []string
+	tagExpr            string
+	sshKeyTypes        []string
 	defaultTargetBoard = sdk.DefaultBoard()
-	kolaPlatforms      = []string{"aws", "do", "esx", "gce", "packet", "qemu"}
+	kolaPlatforms      = []string{"aws", "azure", "do", "esx", "gce", "packet", "qemu"}
 	kolaDefaultImages  = map[string]string{
 		"amd64-usr": sdk.BuildRoot() + "/images/amd64-usr/latest/coreos_production_image.bin",
 		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/coreos_production_image.bin",
@@ -52,9 +57,19 @@ func init() {
 	root.PersistentFlags().StringVarP(&kolaPlatform, "platform", "p", "qemu", "VM platform: "+strings.Join(kolaPlatforms, ", "))
 	root.PersistentFlags().IntVarP(&kola.TestParallelism, "parallel", "j", 1, "number of tests to run in parallel")
 	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
+	bv(&kola.ShareClusters, "share-clusters", false, "Let non-destructive tests with the same configuration reuse machines")
+	root.PersistentFlags().IntVar(&kola.PoolSize, "pool-size", 0, "Number of machines with default userdata to keep booted for tests")
+	root.PersistentFlags().IntVar(&kola.MaxInstances, "max-instances", 0, "Maximum number of machines to run at once (0 means unlimited)")
+	root.PersistentFlags().DurationVar(&kola.DefaultTimeout, "default-timeout", register.DefaultTimeout, "timeout for tests that don't set their own (0 means unlimited)")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
 	ss("debug-systemd-unit", []string{}, "full-unit-name.service to enable SYSTEMD_LOG_LEVEL=debug on. Specify multiple times for multiple units.")
 	sv(&kola.UpdatePayloadFile, "update-payload", "", "Path to an update payload that should be made available to tests")
+	sv(&tagExpr, "tags", "", "Only select tests whose tags match this expression, e.g. 'smoke && !slow'")
+	root.PersistentFlags().StringSliceVar(&kola.JournalFormats, "journal-format", nil, "Also record machine journals in these formats: "+strings.Join(platform.JournalFormats, ", "))
+	bv(&kola.NoArtifacts, "no-artifacts", false, "Don't collect logs and state from the machines of failed tests, except timeout diagnostics")
+	root.PersistentFlags().StringSliceVar(&sshKeyTypes, "ssh-key-type", nil, "Types of the SSH keys kola authenticates with: rsa, ecdsa, ed25519")
+	bv(&kola.Options.SSHAgent.ImportAgent, "ssh-import-agent", false, "Also authorize the keys of the agent in SSH_AUTH_SOCK")
+	root.PersistentFlags().StringSliceVarP(&externalTests, "external", "E", nil, "Directory of external tests to load; may be specified multiple times")
 
 	// aws-specific options
 	defaultRegion := os.Getenv("AWS_REGION")
@@ -69,6 +84,14 @@ func init() {
 	sv(&kola.AWSOptions.SecurityGroup, "aws-sg", "kola", "AWS security group name")
 	sv(&kola.AWSOptions.IAMInstanceProfile, "aws-iam-profile", "kola", "AWS IAM instance profile name")
 
+	// azure-specific options
+	sv(&kola.AzureOptions.ConfigPath, "azure-profile", "", "Azure profile file (default \"~/"+auth.AzureProfilePath+"\")")
+	sv(&kola.AzureOptions.SubscriptionName, "azure-subscription", "", "Azure subscription name (default the first in the profile)")
+	sv(&kola.AzureOptions.ResourceGroup, "azure-resource-group", "kola", "Azure resource group holding the image")
+	sv(&kola.AzureOptions.Image, "azure-image", "", "Azure managed image name in --azure-resource-group, or full image resource ID")
+	sv(&kola.AzureOptions.Location, "azure-location", "westus", "Azure location")
+	sv(&kola.AzureOptions.Size, "azure-size", "Standard_D2_v2", "Azure VM size")
+
 	// do-specific options
 	sv(&kola.DOOptions.ConfigPath, "do-config-file", "", "DigitalOcean config file (default \"~/"+auth.DOConfigPath+"\")")
 	sv(&kola.DOOptions.Profile, "do-profile", "", "DigitalOcean profile (default \"default\")")
@@ -138,6 +161,33 @@ func syncOptions() error {
 	if kola.QEMUOptions.BIOSImage == "" {
 		kola.QEMUOptions.BIOSImage = kolaDefaultBIOS[kola.QEMUOptions.Board]
 	}
+	for _, format := range kola.JournalFormats {
+		ok := false
+		for _, f := range platform.JournalFormats {
+			if f == format {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unsupported journal format %q", format)
+		}
+	}
+
+	for _, name := range sshKeyTypes {
+		ok := false
+		for _, keyType := range network.KeyTypes {
+			if string(keyType) == name {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unsupported SSH key type %q", name)
+		}
+		kola.Options.SSHAgent.KeyTypes = append(kola.Options.SSHAgent.KeyTypes, network.KeyType(name))
+	}
+
 	units, _ := root.PersistentFlags().GetStringSlice("debug-systemd-units")
 	for _, unit := range units {
 		kola.Options.SystemdDropins = append(kola.Options.SystemdDropins, platform.SystemdDropin{
@@ -121,6 +121,7 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 	cluster, err := kola.NewCluster(kolaPlatform, &platform.RuntimeConfig{
 		OutputDir:        outputDir,
 		AllowFailedUnits: true,
+		JournalFormats:   kola.JournalFormats,
 	})
 	if err != nil {
 		return fmt.Errorf("Cluster failed: %v", err)
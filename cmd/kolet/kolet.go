@@ -15,12 +15,18 @@
 package main
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
 	"github.com/coreos/mantle/cli"
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/kola/native"
 	"github.com/coreos/mantle/kola/register"
 
 	// Register any tests that we may wish to execute in kolet.
@@ -41,6 +47,8 @@ var (
 		Short: "Run a given test's native function",
 		Run:   run,
 	}
+
+	timeout time.Duration
 )
 
 func run(cmd *cobra.Command, args []string) {
@@ -48,33 +56,76 @@ func run(cmd *cobra.Command, args []string) {
 	os.Exit(2)
 }
 
+// runFunc runs a plain NativeFunc, reporting its error as a failure.
+func runFunc(name string, f func() error) {
+	enc := native.NewEncoder(os.Stdout)
+	enc.Run(name)
+	start := time.Now()
+	if err := f(); err != nil {
+		enc.Output(name, err.Error())
+		enc.Done(name, native.ActionFail, time.Since(start))
+		os.Exit(1)
+	}
+	enc.Done(name, native.ActionPass, time.Since(start))
+	// Explicitly exit successfully.
+	os.Exit(0)
+}
+
+// runTest runs a NativeTest in a harness suite of its own.
+func runTest(name string, test harness.Test) {
+	enc := native.NewEncoder(os.Stdout)
+	// The harness and the test itself may print to stdout; keep that
+	// out of the event stream.
+	os.Stdout = os.Stderr
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	suite := harness.NewSuite(harness.Options{
+		OutputDir: filepath.Join(os.TempDir(), "_kolet_temp"),
+		Parallel:  1,
+		Context:   ctx,
+		Reporters: reporters.Reporters{native.NewReporter(enc)},
+	}, harness.Tests{name: test})
+	if err := suite.Run(); err != nil {
+		plog.Error(err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func main() {
+	cmdRun.PersistentFlags().DurationVar(&timeout, "timeout", 0, "deadline for native tests (0 means unlimited)")
+
 	for testName, testObj := range register.Tests {
-		if len(testObj.NativeFuncs) == 0 {
+		if len(testObj.NativeFuncs) == 0 && len(testObj.NativeTests) == 0 {
 			continue
 		}
 		testCmd := &cobra.Command{
 			Use: testName + " [func]",
 			Run: run,
 		}
-		for nativeName := range testObj.NativeFuncs {
-			nativeFunc := testObj.NativeFuncs[nativeName]
-			nativeRun := func(cmd *cobra.Command, args []string) {
-				if len(args) != 0 {
-					cmd.Usage()
-					os.Exit(2)
-				}
-				if err := nativeFunc(); err != nil {
-					plog.Fatal(err)
-				}
-				// Explicitly exit successfully.
-				os.Exit(0)
-			}
-			nativeCmd := &cobra.Command{
+		for nativeName, nativeFunc := range testObj.NativeFuncs {
+			nativeName, nativeFunc := nativeName, nativeFunc
+			testCmd.AddCommand(&cobra.Command{
+				Use: nativeName,
+				Run: func(cmd *cobra.Command, args []string) {
+					runFunc(nativeName, nativeFunc)
+				},
+			})
+		}
+		for nativeName, nativeTest := range testObj.NativeTests {
+			nativeName, nativeTest := nativeName, nativeTest
+			testCmd.AddCommand(&cobra.Command{
 				Use: nativeName,
-				Run: nativeRun,
-			}
-			testCmd.AddCommand(nativeCmd)
+				Run: func(cmd *cobra.Command, args []string) {
+					runTest(nativeName, nativeTest)
+				},
+			})
 		}
 		cmdRun.AddCommand(testCmd)
 	}
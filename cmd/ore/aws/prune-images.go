@@ -0,0 +1,88 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cmd/ore/prune"
+)
+
+var (
+	cmdPruneImages = &cobra.Command{
+		Use:   "prune-images",
+		Short: "Delete old AMIs and their snapshots",
+		Long: `Delete old AMIs and their snapshots in the selected region.
+
+Only AMIs carrying the Channel tag applied by plume are considered. HVM
+and PV AMIs are retained separately.`,
+		RunE: runPruneImages,
+	}
+)
+
+func init() {
+	AWS.AddCommand(cmdPruneImages)
+	prune.AddFlags(cmdPruneImages.Flags())
+}
+
+func runPruneImages(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in aws prune-images cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	amis, err := API.ListImages(map[string]string{"Channel": ""})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't list images: %v\n", err)
+		os.Exit(1)
+	}
+
+	var images []prune.Image
+	for _, ami := range amis {
+		image := prune.Image{
+			ID:   *ami.ImageId,
+			Name: *ami.Name,
+		}
+		if ami.VirtualizationType != nil {
+			image.Type = *ami.VirtualizationType
+		}
+		for _, tag := range ami.Tags {
+			if *tag.Key == "Channel" {
+				image.Channel = *tag.Value
+			}
+		}
+		if ami.CreationDate != nil {
+			image.Created, err = time.Parse(time.RFC3339, *ami.CreationDate)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't parse creation date of %v: %v\n", image.ID, err)
+				os.Exit(1)
+			}
+		}
+		images = append(images, image)
+	}
+
+	err = prune.Run(images, func(image prune.Image) error {
+		return API.DeleteImage(image.ID)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
@@ -31,8 +31,10 @@ var (
 		Short: "azure image and vm utilities",
 	}
 
-	azureProfile      string
-	azureSubscription string
+	azureProfile       string
+	azureSubscription  string
+	azureResourceGroup string
+	azureLocation      string
 
 	api *azure.API
 )
@@ -43,6 +45,8 @@ func init() {
 	sv := Azure.PersistentFlags().StringVar
 	sv(&azureProfile, "azure-profile", "", "Azure Profile json file")
 	sv(&azureSubscription, "azure-subscription", "", "Azure subscription name. If unset, the first is used.")
+	sv(&azureResourceGroup, "azure-resource-group", "coreos", "Azure resource group")
+	sv(&azureLocation, "azure-location", "westus", "Azure location of created resources")
 }
 
 func preauth(cmd *cobra.Command, args []string) error {
@@ -57,6 +61,8 @@ func preauth(cmd *cobra.Command, args []string) error {
 	if opt == nil {
 		plog.Fatalf("Azure subscription named %q doesn't exist in %q", azureSubscription, azureProfile)
 	}
+	opt.ResourceGroup = azureResourceGroup
+	opt.Location = azureLocation
 
 	a, err := azure.New(opt)
 	if err != nil {
@@ -15,23 +15,34 @@
 package azure
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
-
-	"github.com/coreos/mantle/platform/api/azure"
 )
 
 var (
 	cmdCreateImage = &cobra.Command{
 		Use:   "create-image",
 		Short: "Create Azure image",
-		Long:  "Create Azure image from a local VHD file",
+		Long:  "Create Azure managed image from an uploaded VHD blob",
 		RunE:  runCreateImage,
 	}
 
 	// create image options
-	md azure.OSImage
+	cio struct {
+		name              string
+		label             string
+		description       string
+		blob              string
+		family            string
+		publishedDate     string
+		recommendedVMSize string
+		iconURI           string
+		smallIconURI      string
+		tags              []string
+	}
 )
 
 func today() string {
@@ -41,21 +52,57 @@ func today() string {
 func init() {
 	sv := cmdCreateImage.Flags().StringVar
 
-	sv(&md.Name, "name", "", "image name")
-	sv(&md.Label, "label", "", "image label")
-	sv(&md.Description, "description", "", "image description")
-	sv(&md.MediaLink, "blob", "", "source blob url")
-	sv(&md.ImageFamily, "family", "", "image family")
-	sv(&md.PublishedDate, "published-date", today(), "image published date, parsed as RFC3339")
-	sv(&md.RecommendedVMSize, "recommended-vm-size", "Medium", "recommended VM size")
-	sv(&md.IconURI, "icon-uri", "coreos-globe-color-lg-100px.png", "icon URI")
-	sv(&md.SmallIconURI, "small-icon-uri", "coreos-globe-color-lg-45px.png", "small icon URI")
+	sv(&cio.name, "name", "", "image name")
+	sv(&cio.label, "label", "", "image label")
+	sv(&cio.description, "description", "", "image description")
+	sv(&cio.blob, "blob", "", "source blob url")
+	sv(&cio.family, "family", "", "image family")
+	sv(&cio.publishedDate, "published-date", today(), "image published date, parsed as RFC3339")
+	sv(&cio.recommendedVMSize, "recommended-vm-size", "Medium", "recommended VM size")
+	sv(&cio.iconURI, "icon-uri", "coreos-globe-color-lg-100px.png", "icon URI")
+	sv(&cio.smallIconURI, "small-icon-uri", "coreos-globe-color-lg-45px.png", "small icon URI")
+	cmdCreateImage.Flags().StringSliceVar(&cio.tags, "tag", nil, "image tag as key=value")
+
+	// managed images have no icons
+	cmdCreateImage.Flags().MarkDeprecated("icon-uri", "it is ignored")
+	cmdCreateImage.Flags().MarkDeprecated("small-icon-uri", "it is ignored")
 
 	Azure.AddCommand(cmdCreateImage)
 }
 
 func runCreateImage(cmd *cobra.Command, args []string) error {
-	md.Category = "Public"
-	md.OS = "Linux"
-	return api.AddOSImage(&md)
+	if cio.name == "" {
+		return fmt.Errorf("image name is required")
+	}
+	if cio.blob == "" {
+		return fmt.Errorf("source blob is required")
+	}
+
+	// the metadata of classic OS images is kept as tags
+	tags := map[string]string{}
+	for key, value := range map[string]string{
+		"label":               cio.label,
+		"description":         cio.description,
+		"family":              cio.family,
+		"published-date":      cio.publishedDate,
+		"recommended-vm-size": cio.recommendedVMSize,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	for _, tag := range cio.tags {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("tag %q is not key=value", tag)
+		}
+		tags[kv[0]] = kv[1]
+	}
+
+	image, err := api.CreateImage(cio.name, cio.blob, tags)
+	if err != nil {
+		return err
+	}
+	plog.Printf("Created image %q", image.ID)
+	return nil
 }
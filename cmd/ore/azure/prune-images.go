@@ -0,0 +1,73 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cmd/ore/prune"
+)
+
+var (
+	cmdPruneImages = &cobra.Command{
+		Use:   "prune-images",
+		Short: "Delete old Azure OS images",
+		Long: `Delete old Azure managed images.
+
+Only images carrying the Channel tag applied by plume are considered.`,
+		RunE: runPruneImages,
+	}
+
+	pruneImagePrefix string
+)
+
+func init() {
+	cmdPruneImages.Flags().StringVar(&pruneImagePrefix, "prefix", "CoreOS-", "only consider images with this name prefix")
+	prune.AddFlags(cmdPruneImages.Flags())
+
+	Azure.AddCommand(cmdPruneImages)
+}
+
+func runPruneImages(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("expecting 0 arguments, got %d", len(args))
+	}
+
+	azImages, err := api.ListImages()
+	if err != nil {
+		return fmt.Errorf("couldn't list images: %v", err)
+	}
+
+	var images []prune.Image
+	for _, azImage := range azImages {
+		channel, ok := azImage.Tags["Channel"]
+		if !ok || !strings.HasPrefix(azImage.Name, pruneImagePrefix) {
+			continue
+		}
+		images = append(images, prune.Image{
+			ID:      azImage.Name,
+			Name:    azImage.Name,
+			Channel: channel,
+			Created: azImage.Created(),
+		})
+	}
+
+	return prune.Run(images, func(image prune.Image) error {
+		return api.DeleteImage(image.Name)
+	})
+}
@@ -24,7 +24,7 @@ import (
 var (
 	cmdReplicateImage = &cobra.Command{
 		Use:   "replicate-image image",
-		Short: "Replicate an OS image in Azure",
+		Short: "Replicate a managed image in Azure",
 		RunE:  runReplicateImage,
 	}
 
@@ -24,7 +24,12 @@ var (
 	cmdShareImage = &cobra.Command{
 		Use:   "share-image image-name",
 		Short: "Set permissions on an azure OS image",
-		RunE:  runShareImage,
+		Long: `Set permissions on an azure OS image.
+
+Images are shared through the gallery of their offer, so the permission
+applies to every image of the offer. The image may be given as
+OFFER-SKU-VERSION, as replicated by plume, or as just the offer.`,
+		RunE: runShareImage,
 	}
 
 	sharePermission string
@@ -46,6 +51,14 @@ func runShareImage(cmd *cobra.Command, args []string) error {
 	if sharePermission == "" {
 		return fmt.Errorf("permission is required")
 	}
+	if sharePermission == "msdn" {
+		return fmt.Errorf("gallery images can't be shared with MSDN subscriptions only")
+	}
+
+	offer, _, _, err := parseImageName(args[0])
+	if err != nil {
+		offer = args[0]
+	}
 
-	return api.ShareImage(args[0], sharePermission)
+	return api.ShareImage(offer, sharePermission)
 }
@@ -16,6 +16,7 @@ package azure
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -24,7 +25,11 @@ var (
 	cmdUnreplicateImage = &cobra.Command{
 		Use:   "unreplicate-image image",
 		Short: "Unreplicate an OS image in Azure",
-		RunE:  runUnreplicateImage,
+		Long: `Unreplicate an OS image in Azure.
+
+The image is named OFFER-SKU-VERSION, as replicated by plume, e.g.
+CoreOS-Alpha-1688.0.0.`,
+		RunE: runUnreplicateImage,
 	}
 )
 
@@ -32,10 +37,25 @@ func init() {
 	Azure.AddCommand(cmdUnreplicateImage)
 }
 
+// parseImageName splits the name of a replicated image into the offer,
+// SKU and version it is published as.
+func parseImageName(name string) (offer, sku, version string, err error) {
+	parts := strings.SplitN(name, "-", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("image name %q is not OFFER-SKU-VERSION", name)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
 func runUnreplicateImage(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("expecting 1 argument")
 	}
 
-	return api.UnreplicateImage(args[0])
+	offer, sku, version, err := parseImageName(args[0])
+	if err != nil {
+		return err
+	}
+
+	return api.UnreplicateImage(offer, sku, version)
 }
@@ -0,0 +1,89 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/cmd/ore/prune"
+)
+
+var (
+	cmdPruneImages = &cobra.Command{
+		Use:   "prune-images",
+		Short: "Delete old GCE images",
+		Long: `Delete old GCE images.
+
+Images are grouped into channels by image family; images without a
+family are ignored.`,
+		Run: runPruneImages,
+	}
+
+	pruneImagePrefix string
+)
+
+func init() {
+	GCloud.AddCommand(cmdPruneImages)
+	cmdPruneImages.Flags().StringVar(&pruneImagePrefix, "prefix", "coreos-", "only consider images with this name prefix")
+	prune.AddFlags(cmdPruneImages.Flags())
+}
+
+func runPruneImages(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in gcloud prune-images cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	gceImages, err := api.ListImages(context.Background(), pruneImagePrefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	var images []prune.Image
+	for _, gceImage := range gceImages {
+		if gceImage.Family == "" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, gceImage.CreationTimestamp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't parse timestamp %q: %v\n", gceImage.CreationTimestamp, err)
+			os.Exit(1)
+		}
+		images = append(images, prune.Image{
+			ID:      gceImage.Name,
+			Name:    gceImage.Name,
+			Channel: gceImage.Family,
+			Created: created,
+		})
+	}
+
+	err = prune.Run(images, func(image prune.Image) error {
+		pending, err := api.DeleteImage(image.Name)
+		if err != nil {
+			return err
+		}
+		return pending.Wait()
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
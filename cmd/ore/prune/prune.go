@@ -0,0 +1,231 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prune implements the image retention policy shared by the
+// prune-images commands of each ore cloud.
+package prune
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/pflag"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "ore/prune")
+
+	keepLast         int
+	keepNewerThan    time.Duration
+	protect          []string
+	protectManifests []string
+	unprotected      bool
+	dryRun           bool
+)
+
+// Image is a cloud image considered for pruning.
+type Image struct {
+	ID      string // passed back to the cloud to delete the image
+	Name    string
+	Channel string
+	Type    string // images of different types are retained separately
+	Created time.Time
+}
+
+// Policy decides which images to keep. An image is kept if any rule
+// applies to it.
+type Policy struct {
+	KeepLast      int             // newest images to keep per channel and type
+	KeepNewerThan time.Duration   // keep images younger than this
+	Protected     map[string]bool // image names or IDs never to delete
+}
+
+// Action is the fate of a single image under a Policy.
+type Action struct {
+	Image  Image
+	Delete bool
+	Reason string
+}
+
+// Plan applies the policy to images. Actions are grouped by channel and
+// type, newest first.
+func (p *Policy) Plan(images []Image, now time.Time) []Action {
+	sorted := make([]Image, len(images))
+	copy(sorted, images)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Channel != sorted[j].Channel {
+			return sorted[i].Channel < sorted[j].Channel
+		}
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	type group struct{ channel, typ string }
+	var actions []Action
+	seen := map[group]int{}
+	for _, image := range sorted {
+		action := Action{Image: image}
+		g := group{image.Channel, image.Type}
+		seen[g]++
+		switch {
+		case p.Protected[image.ID] || p.Protected[image.Name]:
+			action.Reason = "referenced by a release"
+		case seen[g] <= p.KeepLast && image.Type != "":
+			action.Reason = fmt.Sprintf("newest %d %v in channel", p.KeepLast, image.Type)
+		case seen[g] <= p.KeepLast:
+			action.Reason = fmt.Sprintf("newest %d in channel", p.KeepLast)
+		case p.KeepNewerThan > 0 && now.Sub(image.Created) < p.KeepNewerThan:
+			action.Reason = fmt.Sprintf("newer than %v", p.KeepNewerThan)
+		default:
+			action.Delete = true
+			action.Reason = "expired"
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// Report writes a table of the planned actions to w.
+func Report(w io.Writer, actions []Action) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tCHANNEL\tNAME\tID\tCREATED\tREASON")
+	for _, action := range actions {
+		verb := "keep"
+		if action.Delete {
+			verb = "delete"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", verb,
+			action.Image.Channel, action.Image.Name, action.Image.ID,
+			action.Image.Created.Format("2006-01-02"), action.Reason)
+	}
+	return tw.Flush()
+}
+
+// AddFlags registers the retention policy flags on a prune-images command.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.IntVar(&keepLast, "keep-last", 25, "number of newest images to keep per channel and image type")
+	flags.DurationVar(&keepNewerThan, "keep-newer-than", 0, "keep images younger than this")
+	flags.StringSliceVar(&protect, "protect", nil, "image name or ID never to delete")
+	flags.StringSliceVar(&protectManifests, "protect-manifest", nil, "plume release manifest whose images must never be deleted (required)")
+	flags.BoolVar(&unprotected, "no-release-protection", false, "run without --protect-manifest, risking deletion of released images")
+	flags.BoolVarP(&dryRun, "dry-run", "n", false, "report what would be deleted without deleting anything")
+}
+
+// FlagPolicy builds the Policy described by the flags from AddFlags.
+// Released images must be protected by at least one manifest unless
+// protection was explicitly turned off.
+func FlagPolicy() (*Policy, error) {
+	if len(protectManifests) == 0 && !unprotected {
+		return nil, errors.New("refusing to prune without --protect-manifest; pass --no-release-protection to override")
+	}
+
+	policy := &Policy{
+		KeepLast:      keepLast,
+		KeepNewerThan: keepNewerThan,
+		Protected:     map[string]bool{},
+	}
+	for _, name := range protect {
+		policy.Protected[name] = true
+	}
+	for _, path := range protectManifests {
+		names, err := manifestImages(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			policy.Protected[name] = true
+		}
+	}
+	return policy, nil
+}
+
+// Run reports the fate of each image under the flag policy and, unless
+// --dry-run was given, deletes the expired ones with del.
+func Run(images []Image, del func(Image) error) error {
+	policy, err := FlagPolicy()
+	if err != nil {
+		return err
+	}
+
+	actions := policy.Plan(images, time.Now())
+	if err := Report(os.Stdout, actions); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	failed := 0
+	for _, action := range actions {
+		if !action.Delete {
+			continue
+		}
+		plog.Noticef("Deleting %v (%v)", action.Image.Name, action.Image.ID)
+		if err := del(action.Image); err != nil {
+			plog.Errorf("Deleting %v failed: %v", action.Image.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d images", failed)
+	}
+	return nil
+}
+
+// manifestImages returns the image names and IDs listed in a release
+// manifest written by plume release.
+func manifestImages(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		AWS []struct {
+			Name    string `json:"name"`
+			ImageID string `json:"id"`
+		} `json:"aws"`
+		GCE *struct {
+			Name string `json:"name"`
+		} `json:"gce"`
+		Azure *struct {
+			ImageName string `json:"image"`
+		} `json:"azure"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("couldn't decode release manifest %v: %v", path, err)
+	}
+
+	var names []string
+	for _, ami := range manifest.AWS {
+		names = append(names, ami.ImageID)
+	}
+	if manifest.GCE != nil {
+		names = append(names, manifest.GCE.Name)
+	}
+	if manifest.Azure != nil {
+		names = append(names, manifest.Azure.ImageName)
+	}
+	return names, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prune
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	images := []Image{
+		{ID: "a1", Channel: "alpha", Created: now.Add(-1 * day)},
+		{ID: "a3", Channel: "alpha", Created: now.Add(-30 * day)},
+		{ID: "a2", Channel: "alpha", Created: now.Add(-10 * day)},
+		{ID: "a4", Channel: "alpha", Created: now.Add(-60 * day)},
+		{ID: "s1", Channel: "stable", Created: now.Add(-90 * day)},
+		{ID: "s2", Channel: "stable", Created: now.Add(-120 * day), Name: "old-stable"},
+		{ID: "s3", Channel: "stable", Created: now.Add(-150 * day)},
+	}
+
+	for _, tt := range []struct {
+		policy  Policy
+		deleted []string
+	}{
+		{
+			policy:  Policy{KeepLast: 1},
+			deleted: []string{"a2", "a3", "a4", "s2", "s3"},
+		},
+		{
+			policy:  Policy{KeepLast: 2},
+			deleted: []string{"a3", "a4", "s3"},
+		},
+		{
+			policy:  Policy{KeepLast: 1, KeepNewerThan: 45 * day},
+			deleted: []string{"a4", "s2", "s3"},
+		},
+		{
+			policy: Policy{KeepLast: 0, Protected: map[string]bool{
+				"a4":         true,
+				"old-stable": true,
+			}},
+			deleted: []string{"a1", "a2", "a3", "s1", "s3"},
+		},
+	} {
+		var deleted []string
+		actions := tt.policy.Plan(images, now)
+		if len(actions) != len(images) {
+			t.Fatalf("%+v: got %d actions, expected %d", tt.policy, len(actions), len(images))
+		}
+		for _, action := range actions {
+			if action.Delete {
+				deleted = append(deleted, action.Image.ID)
+			}
+		}
+		if !reflect.DeepEqual(deleted, tt.deleted) {
+			t.Errorf("%+v: deleted %v, expected %v", tt.policy, deleted, tt.deleted)
+		}
+	}
+}
+
+func TestPlanPerType(t *testing.T) {
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	images := []Image{
+		{ID: "hvm1", Channel: "stable", Type: "hvm", Created: now.Add(-1 * day)},
+		{ID: "pv1", Channel: "stable", Type: "paravirtual", Created: now.Add(-1 * day)},
+		{ID: "hvm2", Channel: "stable", Type: "hvm", Created: now.Add(-2 * day)},
+		{ID: "pv2", Channel: "stable", Type: "paravirtual", Created: now.Add(-2 * day)},
+		{ID: "hvm3", Channel: "stable", Type: "hvm", Created: now.Add(-3 * day)},
+	}
+
+	// The two newest of each type survive, not the two newest overall.
+	policy := Policy{KeepLast: 2}
+	var deleted []string
+	for _, action := range policy.Plan(images, now) {
+		if action.Delete {
+			deleted = append(deleted, action.Image.ID)
+		}
+	}
+	if expected := []string{"hvm3"}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("deleted %v, expected %v", deleted, expected)
+	}
+}
+
+func TestFlagPolicyRequiresManifest(t *testing.T) {
+	defer func(manifests []string, off bool) {
+		protectManifests, unprotected = manifests, off
+	}(protectManifests, unprotected)
+
+	protectManifests, unprotected = nil, false
+	if _, err := FlagPolicy(); err == nil {
+		t.Error("policy without release protection was accepted")
+	}
+
+	unprotected = true
+	if _, err := FlagPolicy(); err != nil {
+		t.Errorf("explicitly unprotected policy was rejected: %v", err)
+	}
+}
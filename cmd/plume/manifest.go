@@ -0,0 +1,294 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/coreos/mantle/storage"
+)
+
+const (
+	manifestName          = "release-manifest.json"
+	manifestSignatureName = manifestName + ".sig"
+)
+
+// releaseManifest is the index of every artifact published for a release.
+type releaseManifest struct {
+	Version   string              `json:"version"`
+	Channel   string              `json:"channel"`
+	Board     string              `json:"board"`
+	Generated string              `json:"generated"`
+	Files     []manifestFile      `json:"files"`
+	AWS       []manifestAMI       `json:"aws,omitempty"`
+	GCE       *manifestGCEImage   `json:"gce,omitempty"`
+	Azure     *manifestAzureImage `json:"azure,omitempty"`
+}
+
+type manifestFile struct {
+	Name   string `json:"name"` // relative to the release directory
+	Size   uint64 `json:"size"`
+	CRC32C string `json:"crc32c"`
+	MD5    string `json:"md5"`
+}
+
+type manifestAMI struct {
+	Partition string `json:"partition"`
+	Region    string `json:"region"`
+	Name      string `json:"name"`
+	ImageID   string `json:"id"`
+}
+
+type manifestGCEImage struct {
+	Project  string `json:"project"`
+	Name     string `json:"name"`
+	SelfLink string `json:"selfLink"`
+}
+
+type manifestAzureImage struct {
+	ImageName     string   `json:"image"`
+	Subscriptions []string `json:"subscriptions"`
+}
+
+func newReleaseManifest() *releaseManifest {
+	return &releaseManifest{
+		Version:   specVersion,
+		Channel:   specChannel,
+		Board:     specBoard,
+		Generated: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// addFiles records every object in the release directory of src, except
+// for the manifest itself.
+func (m *releaseManifest) addFiles(src *storage.Bucket) {
+	objs := src.Objects()
+	storage.SortObjects(objs)
+
+	m.Files = nil
+	for _, obj := range objs {
+		name := strings.TrimPrefix(obj.Name, src.Prefix())
+		if name == obj.Name || name == "" || name == manifestName || name == manifestSignatureName {
+			continue
+		}
+		m.Files = append(m.Files, manifestFile{
+			Name:   name,
+			Size:   obj.Size,
+			CRC32C: obj.Crc32c,
+			MD5:    obj.Md5Hash,
+		})
+	}
+}
+
+func (m *releaseManifest) addAMI(partition, region, name, imageID string) {
+	m.AWS = append(m.AWS, manifestAMI{
+		Partition: partition,
+		Region:    region,
+		Name:      name,
+		ImageID:   imageID,
+	})
+}
+
+// encode returns the canonical JSON form of the manifest, the exact bytes
+// that get signed and published.
+func (m *releaseManifest) encode() ([]byte, error) {
+	sort.Slice(m.AWS, func(i, j int) bool {
+		if m.AWS[i].Region != m.AWS[j].Region {
+			return m.AWS[i].Region < m.AWS[j].Region
+		}
+		return m.AWS[i].Name < m.AWS[j].Name
+	})
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		return nil, fmt.Errorf("couldn't encode release manifest: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// uploadManifest signs the manifest with keyFile and writes it and its
+// detached signature to the release directory of bucket.
+func uploadManifest(ctx context.Context, bucket *storage.Bucket, m *releaseManifest, keyFile string) error {
+	if keyFile == "" {
+		return errors.New("no release manifest signing key given")
+	}
+
+	data, err := m.encode()
+	if err != nil {
+		return err
+	}
+
+	// Sign before uploading anything so a bad key can't leave an
+	// unsigned manifest behind.
+	sig, err := signManifest(data, keyFile)
+	if err != nil {
+		return err
+	}
+
+	obj := gs.Object{
+		Name:        bucket.Prefix() + manifestName,
+		ContentType: "application/json",
+	}
+	if err := bucket.Upload(ctx, &obj, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("couldn't upload %v: %v", manifestName, err)
+	}
+
+	obj = gs.Object{
+		Name:        bucket.Prefix() + manifestSignatureName,
+		ContentType: "text/plain",
+	}
+	if err := bucket.Upload(ctx, &obj, bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("couldn't upload %v: %v", manifestSignatureName, err)
+	}
+	return nil
+}
+
+// downloadManifest fetches and verifies the signed manifest in the
+// release directory of bucket.
+func downloadManifest(ctx context.Context, bucket *storage.Bucket, keyFile string) (*releaseManifest, error) {
+	read := func(name string) ([]byte, error) {
+		r, err := bucket.Download(ctx, bucket.Prefix()+name)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+
+	data, err := read(manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read release manifest: %v", err)
+	}
+	sig, err := read(manifestSignatureName)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read release manifest signature: %v", err)
+	}
+	if err := verifyManifest(data, sig, keyFile); err != nil {
+		return nil, err
+	}
+
+	var m releaseManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("couldn't decode release manifest: %v", err)
+	}
+	return &m, nil
+}
+
+// signManifest produces a detached signature over data. keyFile holds
+// either an ASCII-armored PGP private key or a base64-encoded ed25519
+// private key.
+func signManifest(data []byte, keyFile string) ([]byte, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isArmoredPGP(key) {
+		priv, err := decodeEd25519Key(key, ed25519.PrivateKeySize)
+		if err != nil {
+			return nil, err
+		}
+		sig := ed25519.Sign(ed25519.PrivateKey(priv), data)
+		return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read signing key: %v", err)
+	}
+	var signer *openpgp.Entity
+	for _, entity := range keyring {
+		if entity.PrivateKey != nil {
+			signer = entity
+			break
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("no private key found in %v", keyFile)
+	}
+	if signer.PrivateKey.Encrypted {
+		return nil, fmt.Errorf("private key in %v is encrypted", keyFile)
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("couldn't sign release manifest: %v", err)
+	}
+	return sig.Bytes(), nil
+}
+
+// verifyManifest checks a signature produced by signManifest. keyFile
+// holds the matching ASCII-armored PGP or base64-encoded ed25519 public
+// key.
+func verifyManifest(data, sig []byte, keyFile string) error {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	if !isArmoredPGP(key) {
+		pub, err := decodeEd25519Key(key, ed25519.PublicKeySize)
+		if err != nil {
+			return err
+		}
+		rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("couldn't decode release manifest signature: %v", err)
+		}
+		if !ed25519.Verify(ed25519.PublicKey(pub), data, rawSig) {
+			return errors.New("release manifest signature is invalid")
+		}
+		return nil
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return fmt.Errorf("couldn't read verification key: %v", err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("release manifest signature is invalid: %v", err)
+	}
+	return nil
+}
+
+func isArmoredPGP(key []byte) bool {
+	return bytes.Contains(key, []byte("-----BEGIN PGP"))
+}
+
+func decodeEd25519Key(key []byte, size int) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(key)))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode ed25519 key: %v", err)
+	}
+	if len(raw) != size {
+		return nil, fmt.Errorf("ed25519 key has length %d, expected %d", len(raw), size)
+	}
+	return raw, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/net/context"
+)
+
+func testManifest() *releaseManifest {
+	return &releaseManifest{
+		Version:   "1688.0.0",
+		Channel:   "alpha",
+		Board:     "amd64-usr",
+		Generated: "2018-02-01T00:00:00Z",
+		Files: []manifestFile{
+			{Name: "version.txt", Size: 42, CRC32C: "AAAAAA==", MD5: "1B2M2Y8AsgTpgAmY7PhCfg=="},
+		},
+		AWS: []manifestAMI{
+			{Partition: "default", Region: "us-west-2", Name: "CoreOS-alpha-1688.0.0-hvm", ImageID: "ami-2"},
+			{Partition: "default", Region: "us-east-1", Name: "CoreOS-alpha-1688.0.0-pv", ImageID: "ami-3"},
+			{Partition: "default", Region: "us-east-1", Name: "CoreOS-alpha-1688.0.0-hvm", ImageID: "ami-1"},
+		},
+		GCE: &manifestGCEImage{
+			Project:  "coreos-cloud",
+			Name:     "coreos-alpha-1688-0-0-v20180201",
+			SelfLink: "https://www.googleapis.com/compute/v1/projects/coreos-cloud/global/images/coreos-alpha-1688-0-0-v20180201",
+		},
+	}
+}
+
+func writeKey(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// ed25519Keys writes a fresh ed25519 key pair to dir and returns the
+// private and public key files.
+func ed25519Keys(t *testing.T, dir string) (string, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeKey(t, dir, "key", []byte(base64.StdEncoding.EncodeToString(priv))),
+		writeKey(t, dir, "key.pub", []byte(base64.StdEncoding.EncodeToString(pub)))
+}
+
+// pgpKeys writes a fresh armored PGP key pair to dir and returns the
+// private and public key files.
+func pgpKeys(t *testing.T, dir string) (string, string) {
+	entity, err := openpgp.NewEntity("Release Signer", "", "release@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var priv, pub bytes.Buffer
+	w, err := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w, err = armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	return writeKey(t, dir, "key.asc", priv.Bytes()), writeKey(t, dir, "key.pub.asc", pub.Bytes())
+}
+
+func TestManifestEncode(t *testing.T) {
+	m := testManifest()
+	data, err := m.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// AMIs are sorted by region and then name so the signed bytes
+	// don't depend on the order regions were published in.
+	var ids []string
+	for _, ami := range m.AWS {
+		ids = append(ids, ami.ImageID)
+	}
+	if expected := []string{"ami-1", "ami-3", "ami-2"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("AMIs sorted as %v, expected %v", ids, expected)
+	}
+
+	again, err := m.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("encoding is not stable:\n%s\n%s", data, again)
+	}
+
+	var decoded releaseManifest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, m) {
+		t.Errorf("round trip changed the manifest:\n%+v\n%+v", &decoded, m)
+	}
+}
+
+func TestManifestSignVerify(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		keys func(*testing.T, string) (string, string)
+	}{
+		{"ed25519", ed25519Keys},
+		{"pgp", pgpKeys},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "plume-manifest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			privFile, pubFile := test.keys(t, dir)
+			data, err := testManifest().encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sig, err := signManifest(data, privFile)
+			if err != nil {
+				t.Fatalf("signing failed: %v", err)
+			}
+			if err := verifyManifest(data, sig, pubFile); err != nil {
+				t.Errorf("verifying signed manifest failed: %v", err)
+			}
+
+			tampered := bytes.Replace(data, []byte("ami-1"), []byte("ami-9"), 1)
+			if bytes.Equal(tampered, data) {
+				t.Fatal("failed to tamper with manifest")
+			}
+			if err := verifyManifest(tampered, sig, pubFile); err == nil {
+				t.Error("tampered manifest verified")
+			}
+
+			_, otherPub := test.keys(t, dir)
+			if err := verifyManifest(data, sig, otherPub); err == nil {
+				t.Error("manifest verified with the wrong key")
+			}
+		})
+	}
+}
+
+func TestUploadManifestRequiresKey(t *testing.T) {
+	if err := uploadManifest(context.Background(), nil, testManifest(), ""); err == nil {
+		t.Error("unsigned manifest was accepted")
+	}
+}
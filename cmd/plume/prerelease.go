@@ -23,12 +23,9 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
-	"time"
 
-	"github.com/Azure/azure-sdk-for-go/management/storageservice"
 	"github.com/Microsoft/azure-vhd-utils/vhdcore/validator"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
@@ -200,7 +197,7 @@ func getImageFile(client *http.Client, src *storage.Bucket, fileName string) (st
 	return imagePath, nil
 }
 
-func uploadAzureBlob(spec *channelSpec, api *azure.API, storageKey storageservice.GetStorageServiceKeysResponse, vhdfile, container, blobName string) error {
+func uploadAzureBlob(spec *channelSpec, api *azure.API, storageKey azure.StorageServiceKeys, vhdfile, container, blobName string) error {
 	blobExists, err := api.BlobExists(spec.Azure.StorageAccount, storageKey.PrimaryKey, container, blobName)
 	if err != nil {
 		return fmt.Errorf("failed to check if file %q in account %q container %q exists: %v", vhdfile, spec.Azure.StorageAccount, container, err)
@@ -219,35 +216,26 @@ func uploadAzureBlob(spec *channelSpec, api *azure.API, storageKey storageservic
 }
 
 func createAzureImage(spec *channelSpec, api *azure.API, blobName, imageName string) error {
-	imageexists, err := api.OSImageExists(imageName)
+	imageexists, err := api.ImageExists(imageName)
 	if err != nil {
 		return fmt.Errorf("failed to check if image %q exists: %T %v", imageName, err, err)
 	}
 
 	if imageexists {
-		plog.Printf("OS Image %q exists, using it", imageName)
+		plog.Printf("Image %q exists, using it", imageName)
 		return nil
 	}
 
-	plog.Printf("Creating OS image with name %q", imageName)
+	plog.Printf("Creating image with name %q", imageName)
 
 	bloburl := api.UrlOfBlob(spec.Azure.StorageAccount, spec.Azure.Container, blobName).String()
 
-	// a la https://github.com/coreos/scripts/blob/998c7e093922298637e7c7e82e25cee7d336144d/oem/azure/set-image-metadata.sh
-	md := &azure.OSImage{
-		Label:             spec.Azure.Label,
-		Name:              imageName,
-		OS:                "Linux",
-		Description:       spec.Azure.Description,
-		MediaLink:         bloburl,
-		ImageFamily:       spec.Azure.Label,
-		PublishedDate:     time.Now().UTC().Format("2006-01-02"),
-		RecommendedVMSize: spec.Azure.RecommendedVMSize,
-		IconURI:           spec.Azure.IconURI,
-		SmallIconURI:      spec.Azure.SmallIconURI,
-	}
-
-	return api.AddOSImage(md)
+	_, err = api.CreateImage(imageName, bloburl, map[string]string{
+		"Channel":     specChannel,
+		"Version":     specVersion,
+		"Description": spec.Azure.Description,
+	})
+	return err
 }
 
 func replicateAzureImage(spec *channelSpec, api *azure.API, imageName string) error {
@@ -268,14 +256,30 @@ func replicateAzureImage(spec *channelSpec, api *azure.API, imageName string) er
 	return nil
 }
 
+// newAzureAPI creates a client for the resource group of an environment.
+func newAzureAPI(prof *auth.AzureProfile, environment azureEnvironmentSpec) (*azure.API, error) {
+	opt := prof.SubscriptionOptions(environment.SubscriptionName)
+	if opt == nil {
+		return nil, fmt.Errorf("couldn't find subscription %q", environment.SubscriptionName)
+	}
+	opt.ResourceGroup = environment.ResourceGroup
+	opt.Location = environment.Location
+
+	api, err := azure.New(opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure API: %v", err)
+	}
+	return api, nil
+}
+
 type azureImageInfo struct {
 	ImageName string `json:"image"`
 }
 
 // azurePreRelease runs everything necessary to prepare a CoreOS release for Azure.
 //
-// This includes uploading the vhd image to Azure storage, creating an OS image from it,
-// and replicating that OS image.
+// This includes uploading the vhd image to Azure storage, creating a managed image from it,
+// and replicating that image through the offer's gallery.
 func azurePreRelease(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec, imageInfo *imageInfo) error {
 	if spec.Azure.StorageAccount == "" {
 		plog.Notice("Azure image creation disabled.")
@@ -307,16 +311,11 @@ func azurePreRelease(ctx context.Context, client *http.Client, src *storage.Buck
 	imageName := fmt.Sprintf("%s-%s-%s", spec.Azure.Offer, strings.Title(specChannel), specVersion)
 
 	for _, environment := range spec.Azure.Environments {
-		opt := prof.SubscriptionOptions(environment.SubscriptionName)
-		if opt == nil {
-			return fmt.Errorf("couldn't find subscription %q", environment.SubscriptionName)
-		}
-
 		// construct azure api client
-		plog.Printf("Creating Azure API from subscription %q endpoint %q", opt.SubscriptionID, opt.ManagementURL)
-		api, err := azure.New(opt)
+		plog.Printf("Creating Azure API for subscription %q in %v", environment.SubscriptionName, environment.Location)
+		api, err := newAzureAPI(prof, environment)
 		if err != nil {
-			return fmt.Errorf("failed to create Azure API: %v", err)
+			return err
 		}
 
 		plog.Printf("Fetching Azure storage credentials")
@@ -581,8 +580,7 @@ func awsPreRelease(ctx context.Context, client *http.Client, src *storage.Bucket
 		return nil
 	}
 
-	imageName := fmt.Sprintf("%v-%v-%v", spec.AWS.BaseName, specChannel, specVersion)
-	imageName = regexp.MustCompile(`[^A-Za-z0-9()\\./_-]`).ReplaceAllLiteralString(imageName, "_")
+	imageName := awsImageName(spec, specVersion)
 	imageDescription := fmt.Sprintf("%v %v %v", spec.AWS.BaseDescription, specChannel, specVersion)
 
 	imagePath, err := getImageFile(client, src, spec.AWS.Image)
@@ -29,15 +29,15 @@ import (
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/platform/api/aws"
-	"github.com/coreos/mantle/platform/api/azure"
 	"github.com/coreos/mantle/platform/api/gcloud"
 	"github.com/coreos/mantle/storage"
 	"github.com/coreos/mantle/storage/index"
 )
 
 var (
-	releaseDryRun bool
-	cmdRelease    = &cobra.Command{
+	releaseDryRun   bool
+	manifestKeyFile string
+	cmdRelease      = &cobra.Command{
 		Use:   "release [options]",
 		Short: "Publish a new CoreOS release.",
 		Run:   runRelease,
@@ -50,6 +50,8 @@ func init() {
 	cmdRelease.Flags().StringVar(&azureProfile, "azure-profile", "", "Azure Profile json file")
 	cmdRelease.Flags().BoolVarP(&releaseDryRun, "dry-run", "n", false,
 		"perform a trial run, do not make changes")
+	cmdRelease.Flags().StringVar(&manifestKeyFile, "manifest-key", "",
+		"PGP or ed25519 private key used to sign the release manifest (required)")
 	AddSpecFlags(cmdRelease.Flags())
 	root.AddCommand(cmdRelease)
 }
@@ -58,6 +60,9 @@ func runRelease(cmd *cobra.Command, args []string) {
 	if len(args) > 0 {
 		plog.Fatal("No args accepted")
 	}
+	if manifestKeyFile == "" {
+		plog.Fatal("--manifest-key is required")
+	}
 
 	spec := ChannelSpec()
 	ctx := context.Background()
@@ -82,71 +87,96 @@ func runRelease(cmd *cobra.Command, args []string) {
 		plog.Fatalf("File not found: %s", verurl)
 	}
 
+	manifest := newReleaseManifest()
+
 	// Register GCE image if needed.
-	doGCE(ctx, client, src, &spec)
+	doGCE(ctx, client, src, &spec, manifest)
 
 	// Make Azure images public.
-	doAzure(ctx, client, src, &spec)
+	doAzure(ctx, client, src, &spec, manifest)
 
 	// Make AWS images public.
-	doAWS(ctx, client, src, &spec)
+	doAWS(ctx, client, src, &spec, manifest)
+
+	// Index everything published so far, before it is synced out.
+	manifest.addFiles(src)
+	if err := uploadManifest(ctx, src, manifest, manifestKeyFile); err != nil {
+		plog.Fatal(err)
+	}
 
 	for _, dSpec := range spec.Destinations {
-		dst, err := storage.NewBucket(client, dSpec.BaseURL)
-		if err != nil {
+		syncDestination(ctx, client, src, dSpec, dSpec.FinalPrefixes())
+	}
+}
+
+// syncDestination copies src into each of the given prefixes of a
+// destination and then refreshes the parent directory indexes.
+func syncDestination(ctx context.Context, client *http.Client, src *storage.Bucket, dSpec storageSpec, prefixes []string) {
+	dst, err := storage.NewBucket(client, dSpec.BaseURL)
+	if err != nil {
+		plog.Fatal(err)
+	}
+	dst.WriteDryRun(releaseDryRun)
+
+	// Fetch parent directories non-recursively to re-index it later.
+	for _, prefix := range dSpec.ParentPrefixes() {
+		if err := dst.FetchPrefix(ctx, prefix, false); err != nil {
 			plog.Fatal(err)
 		}
-		dst.WriteDryRun(releaseDryRun)
+	}
 
-		// Fetch parent directories non-recursively to re-index it later.
-		for _, prefix := range dSpec.ParentPrefixes() {
-			if err := dst.FetchPrefix(ctx, prefix, false); err != nil {
-				plog.Fatal(err)
-			}
+	// Fetch and sync each destination directory.
+	for _, prefix := range prefixes {
+		if err := dst.FetchPrefix(ctx, prefix, true); err != nil {
+			plog.Fatal(err)
 		}
 
-		// Fetch and sync each destination directory.
-		for _, prefix := range dSpec.FinalPrefixes() {
-			if err := dst.FetchPrefix(ctx, prefix, true); err != nil {
-				plog.Fatal(err)
-			}
-
-			sync := index.NewSyncIndexJob(src, dst)
-			sync.DestinationPrefix(prefix)
-			sync.DirectoryHTML(dSpec.DirectoryHTML)
-			sync.IndexHTML(dSpec.IndexHTML)
-			sync.Delete(true)
-			if dSpec.Title != "" {
-				sync.Name(dSpec.Title)
-			}
-			if err := sync.Do(ctx); err != nil {
-				plog.Fatal(err)
-			}
+		sync := index.NewSyncIndexJob(src, dst)
+		sync.DestinationPrefix(prefix)
+		sync.DirectoryHTML(dSpec.DirectoryHTML)
+		sync.IndexHTML(dSpec.IndexHTML)
+		sync.Delete(true)
+		if dSpec.Title != "" {
+			sync.Name(dSpec.Title)
+		}
+		if err := sync.Do(ctx); err != nil {
+			plog.Fatal(err)
 		}
+	}
 
-		// Now refresh the parent directory indexes.
-		for _, prefix := range dSpec.ParentPrefixes() {
-			parent := index.NewIndexJob(dst)
-			parent.Prefix(prefix)
-			parent.DirectoryHTML(dSpec.DirectoryHTML)
-			parent.IndexHTML(dSpec.IndexHTML)
-			parent.Recursive(false)
-			parent.Delete(true)
-			if dSpec.Title != "" {
-				parent.Name(dSpec.Title)
-			}
-			if err := parent.Do(ctx); err != nil {
-				plog.Fatal(err)
-			}
+	// Now refresh the parent directory indexes.
+	for _, prefix := range dSpec.ParentPrefixes() {
+		parent := index.NewIndexJob(dst)
+		parent.Prefix(prefix)
+		parent.DirectoryHTML(dSpec.DirectoryHTML)
+		parent.IndexHTML(dSpec.IndexHTML)
+		parent.Recursive(false)
+		parent.Delete(true)
+		if dSpec.Title != "" {
+			parent.Name(dSpec.Title)
+		}
+		if err := parent.Do(ctx); err != nil {
+			plog.Fatal(err)
 		}
 	}
 }
 
-func sanitizeVersion() string {
-	v := strings.Replace(specVersion, ".", "-", -1)
+func sanitizeVersion(version string) string {
+	v := strings.Replace(version, ".", "-", -1)
 	return strings.Replace(v, "+", "-", -1)
 }
 
+// gceImagePrefix is the name of a version's GCE image minus the date suffix.
+func gceImagePrefix(spec *channelSpec, version string) string {
+	return fmt.Sprintf("%s-%s-v", spec.GCE.Family, sanitizeVersion(version))
+}
+
+// awsImageName is the name of a version's PV AMI; the HVM AMI adds "-hvm".
+func awsImageName(spec *channelSpec, version string) string {
+	imageName := fmt.Sprintf("%v-%v-%v", spec.AWS.BaseName, specChannel, version)
+	return regexp.MustCompile(`[^A-Za-z0-9()\\./_-]`).ReplaceAllLiteralString(imageName, "_")
+}
+
 func gceWaitForImage(pending *gcloud.Pending) {
 	plog.Infof("Waiting for image creation to finish...")
 	pending.Interval = 3 * time.Second
@@ -183,7 +213,7 @@ func gceUploadImage(spec *channelSpec, api *gcloud.API, obj *gs.Object, name, de
 	return op.TargetLink
 }
 
-func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec) {
+func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec, manifest *releaseManifest) {
 	if spec.GCE.Project == "" || spec.GCE.Image == "" {
 		plog.Notice("GCE image creation disabled.")
 		return
@@ -197,7 +227,7 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 		plog.Fatalf("GCE client failed: %v", err)
 	}
 
-	nameVer := fmt.Sprintf("%s-%s-v", spec.GCE.Family, sanitizeVersion())
+	nameVer := gceImagePrefix(spec, specVersion)
 	date := time.Now().UTC()
 	name := nameVer + date.Format("20060102")
 	desc := fmt.Sprintf("%s, %s, %s published on %s", spec.GCE.Description,
@@ -267,6 +297,12 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 		imageLink = gceUploadImage(spec, api, obj, name, desc)
 	}
 
+	manifest.GCE = &manifestGCEImage{
+		Project:  spec.GCE.Project,
+		Name:     name,
+		SelfLink: imageLink,
+	}
+
 	if spec.GCE.Publish != "" {
 		obj := gs.Object{
 			Name:        src.Prefix() + spec.GCE.Publish,
@@ -324,7 +360,7 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 	}
 }
 
-func doAzure(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec) {
+func doAzure(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec, manifest *releaseManifest) {
 	if spec.Azure.StorageAccount == "" {
 		plog.Notice("Azure image creation disabled.")
 		return
@@ -337,40 +373,39 @@ func doAzure(ctx context.Context, client *http.Client, src *storage.Bucket, spec
 
 	// channel name should be caps for azure image
 	imageName := fmt.Sprintf("%s-%s-%s", spec.Azure.Offer, strings.Title(specChannel), specVersion)
+	manifest.Azure = &manifestAzureImage{
+		ImageName: imageName,
+	}
 
 	for _, environment := range spec.Azure.Environments {
-		opt := prof.SubscriptionOptions(environment.SubscriptionName)
-		if opt == nil {
-			plog.Fatalf("couldn't find subscription %q", environment.SubscriptionName)
-		}
+		manifest.Azure.Subscriptions = append(manifest.Azure.Subscriptions, environment.SubscriptionName)
 
-		api, err := azure.New(opt)
+		api, err := newAzureAPI(prof, environment)
 		if err != nil {
-			plog.Fatalf("failed to create Azure API: %v", err)
+			plog.Fatal(err)
 		}
 
 		if releaseDryRun {
 			// TODO(bgilbert): check that the image exists
-			plog.Printf("Would share %q on %v", imageName, environment.SubscriptionName)
+			plog.Printf("Would share %q on %v", spec.Azure.Offer, environment.SubscriptionName)
 			continue
 		} else {
-			plog.Printf("Sharing %q on %v...", imageName, environment.SubscriptionName)
+			plog.Printf("Sharing %q on %v...", spec.Azure.Offer, environment.SubscriptionName)
 		}
 
-		if err := api.ShareImage(imageName, "public"); err != nil {
-			plog.Fatalf("failed to share image %q: %v", imageName, err)
+		if err := api.ShareImage(spec.Azure.Offer, "public"); err != nil {
+			plog.Fatalf("failed to share offer %q: %v", spec.Azure.Offer, err)
 		}
 	}
 }
 
-func doAWS(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec) {
+func doAWS(ctx context.Context, client *http.Client, src *storage.Bucket, spec *channelSpec, manifest *releaseManifest) {
 	if spec.AWS.Image == "" {
 		plog.Notice("AWS image creation disabled.")
 		return
 	}
 
-	imageName := fmt.Sprintf("%v-%v-%v", spec.AWS.BaseName, specChannel, specVersion)
-	imageName = regexp.MustCompile(`[^A-Za-z0-9()\\./_-]`).ReplaceAllLiteralString(imageName, "_")
+	imageName := awsImageName(spec, specVersion)
 
 	for _, part := range spec.AWS.Partitions {
 		for _, region := range part.Regions {
@@ -394,6 +429,7 @@ func doAWS(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 				if err != nil {
 					plog.Fatalf("couldn't find image %q in %v %v: %v", imageName, part.Name, region, err)
 				}
+				manifest.addAMI(part.Name, region, imageName, imageID)
 
 				if !releaseDryRun {
 					err := api.PublishImage(imageID)
@@ -0,0 +1,304 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"google.golang.org/api/compute/v1"
+
+	"github.com/coreos/mantle/auth"
+	"github.com/coreos/mantle/platform/api/aws"
+	"github.com/coreos/mantle/platform/api/gcloud"
+	"github.com/coreos/mantle/storage"
+)
+
+var (
+	rollbackPrevious string
+	cmdRollback      = &cobra.Command{
+		Use:   "rollback [options]",
+		Short: "Roll back a bad CoreOS release.",
+		Run:   runRollback,
+		Long: `Roll back a bad CoreOS release.
+
+The release given by --version is withdrawn and the release given by
+--previous-version is made current again: the previous GCE image is
+un-deprecated and the bad one deprecated, the bad AMIs are made private
+and the bad Azure image version excluded from "latest", and the named
+directories (e.g. "current") in each destination bucket are restored
+from the previous release and re-indexed.`,
+	}
+)
+
+func init() {
+	cmdRollback.Flags().StringVar(&awsCredentialsFile, "aws-credentials", "", "AWS credentials file")
+	cmdRollback.Flags().StringVar(&azureProfile, "azure-profile", "", "Azure Profile json file")
+	cmdRollback.Flags().BoolVarP(&releaseDryRun, "dry-run", "n", false,
+		"perform a trial run, do not make changes")
+	cmdRollback.Flags().StringVar(&rollbackPrevious, "previous-version", "",
+		"release version to restore")
+	AddSpecFlags(cmdRollback.Flags())
+	root.AddCommand(cmdRollback)
+}
+
+func runRollback(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		plog.Fatal("No args accepted")
+	}
+	if rollbackPrevious == "" {
+		plog.Fatal("--previous-version is required")
+	}
+	if rollbackPrevious == specVersion {
+		plog.Fatal("--previous-version must differ from --version")
+	}
+
+	spec := ChannelSpec()
+	ctx := context.Background()
+	client, err := getGoogleClient()
+	if err != nil {
+		plog.Fatalf("Authentication failed: %v", err)
+	}
+
+	// Make sure there is something to roll back to before touching
+	// anything else.
+	prev, err := storage.NewBucket(client, spec.VersionSourceURL(rollbackPrevious))
+	if err != nil {
+		plog.Fatal(err)
+	}
+	if err := prev.Fetch(ctx); err != nil {
+		plog.Fatal(err)
+	}
+	if vertxt := prev.Object(prev.Prefix() + "version.txt"); vertxt == nil {
+		verurl := prev.URL().String() + "version.txt"
+		plog.Fatalf("File not found: %s", verurl)
+	}
+
+	rollbackGCE(ctx, &spec)
+	rollbackAzure(&spec)
+	rollbackAWS(&spec)
+	rollbackStorage(ctx, client, prev, &spec)
+}
+
+func rollbackGCE(ctx context.Context, spec *channelSpec) {
+	if spec.GCE.Project == "" || spec.GCE.Image == "" {
+		plog.Notice("GCE image rollback disabled.")
+		return
+	}
+
+	api, err := gcloud.New(&gcloud.Options{
+		Project:     spec.GCE.Project,
+		JSONKeyFile: gceJSONKeyFile,
+	})
+	if err != nil {
+		plog.Fatalf("GCE client failed: %v", err)
+	}
+
+	if err := rollbackGCEImages(ctx, api, spec, specVersion, rollbackPrevious); err != nil {
+		plog.Fatal(err)
+	}
+}
+
+// gceImageAPI is the part of *gcloud.API used to roll back GCE images.
+type gceImageAPI interface {
+	ListImages(ctx context.Context, prefix string) ([]*compute.Image, error)
+	DeprecateImage(name string, state gcloud.DeprecationState, replacement string) (*gcloud.Pending, error)
+}
+
+// gceDeprecation is a change to the deprecation status of a GCE image.
+type gceDeprecation struct {
+	image       *compute.Image
+	state       gcloud.DeprecationState
+	replacement string
+}
+
+// rollbackGCEImages makes the GCE image of version good current again in
+// place of the image of version bad. Older images that were deprecated in
+// favor of the bad image when it was released are pointed at the good
+// image instead.
+func rollbackGCEImages(ctx context.Context, api gceImageAPI, spec *channelSpec, bad, good string) error {
+	images, err := api.ListImages(ctx, spec.GCE.Family+"-")
+	if err != nil {
+		return err
+	}
+
+	find := func(version string) (*compute.Image, error) {
+		var found []*compute.Image
+		for _, image := range images {
+			if strings.HasPrefix(image.Name, gceImagePrefix(spec, version)) {
+				found = append(found, image)
+			}
+		}
+		if len(found) != 1 {
+			return nil, fmt.Errorf("Found %d GCE images for version %v, expected 1", len(found), version)
+		}
+		return found[0], nil
+	}
+	badImage, err := find(bad)
+	if err != nil {
+		return err
+	}
+	goodImage, err := find(good)
+	if err != nil {
+		return err
+	}
+
+	// Restore the good image before deprecating the bad one so the
+	// family always has a current image.
+	changes := []gceDeprecation{
+		{goodImage, gcloud.DeprecationStateActive, ""},
+		{badImage, gcloud.DeprecationStateDeprecated, goodImage.SelfLink},
+	}
+	for _, image := range images {
+		if image == goodImage || image == badImage || image.Deprecated == nil {
+			continue
+		}
+		if image.Deprecated.Replacement == badImage.SelfLink {
+			changes = append(changes, gceDeprecation{
+				image, gcloud.DeprecationState(image.Deprecated.State), goodImage.SelfLink})
+		}
+	}
+
+	for _, change := range changes {
+		desc := fmt.Sprintf("GCE image %s as %s", change.image.Name, change.state)
+		if change.replacement != "" {
+			desc += " in favor of " + path.Base(change.replacement)
+		}
+		if releaseDryRun {
+			plog.Noticef("Would mark %s", desc)
+			continue
+		}
+
+		plog.Noticef("Marking %s", desc)
+		pending, err := api.DeprecateImage(change.image.Name, change.state, change.replacement)
+		if err != nil {
+			return err
+		}
+		pending.Interval = 1 * time.Second
+		if err := pending.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollbackAzure(spec *channelSpec) {
+	if spec.Azure.StorageAccount == "" {
+		plog.Notice("Azure image rollback disabled.")
+		return
+	}
+
+	prof, err := auth.ReadAzureProfile(azureProfile)
+	if err != nil {
+		plog.Fatalf("failed reading Azure profile: %v", err)
+	}
+
+	// channel name should be caps for azure image
+	sku := strings.Title(specChannel)
+	imageName := fmt.Sprintf("%s-%s-%s", spec.Azure.Offer, sku, specVersion)
+
+	for _, environment := range spec.Azure.Environments {
+		api, err := newAzureAPI(prof, environment)
+		if err != nil {
+			plog.Fatal(err)
+		}
+
+		if releaseDryRun {
+			plog.Printf("Would withdraw %q on %v", imageName, environment.SubscriptionName)
+			continue
+		} else {
+			plog.Printf("Withdrawing %q on %v...", imageName, environment.SubscriptionName)
+		}
+
+		if err := api.ExcludeImageVersion(spec.Azure.Offer, sku, specVersion, true); err != nil {
+			plog.Fatalf("failed to withdraw image %q: %v", imageName, err)
+		}
+	}
+}
+
+func rollbackAWS(spec *channelSpec) {
+	if spec.AWS.Image == "" {
+		plog.Notice("AWS image rollback disabled.")
+		return
+	}
+
+	imageName := awsImageName(spec, specVersion)
+
+	for _, part := range spec.AWS.Partitions {
+		for _, region := range part.Regions {
+			if releaseDryRun {
+				plog.Printf("Checking for images in %v %v...", part.Name, region)
+			} else {
+				plog.Printf("Withdrawing images in %v %v...", part.Name, region)
+			}
+
+			api, err := aws.New(&aws.Options{
+				CredentialsFile: awsCredentialsFile,
+				Profile:         part.Profile,
+				Region:          region,
+			})
+			if err != nil {
+				plog.Fatalf("creating client for %v %v: %v", part.Name, region, err)
+			}
+
+			withdraw := func(imageName string) {
+				imageID, err := api.FindImage(imageName)
+				if err != nil {
+					plog.Fatalf("couldn't find image %q in %v %v: %v", imageName, part.Name, region, err)
+				}
+				if imageID == "" {
+					plog.Noticef("Image %q not found in %v %v", imageName, part.Name, region)
+					return
+				}
+
+				if releaseDryRun {
+					plog.Noticef("Would withdraw %v (%v)", imageID, imageName)
+					return
+				}
+
+				if err := api.UnpublishImage(imageID); err != nil {
+					plog.Fatalf("couldn't unpublish image in %v %v: %v", part.Name, region, err)
+				}
+				if len(part.LaunchPermissions) > 0 {
+					if err := api.RevokeLaunchPermission(imageID, part.LaunchPermissions); err != nil {
+						plog.Fatalf("couldn't revoke launch permission in %v %v: %v", part.Name, region, err)
+					}
+				}
+			}
+			if aws.RegionSupportsPV(region) {
+				withdraw(imageName)
+			}
+			withdraw(imageName + "-hvm")
+		}
+	}
+}
+
+func rollbackStorage(ctx context.Context, client *http.Client, prev *storage.Bucket, spec *channelSpec) {
+	prev.WriteDryRun(releaseDryRun)
+
+	for _, dSpec := range spec.Destinations {
+		prefix := dSpec.NamedPrefix()
+		if prefix == "" {
+			continue
+		}
+		plog.Noticef("Restoring %v %v from %v", dSpec.BaseURL, prefix, prev.URL())
+		syncDestination(ctx, client, prev, dSpec, []string{prefix})
+	}
+}
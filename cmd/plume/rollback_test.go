@@ -0,0 +1,161 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/coreos/mantle/platform/api/gcloud"
+)
+
+// fakeGCEImages records the deprecation changes made to its images.
+type fakeGCEImages struct {
+	images []*compute.Image
+	calls  []string
+}
+
+func (f *fakeGCEImages) ListImages(ctx context.Context, prefix string) ([]*compute.Image, error) {
+	return f.images, nil
+}
+
+func (f *fakeGCEImages) DeprecateImage(name string, state gcloud.DeprecationState, replacement string) (*gcloud.Pending, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%s %s %s", name, state, replacement))
+	return (&gcloud.API{}).NewPending(name, doneOperation{}), nil
+}
+
+type doneOperation struct{}
+
+func (doneOperation) Do(...googleapi.CallOption) (*compute.Operation, error) {
+	return &compute.Operation{Status: "DONE"}, nil
+}
+
+// gceImage returns an image of the given name, deprecated in favor of
+// replacement unless that is empty.
+func gceImage(name, replacement string) *compute.Image {
+	image := &compute.Image{Name: name, SelfLink: "images/" + name}
+	if replacement != "" {
+		image.Deprecated = &compute.DeprecationStatus{
+			State:       string(gcloud.DeprecationStateDeprecated),
+			Replacement: "images/" + replacement,
+		}
+	}
+	return image
+}
+
+func TestRollbackGCEImages(t *testing.T) {
+	spec := &channelSpec{GCE: gceSpec{Family: "coreos-stable"}}
+	for _, tt := range []struct {
+		name   string
+		good   string // version to restore, 1.2.2 if empty
+		images []*compute.Image
+		calls  []string // nil if the rollback fails
+	}{
+		{
+			name: "previous release",
+			images: []*compute.Image{
+				gceImage("coreos-stable-1-2-3-v20180102", ""),
+				gceImage("coreos-stable-1-2-2-v20180101", "coreos-stable-1-2-3-v20180102"),
+			},
+			calls: []string{
+				"coreos-stable-1-2-2-v20180101 ACTIVE ",
+				"coreos-stable-1-2-3-v20180102 DEPRECATED images/coreos-stable-1-2-2-v20180101",
+			},
+		},
+		{
+			name: "older release",
+			good: "1.2.1",
+			images: []*compute.Image{
+				gceImage("coreos-stable-1-2-3-v20180103", ""),
+				gceImage("coreos-stable-1-2-2-v20180102", "coreos-stable-1-2-3-v20180103"),
+				gceImage("coreos-stable-1-2-1-v20180101", "coreos-stable-1-2-3-v20180103"),
+			},
+			calls: []string{
+				"coreos-stable-1-2-1-v20180101 ACTIVE ",
+				"coreos-stable-1-2-3-v20180103 DEPRECATED images/coreos-stable-1-2-1-v20180101",
+				"coreos-stable-1-2-2-v20180102 DEPRECATED images/coreos-stable-1-2-1-v20180101",
+			},
+		},
+		{
+			name: "older images re-pointed",
+			images: []*compute.Image{
+				gceImage("coreos-stable-1-2-3-v20180104", ""),
+				gceImage("coreos-stable-1-2-2-v20180103", "coreos-stable-1-2-3-v20180104"),
+				gceImage("coreos-stable-1-2-1-v20180102", "coreos-stable-1-2-3-v20180104"),
+				gceImage("coreos-stable-1-2-0-v20180101", "coreos-stable-1-2-1-v20180102"),
+			},
+			calls: []string{
+				"coreos-stable-1-2-2-v20180103 ACTIVE ",
+				"coreos-stable-1-2-3-v20180104 DEPRECATED images/coreos-stable-1-2-2-v20180103",
+				"coreos-stable-1-2-1-v20180102 DEPRECATED images/coreos-stable-1-2-2-v20180103",
+			},
+		},
+		{
+			name: "similar version",
+			images: []*compute.Image{
+				gceImage("coreos-stable-1-2-30-v20180103", ""),
+				gceImage("coreos-stable-1-2-3-v20180102", "coreos-stable-1-2-30-v20180103"),
+				gceImage("coreos-stable-1-2-2-v20180101", "coreos-stable-1-2-3-v20180102"),
+			},
+			calls: []string{
+				"coreos-stable-1-2-2-v20180101 ACTIVE ",
+				"coreos-stable-1-2-3-v20180102 DEPRECATED images/coreos-stable-1-2-2-v20180101",
+			},
+		},
+		{
+			name: "missing previous release",
+			images: []*compute.Image{
+				gceImage("coreos-stable-1-2-3-v20180102", ""),
+				gceImage("coreos-stable-1-2-1-v20180101", "coreos-stable-1-2-3-v20180102"),
+			},
+		},
+		{
+			name: "duplicate bad release",
+			images: []*compute.Image{
+				gceImage("coreos-stable-1-2-3-v20180103", ""),
+				gceImage("coreos-stable-1-2-3-v20180102", ""),
+				gceImage("coreos-stable-1-2-2-v20180101", "coreos-stable-1-2-3-v20180102"),
+			},
+		},
+	} {
+		good := tt.good
+		if good == "" {
+			good = "1.2.2"
+		}
+		api := &fakeGCEImages{images: tt.images}
+		err := rollbackGCEImages(context.Background(), api, spec, "1.2.3", good)
+		if tt.calls == nil {
+			if err == nil {
+				t.Errorf("%s: rollback succeeded", tt.name)
+			}
+			if len(api.calls) > 0 {
+				t.Errorf("%s: failed rollback changed images: %v", tt.name, api.calls)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(api.calls, tt.calls) {
+			t.Errorf("%s: changed\n%q\nexpected\n%q", tt.name, api.calls, tt.calls)
+		}
+	}
+}
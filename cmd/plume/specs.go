@@ -47,6 +47,8 @@ type gceSpec struct {
 
 type azureEnvironmentSpec struct {
 	SubscriptionName     string   // Name of subscription in Azure profile
+	ResourceGroup        string   // Resource group holding images and galleries
+	Location             string   // Location of the resource group
 	AdditionalContainers []string // Extra containers to upload the disk image to
 }
 
@@ -56,13 +58,7 @@ type azureSpec struct {
 	StorageAccount string                 // Storage account to use for image uploads in each environment
 	Container      string                 // Container to hold the disk image in each environment
 	Environments   []azureEnvironmentSpec // Azure environments to upload to
-
-	// Fields for azure.OSImage
-	Label             string
-	Description       string // Description of an image in this channel
-	RecommendedVMSize string
-	IconURI           string
-	SmallIconURI      string
+	Description    string                 // Description of an image in this channel
 }
 
 type awsPartitionSpec struct {
@@ -101,13 +97,19 @@ var (
 	azureEnvironments = []azureEnvironmentSpec{
 		azureEnvironmentSpec{
 			SubscriptionName:     "BizSpark",
+			ResourceGroup:        "coreos",
+			Location:             "westus",
 			AdditionalContainers: []string{"pre-publish"},
 		},
 		azureEnvironmentSpec{
 			SubscriptionName: "BlackForest",
+			ResourceGroup:    "coreos",
+			Location:         "germanycentral",
 		},
 		azureEnvironmentSpec{
 			SubscriptionName: "Mooncake",
+			ResourceGroup:    "coreos",
+			Location:         "chinaeast",
 		},
 	}
 	awsPartitions = []awsPartitionSpec{
@@ -276,16 +278,12 @@ var (
 				Limit:       25,
 			},
 			Azure: azureSpec{
-				Offer:             "CoreOS",
-				Image:             "coreos_production_azure_image.vhd.bz2",
-				StorageAccount:    "coreos",
-				Container:         "publish",
-				Environments:      azureEnvironments,
-				Label:             "CoreOS Alpha",
-				Description:       "The Alpha channel closely tracks current development work and is released frequently. The newest versions of the Linux kernel, systemd, and other components will be available for testing.",
-				RecommendedVMSize: "Medium",
-				IconURI:           "coreos-globe-color-lg-100px.png",
-				SmallIconURI:      "coreos-globe-color-lg-45px.png",
+				Offer:          "CoreOS",
+				Image:          "coreos_production_azure_image.vhd.bz2",
+				StorageAccount: "coreos",
+				Container:      "publish",
+				Environments:   azureEnvironments,
+				Description:    "The Alpha channel closely tracks current development work and is released frequently. The newest versions of the Linux kernel, systemd, and other components will be available for testing.",
 			},
 			AWS: awsSpec{
 				BaseName:        "CoreOS",
@@ -331,16 +329,12 @@ var (
 				Limit:       25,
 			},
 			Azure: azureSpec{
-				Offer:             "CoreOS",
-				Image:             "coreos_production_azure_image.vhd.bz2",
-				StorageAccount:    "coreos",
-				Container:         "publish",
-				Environments:      azureEnvironments,
-				Label:             "CoreOS Beta",
-				Description:       "The Beta channel consists of promoted Alpha releases. Mix a few Beta machines into your production clusters to catch any bugs specific to your hardware or configuration.",
-				RecommendedVMSize: "Medium",
-				IconURI:           "coreos-globe-color-lg-100px.png",
-				SmallIconURI:      "coreos-globe-color-lg-45px.png",
+				Offer:          "CoreOS",
+				Image:          "coreos_production_azure_image.vhd.bz2",
+				StorageAccount: "coreos",
+				Container:      "publish",
+				Environments:   azureEnvironments,
+				Description:    "The Beta channel consists of promoted Alpha releases. Mix a few Beta machines into your production clusters to catch any bugs specific to your hardware or configuration.",
 			},
 			AWS: awsSpec{
 				BaseName:        "CoreOS",
@@ -376,16 +370,12 @@ var (
 				Limit:       25,
 			},
 			Azure: azureSpec{
-				Offer:             "CoreOS",
-				Image:             "coreos_production_azure_image.vhd.bz2",
-				StorageAccount:    "coreos",
-				Container:         "publish",
-				Environments:      azureEnvironments,
-				Label:             "CoreOS Stable",
-				Description:       "The Stable channel should be used by production clusters. Versions of CoreOS are battle-tested within the Beta and Alpha channels before being promoted.",
-				RecommendedVMSize: "Medium",
-				IconURI:           "coreos-globe-color-lg-100px.png",
-				SmallIconURI:      "coreos-globe-color-lg-45px.png",
+				Offer:          "CoreOS",
+				Image:          "coreos_production_azure_image.vhd.bz2",
+				StorageAccount: "coreos",
+				Container:      "publish",
+				Environments:   azureEnvironments,
+				Description:    "The Stable channel should be used by production clusters. Versions of CoreOS are battle-tested within the Beta and Alpha channels before being promoted.",
 			},
 			AWS: awsSpec{
 				BaseName:        "CoreOS",
@@ -474,11 +464,15 @@ func ChannelSpec() channelSpec {
 }
 
 func (cs channelSpec) SourceURL() string {
+	return cs.VersionSourceURL(specVersion)
+}
+
+func (cs channelSpec) VersionSourceURL(version string) string {
 	u, err := url.Parse(cs.BaseURL)
 	if err != nil {
 		panic(err)
 	}
-	u.Path = path.Join(u.Path, specBoard, specVersion)
+	u.Path = path.Join(u.Path, specBoard, version)
 	return u.String()
 }
 
@@ -511,3 +505,16 @@ func (ss storageSpec) FinalPrefixes() []string {
 
 	return prefixes
 }
+
+// NamedPrefix returns the prefix of the named path, e.g. "current", or
+// "" if the destination doesn't have one.
+func (ss storageSpec) NamedPrefix() string {
+	if ss.NamedPath == "" {
+		return ""
+	}
+	u, err := url.Parse(ss.BaseURL)
+	if err != nil {
+		plog.Panic(err)
+	}
+	return path.Join(u.Path, specBoard, ss.NamedPath)
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/auth"
+	"github.com/coreos/mantle/platform/api/aws"
+	"github.com/coreos/mantle/platform/api/gcloud"
+	"github.com/coreos/mantle/storage"
+)
+
+var (
+	cmdVerifyRelease = &cobra.Command{
+		Use:   "verify-release [options]",
+		Short: "Verify a published CoreOS release against its manifest.",
+		Run:   runVerifyRelease,
+		Long: `Verify a published CoreOS release against its manifest.
+
+The signed release manifest written by plume release is fetched from the
+source bucket and every file, GCE image, Azure image and AMI it lists is
+checked against what is actually published.`,
+	}
+)
+
+func init() {
+	cmdVerifyRelease.Flags().StringVar(&awsCredentialsFile, "aws-credentials", "", "AWS credentials file")
+	cmdVerifyRelease.Flags().StringVar(&azureProfile, "azure-profile", "", "Azure Profile json file")
+	cmdVerifyRelease.Flags().StringVar(&manifestKeyFile, "manifest-key", "",
+		"PGP or ed25519 public key used to verify the release manifest")
+	AddSpecFlags(cmdVerifyRelease.Flags())
+	root.AddCommand(cmdVerifyRelease)
+}
+
+// releaseVerifier accumulates problems found while checking a release so
+// that a single run reports all of them.
+type releaseVerifier struct {
+	failures int
+}
+
+func (v *releaseVerifier) fail(format string, args ...interface{}) {
+	plog.Errorf(format, args...)
+	v.failures++
+}
+
+func runVerifyRelease(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		plog.Fatal("No args accepted")
+	}
+	if manifestKeyFile == "" {
+		plog.Fatal("--manifest-key is required")
+	}
+
+	spec := ChannelSpec()
+	ctx := context.Background()
+	client, err := getGoogleClient()
+	if err != nil {
+		plog.Fatalf("Authentication failed: %v", err)
+	}
+
+	src, err := storage.NewBucket(client, spec.SourceURL())
+	if err != nil {
+		plog.Fatal(err)
+	}
+	if err := src.Fetch(ctx); err != nil {
+		plog.Fatal(err)
+	}
+
+	manifest, err := downloadManifest(ctx, src, manifestKeyFile)
+	if err != nil {
+		plog.Fatal(err)
+	}
+	plog.Noticef("Verified manifest signature for %v %v %v",
+		manifest.Channel, manifest.Board, manifest.Version)
+
+	var v releaseVerifier
+	if manifest.Version != specVersion || manifest.Channel != specChannel || manifest.Board != specBoard {
+		v.fail("Manifest describes %v %v %v, expected %v %v %v",
+			manifest.Channel, manifest.Board, manifest.Version,
+			specChannel, specBoard, specVersion)
+	}
+
+	v.verifyFiles(src, src.Prefix(), manifest)
+	if err := v.verifyDestinations(ctx, client, &spec, manifest); err != nil {
+		plog.Fatal(err)
+	}
+
+	v.verifyGCE(manifest)
+	v.verifyAzure(&spec, manifest)
+	v.verifyAWS(&spec, manifest)
+
+	if v.failures > 0 {
+		plog.Fatalf("Release verification found %d problems", v.failures)
+	}
+	plog.Notice("Release verified.")
+}
+
+// verifyDestinations checks the manifest's files in every directory the
+// release was copied to.
+func (v *releaseVerifier) verifyDestinations(ctx context.Context, client *http.Client, spec *channelSpec, manifest *releaseManifest) error {
+	for _, dSpec := range spec.Destinations {
+		dst, err := storage.NewBucket(client, dSpec.BaseURL)
+		if err != nil {
+			return err
+		}
+		for _, prefix := range dSpec.FinalPrefixes() {
+			// FinalPrefixes are URL paths, with a leading slash
+			prefix = storage.FixPrefix(prefix)
+			if err := dst.FetchPrefix(ctx, prefix, true); err != nil {
+				return err
+			}
+			v.verifyFiles(dst, prefix, manifest)
+		}
+	}
+	return nil
+}
+
+// verifyFiles checks the manifest's files under prefix in bucket, which
+// must already be fetched.
+func (v *releaseVerifier) verifyFiles(bucket *storage.Bucket, prefix string, manifest *releaseManifest) {
+	dir := bucket.URL()
+	dir.Path = prefix
+	plog.Infof("Checking %d files in %v", len(manifest.Files), dir)
+	for _, file := range manifest.Files {
+		obj := bucket.Object(prefix + file.Name)
+		switch {
+		case obj == nil:
+			v.fail("%v%v: missing", dir, file.Name)
+		case obj.Size != file.Size:
+			v.fail("%v%v: size %d, expected %d", dir, file.Name, obj.Size, file.Size)
+		case obj.Crc32c != file.CRC32C:
+			v.fail("%v%v: CRC32C %v, expected %v", dir, file.Name, obj.Crc32c, file.CRC32C)
+		case file.MD5 != "" && obj.Md5Hash != file.MD5:
+			v.fail("%v%v: MD5 %v, expected %v", dir, file.Name, obj.Md5Hash, file.MD5)
+		}
+	}
+}
+
+func (v *releaseVerifier) verifyGCE(manifest *releaseManifest) {
+	if manifest.GCE == nil {
+		return
+	}
+
+	api, err := gcloud.New(&gcloud.Options{
+		Project:     manifest.GCE.Project,
+		JSONKeyFile: gceJSONKeyFile,
+	})
+	if err != nil {
+		plog.Fatalf("GCE client failed: %v", err)
+	}
+
+	plog.Infof("Checking GCE image %v", manifest.GCE.Name)
+	image, err := api.GetImage(manifest.GCE.Name)
+	if err != nil {
+		v.fail("%v", err)
+		return
+	}
+	if image.SelfLink != manifest.GCE.SelfLink {
+		v.fail("GCE image %v: self-link %v, expected %v", image.Name, image.SelfLink, manifest.GCE.SelfLink)
+	}
+	if image.Status != "READY" {
+		v.fail("GCE image %v: status %v", image.Name, image.Status)
+	}
+	if image.Deprecated != nil && image.Deprecated.State != "" {
+		v.fail("GCE image %v: deprecated (%v)", image.Name, image.Deprecated.State)
+	}
+}
+
+func (v *releaseVerifier) verifyAzure(spec *channelSpec, manifest *releaseManifest) {
+	if manifest.Azure == nil {
+		return
+	}
+
+	prof, err := auth.ReadAzureProfile(azureProfile)
+	if err != nil {
+		plog.Fatalf("failed reading Azure profile: %v", err)
+	}
+
+	environments := map[string]azureEnvironmentSpec{}
+	for _, environment := range spec.Azure.Environments {
+		environments[environment.SubscriptionName] = environment
+	}
+
+	sku := strings.Title(manifest.Channel)
+	for _, subscription := range manifest.Azure.Subscriptions {
+		environment, ok := environments[subscription]
+		if !ok {
+			v.fail("Azure image %v: unknown subscription %q", manifest.Azure.ImageName, subscription)
+			continue
+		}
+		api, err := newAzureAPI(prof, environment)
+		if err != nil {
+			plog.Fatal(err)
+		}
+
+		plog.Infof("Checking Azure image %v on %v", manifest.Azure.ImageName, subscription)
+		exists, err := api.ImageVersionExists(spec.Azure.Offer, sku, manifest.Version)
+		if err != nil {
+			v.fail("Azure image %v on %v: %v", manifest.Azure.ImageName, subscription, err)
+		} else if !exists {
+			v.fail("Azure image %v on %v: missing", manifest.Azure.ImageName, subscription)
+		}
+	}
+}
+
+func (v *releaseVerifier) verifyAWS(spec *channelSpec, manifest *releaseManifest) {
+	profiles := map[string]string{}
+	for _, part := range spec.AWS.Partitions {
+		profiles[part.Name] = part.Profile
+	}
+
+	for _, ami := range manifest.AWS {
+		profile, ok := profiles[ami.Partition]
+		if !ok {
+			v.fail("AMI %v: unknown partition %q", ami.ImageID, ami.Partition)
+			continue
+		}
+
+		api, err := aws.New(&aws.Options{
+			CredentialsFile: awsCredentialsFile,
+			Profile:         profile,
+			Region:          ami.Region,
+		})
+		if err != nil {
+			plog.Fatalf("creating client for %v %v: %v", ami.Partition, ami.Region, err)
+		}
+
+		plog.Infof("Checking AMI %v (%v) in %v", ami.ImageID, ami.Name, ami.Region)
+		imageID, err := api.FindImage(ami.Name)
+		if err != nil {
+			v.fail("AMI %v in %v: %v", ami.Name, ami.Region, err)
+			continue
+		}
+		if imageID != ami.ImageID {
+			v.fail("AMI %v in %v: found %q, expected %v", ami.Name, ami.Region, imageID, ami.ImageID)
+			continue
+		}
+		public, err := api.IsImagePublic(ami.ImageID)
+		if err != nil {
+			v.fail("AMI %v in %v: %v", ami.ImageID, ami.Region, err)
+		} else if !public {
+			v.fail("AMI %v in %v: not public", ami.ImageID, ami.Region)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+// fakeGCS serves object listings of a single bucket over the Cloud
+// Storage JSON API.
+type fakeGCS struct {
+	t       *testing.T
+	bucket  string
+	objects []*gs.Object
+}
+
+func (f *fakeGCS) RoundTrip(req *http.Request) (*http.Response, error) {
+	reply := func(code int, v interface{}) (*http.Response, error) {
+		body, err := json.Marshal(v)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+	notFound := map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Not Found"}}
+
+	objects := "/storage/v1/b/" + f.bucket + "/o"
+	switch {
+	case req.URL.Path == objects:
+		prefix := req.URL.Query().Get("prefix")
+		var list gs.Objects
+		for _, obj := range f.objects {
+			if strings.HasPrefix(obj.Name, prefix) {
+				obj.Bucket = f.bucket
+				list.Items = append(list.Items, obj)
+			}
+		}
+		return reply(http.StatusOK, &list)
+	case strings.HasPrefix(req.URL.Path, objects+"/"):
+		// only the directory redirect objects are fetched directly
+		return reply(http.StatusNotFound, notFound)
+	default:
+		f.t.Errorf("unexpected request %s %s", req.Method, req.URL)
+		return reply(http.StatusNotFound, notFound)
+	}
+}
+
+func TestVerifyDestinations(t *testing.T) {
+	defer func(board, version string) {
+		specBoard, specVersion = board, version
+	}(specBoard, specVersion)
+	specBoard, specVersion = "amd64-usr", "1688.0.0"
+
+	manifest := testManifest()
+	file := manifest.Files[0]
+	published := func(name string) *gs.Object {
+		return &gs.Object{Name: name, Size: file.Size, Crc32c: file.CRC32C, Md5Hash: file.MD5}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		baseURL  string
+		objects  []*gs.Object
+		failures int
+	}{
+		{
+			name:    "bucket root",
+			baseURL: "gs://builds.example.com",
+			objects: []*gs.Object{published("amd64-usr/1688.0.0/version.txt")},
+		},
+		{
+			name:    "path in bucket",
+			baseURL: "gs://storage.example.com/coreos",
+			objects: []*gs.Object{published("coreos/amd64-usr/1688.0.0/version.txt")},
+		},
+		{
+			name:     "missing",
+			baseURL:  "gs://storage.example.com/coreos",
+			objects:  []*gs.Object{published("amd64-usr/1688.0.0/version.txt")},
+			failures: 1,
+		},
+		{
+			name:    "changed",
+			baseURL: "gs://storage.example.com/coreos",
+			objects: []*gs.Object{{
+				Name:    "coreos/amd64-usr/1688.0.0/version.txt",
+				Size:    file.Size,
+				Crc32c:  "BBBBBB==",
+				Md5Hash: file.MD5,
+			}},
+			failures: 1,
+		},
+	} {
+		bucket := strings.SplitN(strings.TrimPrefix(tt.baseURL, "gs://"), "/", 2)[0]
+		client := &http.Client{Transport: &fakeGCS{t: t, bucket: bucket, objects: tt.objects}}
+		spec := channelSpec{
+			Destinations: []storageSpec{{BaseURL: tt.baseURL, VersionPath: true}},
+		}
+
+		var v releaseVerifier
+		if err := v.verifyDestinations(context.Background(), client, &spec, manifest); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if v.failures != tt.failures {
+			t.Errorf("%s: found %d problems, expected %d", tt.name, v.failures, tt.failures)
+		}
+	}
+}
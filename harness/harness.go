@@ -45,7 +45,7 @@ import (
 // The other reporting methods, such as the variations of Log and Error,
 // may be called simultaneously from multiple goroutines.
 type H struct {
-	mu       sync.RWMutex // guards output, failed, and done.
+	mu       sync.RWMutex // guards output, failed, done, and expired.
 	output   bytes.Buffer // Output generated by test.
 	w        io.Writer    // For flushToParent.
 	tap      io.Writer    // Optional TAP log of test results.
@@ -57,6 +57,7 @@ type H struct {
 	skipped  bool // Test has been skipped.
 	finished bool // Test function has completed.
 	done     bool // Test is finished and all subtests have completed.
+	expired  bool // Test completed after its deadline passed.
 	hasSub   bool
 
 	suite    *Suite
@@ -76,6 +77,9 @@ type H struct {
 
 func (c *H) parentContext() context.Context {
 	if c == nil || c.parent == nil || c.parent.ctx == nil {
+		if c != nil && c.suite != nil && c.suite.opts.Context != nil {
+			return c.suite.opts.Context
+		}
 		return context.Background()
 	}
 	return c.parent.ctx
@@ -166,6 +170,37 @@ func (c *H) Context() context.Context {
 	return c.ctx
 }
 
+// SetTimeout sets a deadline on the test's Context, which subtests started
+// afterwards inherit. It does not stop the test by itself; the test must
+// watch its Context. SetTimeout must be called from the goroutine running
+// the Test function, before any subtests are started.
+//
+// A test that gives up on a goroutine when its deadline passes may end
+// before that goroutine does. Logs and failures from such goroutines after
+// the test has completed are discarded rather than causing a panic.
+func (c *H) SetTimeout(d time.Duration) {
+	ctx, cancel := context.WithTimeout(c.ctx, d)
+	parentCancel := c.cancel
+	c.ctx = ctx
+	c.cancel = func() {
+		cancel()
+		parentCancel()
+	}
+}
+
+// ReportFinding records a finding about the test, such as badness found
+// in a machine's logs, with the suite's reporters. It doesn't fail the
+// test by itself.
+func (c *H) ReportFinding(f reporters.Finding) {
+	c.reporters.ReportFinding(c.name, f)
+}
+
+// ReportMetric records a measurement made by the test, such as a
+// benchmark result, with the suite's reporters.
+func (c *H) ReportMetric(m reporters.Metric) {
+	c.reporters.ReportMetric(c.name, m)
+}
+
 func (c *H) setRan() {
 	if c.parent != nil {
 		c.parent.setRan()
@@ -177,6 +212,9 @@ func (c *H) setRan() {
 
 // Fail marks the function as having failed but continues execution.
 func (c *H) Fail() {
+	if c.timedOut() {
+		return
+	}
 	if c.parent != nil {
 		c.parent.Fail()
 	}
@@ -228,11 +266,24 @@ func (c *H) FailNow() {
 	runtime.Goexit()
 }
 
+// timedOut reports whether the test has completed after its deadline
+// passed, see SetTimeout.
+func (c *H) timedOut() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.expired
+}
+
 // log generates the output. It's always at the same stack depth.
 func (c *H) log(s string) {
+	if c.timedOut() {
+		return
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	start := c.output.Len()
 	c.logger.Output(3, s)
+	c.reporters.ReportOutput(c.name, c.output.Bytes()[start:])
 }
 
 // Log formats its arguments using default formatting, analogous to Println,
@@ -423,6 +474,12 @@ func tRunner(t *H, fn func(t *H)) {
 		}
 		t.report() // Report after all subtests have finished.
 
+		// Goroutines that a timed out test gave up on may still
+		// report to it; see SetTimeout.
+		t.mu.Lock()
+		t.expired = t.ctx.Err() == context.DeadlineExceeded
+		t.mu.Unlock()
+
 		// Do not lock t.done to allow race detector to detect race in case
 		// the user does not appropriately synchronize a goroutine.
 		t.done = true
@@ -466,6 +523,7 @@ func (t *H) Run(name string, f func(t *H)) bool {
 		}
 		fmt.Fprintf(root.w, "=== RUN   %s\n", t.name)
 	}
+	t.reporters.ReportRun(t.name)
 	// Instead of reducing the running count of this test before calling the
 	// tRunner and increasing it afterwards, we rely on tRunner keeping the
 	// count correct. This ensures that a sequence of sequential tests runs
@@ -28,6 +28,9 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/harness/testresult"
 )
 
 func TestMain(m *testing.M) {
@@ -71,6 +74,52 @@ func TestContextCancel(t *testing.T) {
 	}
 }
 
+func TestSetTimeout(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{
+		"SetTimeout": func(h *H) {
+			h.SetTimeout(time.Millisecond)
+			h.Run("sub", func(h *H) {
+				if _, ok := h.Context().Deadline(); !ok {
+					h.Error("subtest context has no deadline")
+				}
+				<-h.Context().Done()
+			})
+		}})
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+}
+
+func TestTimeoutLateFatal(t *testing.T) {
+	release := make(chan struct{})
+	exited := make(chan struct{})
+	suite := NewSuite(Options{}, Tests{
+		"Timeout": func(h *H) {
+			h.SetTimeout(time.Millisecond)
+			// A goroutine stuck past the deadline that only fails
+			// after the test has given up on it and completed.
+			go func() {
+				defer close(exited)
+				<-release
+				h.Fatal("late failure")
+			}()
+			<-h.Context().Done()
+			h.Error("timed out")
+		}})
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err == nil {
+		t.Error("timed out test passed")
+	}
+
+	close(release)
+	<-exited
+	if strings.Contains(buf.String(), "late failure") {
+		t.Errorf("late failure was reported:\n%s", buf.String())
+	}
+}
+
 func TestSubTests(t *testing.T) {
 	realTest := t
 	testCases := []struct {
@@ -487,3 +536,43 @@ func TestTempFile(t *testing.T) {
 		t.Errorf("%q missing %q prefix", second, "second")
 	}
 }
+
+func TestReportMetric(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	suitedir := filepath.Join(dir, "_test_temp")
+
+	opts := Options{
+		OutputDir: suitedir,
+		Reporters: reporters.Reporters{
+			reporters.NewBenchmarkReporter("benchmarks.json", "test", "1.0.0"),
+		},
+	}
+	suite := NewSuite(opts, Tests{
+		"bench": func(h *H) {
+			h.Run("sub", func(h *H) {
+				h.ReportMetric(reporters.Metric{Name: "speed", Value: 2, Unit: "MB/s"})
+			})
+		},
+	})
+
+	if err := suite.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := reporters.ReadBenchmarkReport(filepath.Join(suitedir, "reports", "benchmarks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []reporters.Benchmark{{
+		Name:    "bench/sub",
+		Result:  testresult.Pass,
+		Metrics: []reporters.Metric{{Name: "speed", Value: 2, Unit: "MB/s"}},
+	}}
+	if !reflect.DeepEqual(report.Benchmarks, expect) {
+		t.Errorf("%+v != %+v", report.Benchmarks, expect)
+	}
+}
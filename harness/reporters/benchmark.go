@@ -0,0 +1,161 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/mantle/harness/testresult"
+)
+
+// BenchmarkReport is the file written by a benchmark reporter. It is
+// indented and sorted so reports from two OS versions diff cleanly.
+type BenchmarkReport struct {
+	Platform   string                `json:"platform"`
+	Version    string                `json:"version"`
+	Result     testresult.TestResult `json:"result"`
+	Benchmarks []Benchmark           `json:"benchmarks"`
+}
+
+// Benchmark holds the metrics reported by one benchmark.
+type Benchmark struct {
+	Name    string                `json:"name"`
+	Result  testresult.TestResult `json:"result"`
+	Metrics []Metric              `json:"metrics"`
+}
+
+type benchmarkReporter struct {
+	report   BenchmarkReport
+	filename string
+
+	mu      sync.Mutex
+	metrics map[string][]Metric
+}
+
+// NewBenchmarkReporter returns a Reporter writing the metrics of each
+// test to filename as a BenchmarkReport.
+func NewBenchmarkReporter(filename, platform, version string) *benchmarkReporter {
+	return &benchmarkReporter{
+		report: BenchmarkReport{
+			Platform: platform,
+			Version:  version,
+		},
+		filename: filename,
+		metrics:  make(map[string][]Metric),
+	}
+}
+
+func (r *benchmarkReporter) ReportTest(name string, result testresult.TestResult, duration time.Duration, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// skip parents of subtests that measured nothing themselves
+	if len(r.metrics[name]) == 0 && result == testresult.Pass {
+		return
+	}
+	r.report.Benchmarks = append(r.report.Benchmarks, Benchmark{
+		Name:    name,
+		Result:  result,
+		Metrics: r.metrics[name],
+	})
+	delete(r.metrics, name)
+}
+
+func (r *benchmarkReporter) ReportMetric(name string, m Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics[name] = append(r.metrics[name], m)
+}
+
+func (r *benchmarkReporter) Output(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.Slice(r.report.Benchmarks, func(i, j int) bool {
+		return r.report.Benchmarks[i].Name < r.report.Benchmarks[j].Name
+	})
+	data, err := json.MarshalIndent(&r.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(path, r.filename), append(data, '\n'), 0644)
+}
+
+func (r *benchmarkReporter) SetResult(result testresult.TestResult) {
+	r.report.Result = result
+}
+
+// ReadBenchmarkReport reads a report written by a benchmark reporter.
+func ReadBenchmarkReport(path string) (*BenchmarkReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var report BenchmarkReport
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// MetricChange is the change of a metric between two reports.
+type MetricChange struct {
+	Benchmark string
+	Old, New  Metric
+}
+
+// Change returns the relative change of the metric, e.g. -0.1 if it
+// dropped by 10%.
+func (c MetricChange) Change() float64 {
+	if c.Old.Value == 0 {
+		return 0
+	}
+	return (c.New.Value - c.Old.Value) / c.Old.Value
+}
+
+// Improved reports whether the metric got better.
+func (c MetricChange) Improved() bool {
+	if c.New.LowerIsBetter {
+		return c.New.Value < c.Old.Value
+	}
+	return c.New.Value > c.Old.Value
+}
+
+// DiffBenchmarks returns the changes of the metrics found in both old
+// and new, in the order of new.
+func DiffBenchmarks(old, new *BenchmarkReport) []MetricChange {
+	oldMetrics := make(map[[2]string]Metric)
+	for _, b := range old.Benchmarks {
+		for _, m := range b.Metrics {
+			oldMetrics[[2]string{b.Name, m.Name}] = m
+		}
+	}
+
+	var ret []MetricChange
+	for _, b := range new.Benchmarks {
+		for _, m := range b.Metrics {
+			if o, ok := oldMetrics[[2]string{b.Name, m.Name}]; ok && o.Unit == m.Unit {
+				ret = append(ret, MetricChange{b.Name, o, m})
+			}
+		}
+	}
+	return ret
+}
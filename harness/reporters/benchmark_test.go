@@ -0,0 +1,75 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffBenchmarks(t *testing.T) {
+	old := &BenchmarkReport{
+		Benchmarks: []Benchmark{{
+			Name: "disk",
+			Metrics: []Metric{
+				{Name: "write", Value: 100, Unit: "MB/s"},
+				{Name: "gone", Value: 1, Unit: "ms"},
+			},
+		}, {
+			Name: "docker",
+			Metrics: []Metric{
+				{Name: "run", Value: 200, Unit: "ms", LowerIsBetter: true},
+			},
+		}},
+	}
+	new := &BenchmarkReport{
+		Benchmarks: []Benchmark{{
+			Name: "disk",
+			Metrics: []Metric{
+				{Name: "write", Value: 90, Unit: "MB/s"},
+				{Name: "added", Value: 1, Unit: "ms"},
+			},
+		}, {
+			Name: "docker",
+			Metrics: []Metric{
+				{Name: "run", Value: 150, Unit: "ms", LowerIsBetter: true},
+			},
+		}},
+	}
+
+	changes := DiffBenchmarks(old, new)
+	expect := []MetricChange{
+		{"disk", old.Benchmarks[0].Metrics[0], new.Benchmarks[0].Metrics[0]},
+		{"docker", old.Benchmarks[1].Metrics[0], new.Benchmarks[1].Metrics[0]},
+	}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Fatalf("%+v != %+v", changes, expect)
+	}
+
+	for i, c := range []struct {
+		change   float64
+		improved bool
+	}{
+		{-0.1, false},
+		{-0.25, true},
+	} {
+		if got := changes[i].Change(); got < c.change-1e-9 || got > c.change+1e-9 {
+			t.Errorf("%s: change %v != %v", changes[i].Benchmark, got, c.change)
+		}
+		if got := changes[i].Improved(); got != c.improved {
+			t.Errorf("%s: improved %v != %v", changes[i].Benchmark, got, c.improved)
+		}
+	}
+}
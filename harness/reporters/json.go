@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/coreos/mantle/harness/testresult"
@@ -28,6 +29,10 @@ type jsonReporter struct {
 	Result   testresult.TestResult `json:"result"`
 	filename string
 
+	mu       sync.Mutex
+	findings map[string][]Finding
+	metrics  map[string][]Metric
+
 	// Context variables
 	Platform string `json:"platform"`
 	Version  string `json:"version"`
@@ -38,6 +43,8 @@ type jsonTest struct {
 	Result   testresult.TestResult `json:"result"`
 	Duration time.Duration         `json:"duration"`
 	Output   string                `json:"output"`
+	Findings []Finding             `json:"findings,omitempty"`
+	Metrics  []Metric              `json:"metrics,omitempty"`
 }
 
 func NewJSONReporter(filename, platform, version string) *jsonReporter {
@@ -45,16 +52,36 @@ func NewJSONReporter(filename, platform, version string) *jsonReporter {
 		Platform: platform,
 		Version:  version,
 		filename: filename,
+		findings: make(map[string][]Finding),
+		metrics:  make(map[string][]Metric),
 	}
 }
 
 func (r *jsonReporter) ReportTest(name string, result testresult.TestResult, duration time.Duration, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.Tests = append(r.Tests, jsonTest{
 		Name:     name,
 		Result:   result,
 		Duration: duration,
 		Output:   string(b),
+		Findings: r.findings[name],
+		Metrics:  r.metrics[name],
 	})
+	delete(r.findings, name)
+	delete(r.metrics, name)
+}
+
+func (r *jsonReporter) ReportFinding(name string, f Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.findings[name] = append(r.findings[name], f)
+}
+
+func (r *jsonReporter) ReportMetric(name string, m Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics[name] = append(r.metrics[name], m)
 }
 
 func (r *jsonReporter) Output(path string) error {
@@ -44,8 +44,87 @@ func (reps Reporters) SetResult(s testresult.TestResult) {
 	}
 }
 
+// ReportRun notifies every Reporter implementing RunReporter that a test
+// has started.
+func (reps Reporters) ReportRun(name string) {
+	for _, r := range reps {
+		if rr, ok := r.(RunReporter); ok {
+			rr.ReportRun(name)
+		}
+	}
+}
+
+// ReportOutput passes output logged by a test to every Reporter
+// implementing OutputReporter.
+func (reps Reporters) ReportOutput(name string, b []byte) {
+	for _, r := range reps {
+		if or, ok := r.(OutputReporter); ok {
+			or.ReportOutput(name, b)
+		}
+	}
+}
+
+// ReportFinding passes a finding about a test to every Reporter
+// implementing FindingReporter.
+func (reps Reporters) ReportFinding(name string, f Finding) {
+	for _, r := range reps {
+		if fr, ok := r.(FindingReporter); ok {
+			fr.ReportFinding(name, f)
+		}
+	}
+}
+
+// ReportMetric passes a measurement made by a test to every Reporter
+// implementing MetricReporter.
+func (reps Reporters) ReportMetric(name string, m Metric) {
+	for _, r := range reps {
+		if mr, ok := r.(MetricReporter); ok {
+			mr.ReportMetric(name, m)
+		}
+	}
+}
+
 type Reporter interface {
 	ReportTest(string, testresult.TestResult, time.Duration, []byte)
 	Output(string) error
 	SetResult(testresult.TestResult)
 }
+
+// RunReporter is implemented by Reporters that want to know when each
+// test starts.
+type RunReporter interface {
+	ReportRun(string)
+}
+
+// OutputReporter is implemented by Reporters that want test output as it
+// is logged rather than when the test finishes.
+type OutputReporter interface {
+	ReportOutput(string, []byte)
+}
+
+// Finding is a problem noticed while running a test, such as badness in
+// a machine's logs, in addition to the test's own output.
+type Finding struct {
+	Check   string `json:"check"`             // what found it
+	Machine string `json:"machine,omitempty"` // where it was found
+	Message string `json:"message"`
+}
+
+// FindingReporter is implemented by Reporters that record findings.
+type FindingReporter interface {
+	ReportFinding(string, Finding)
+}
+
+// Metric is a measurement made by a test, such as a benchmark's
+// throughput.
+type Metric struct {
+	Name          string  `json:"name"`
+	Value         float64 `json:"value"`
+	Unit          string  `json:"unit"`                      // e.g. "MB/s" or "ms"
+	LowerIsBetter bool    `json:"lower_is_better,omitempty"` // e.g. for latencies
+}
+
+// MetricReporter is implemented by Reporters that record metrics.
+type MetricReporter interface {
+	ReportMetric(string, Metric)
+}
@@ -16,6 +16,7 @@
 package harness
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -74,6 +75,9 @@ type Options struct {
 	// Limit number of tests to run in parallel (0 means GOMAXPROCS).
 	Parallel int
 
+	// Parent of every test's Context, e.g. to give tests a deadline.
+	Context context.Context
+
 	Reporters reporters.Reporters
 }
 
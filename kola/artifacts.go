@@ -0,0 +1,136 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network/sftp"
+	"github.com/coreos/mantle/platform"
+)
+
+// artifactTimeout bounds the collection of each artifact, since the
+// machine may well be why the test failed.
+var artifactTimeout = 2 * time.Minute
+
+// DefaultArtifacts are collected from every machine of a failed test, in
+// addition to the test's own Artifacts.
+var DefaultArtifacts = []register.Artifact{
+	{Name: "ignition.json", Path: "/run/ignition.json"},
+	{Name: "var-log", Path: "/var/log"},
+	{Name: "systemctl-status.txt", Command: "sudo systemctl status --all --no-pager || true"},
+	{Name: "networkctl-status.txt", Command: "networkctl status --all --no-pager"},
+	{Name: "docker-ps.txt", Command: "if systemctl -q is-active docker; then sudo docker ps -a; fi"},
+	{Name: "rkt-list.txt", Command: "sudo rkt list --full"},
+	{Name: "dmesg.txt", Command: "sudo dmesg"},
+	// a sosreport-style snapshot of the machine's configuration
+	{Name: "sosreport.tar.gz", Command: "sudo tar -cz --ignore-failed-read -C / etc run/systemd run/metadata usr/share/coreos 2>/dev/null"},
+}
+
+// timeoutArtifacts are collected first from the machines of a test that
+// timed out, to show what they were stuck on.
+var timeoutArtifacts = []register.Artifact{
+	{Name: "jobs.txt", Command: "systemctl list-jobs --no-pager"},
+	{Name: "failed-units.txt", Command: "systemctl list-units --failed --no-pager"},
+	{Name: "processes.txt", Command: "ps -eo pid,ppid,stat,wchan:32,etime,args --forest"},
+	{Name: "journal.txt", Command: "journalctl --no-pager -b -n 1000"},
+}
+
+// artifactsFor returns the artifacts to collect from the machines of t
+// once it failed or timed out. A timeout's artifacts are collected even
+// with NoArtifacts, since they're often all there is to go on.
+func artifactsFor(t *register.Test, timedOut bool) []register.Artifact {
+	var artifacts []register.Artifact
+	if timedOut {
+		artifacts = append(artifacts, timeoutArtifacts...)
+	}
+	if !NoArtifacts {
+		artifacts = append(artifacts, DefaultArtifacts...)
+		artifacts = append(artifacts, t.Artifacts...)
+	}
+	return artifacts
+}
+
+// collectArtifacts saves artifacts from each machine in c to an artifacts
+// directory in a directory named after the machine in the test's output
+// directory.
+func collectArtifacts(h *harness.H, c platform.Cluster, artifacts []register.Artifact) {
+	if len(artifacts) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, m := range c.Machines() {
+		wg.Add(1)
+		go func(m platform.Machine) {
+			defer wg.Done()
+			dir := filepath.Join(h.OutputDir(), m.ID(), "artifacts")
+			if err := os.MkdirAll(dir, 0777); err != nil {
+				h.Logf("%s: %v", m.ID(), err)
+				return
+			}
+			for _, a := range artifacts {
+				ctx, cancel := context.WithTimeout(context.Background(), artifactTimeout)
+				err := collectArtifact(ctx, m, a, filepath.Join(dir, a.Name))
+				cancel()
+				if err == context.DeadlineExceeded {
+					// don't wait on a machine that isn't answering
+					h.Logf("%s: collecting %s: timed out after %v", m.ID(), a.Name, artifactTimeout)
+					return
+				} else if err != nil {
+					h.Logf("%s: collecting %s: %v", m.ID(), a.Name, err)
+				}
+			}
+			h.Logf("%s: artifacts saved in %s", m.ID(), dir)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// collectArtifact saves a from m to path, giving up when ctx is done.
+func collectArtifact(ctx context.Context, m platform.Machine, a register.Artifact, path string) error {
+	if a.Path != "" {
+		return platform.Download(ctx, m, a.Path, path, sftp.TransferOptions{})
+	}
+
+	var out, stderr bytes.Buffer
+	cmd, err := m.Start(ctx, a.Command, platform.ExecOptions{
+		Stdin:  bytes.NewReader(nil),
+		Stdout: &out,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return err
+	}
+	err = cmd.Wait()
+	if err != nil && err != ctx.Err() {
+		err = fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	// partial output is still worth keeping
+	if werr := ioutil.WriteFile(path, out.Bytes(), 0644); err == nil {
+		err = werr
+	}
+	return err
+}
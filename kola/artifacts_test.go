@@ -0,0 +1,99 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/platform"
+)
+
+// hungMachine is a platform.Machine that accepts SSH connections but
+// never answers on them.
+type hungMachine struct {
+	platform.Machine
+	dials int32
+}
+
+func (m *hungMachine) ID() string { return "hung" }
+
+func (m *hungMachine) SSHClient() (*ssh.Client, error) {
+	atomic.AddInt32(&m.dials, 1)
+	return mockssh.NewMockClient(func(s *mockssh.Session) {
+		io.Copy(ioutil.Discard, s.Stdin)
+		s.Close()
+	}), nil
+}
+
+func TestCollectArtifactsHungMachine(t *testing.T) {
+	defer func(timeout time.Duration) { artifactTimeout = timeout }(artifactTimeout)
+	artifactTimeout = 50 * time.Millisecond
+
+	m := &hungMachine{}
+	c := &fakeCluster{machines: []platform.Machine{m}}
+	test := &register.Test{Name: "test"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runH(t, func(h *harness.H) {
+			collectArtifacts(h, c, artifactsFor(test, false))
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("collectArtifacts ignored its timeout")
+	}
+	// the first default artifact is a download; nothing more is tried
+	// once it times out
+	if dials := atomic.LoadInt32(&m.dials); dials != 1 {
+		t.Errorf("connected to the machine %d times, expected 1", dials)
+	}
+}
+
+func TestArtifactsFor(t *testing.T) {
+	defer func(no bool) { NoArtifacts = no }(NoArtifacts)
+
+	extra := register.Artifact{Name: "etcd.txt", Command: "etcdctl member list"}
+	test := &register.Test{Name: "test", Artifacts: []register.Artifact{extra}}
+	failed := append(append([]register.Artifact{}, DefaultArtifacts...), extra)
+	for _, tt := range []struct {
+		name        string
+		timedOut    bool
+		noArtifacts bool
+		artifacts   []register.Artifact
+	}{
+		{name: "failed", artifacts: failed},
+		{name: "timed out", timedOut: true, artifacts: append(append([]register.Artifact{}, timeoutArtifacts...), failed...)},
+		{name: "failed without artifacts", noArtifacts: true},
+		{name: "timed out without artifacts", timedOut: true, noArtifacts: true, artifacts: timeoutArtifacts},
+	} {
+		NoArtifacts = tt.noArtifacts
+		if artifacts := artifactsFor(test, tt.timedOut); !reflect.DeepEqual(artifacts, tt.artifacts) {
+			t.Errorf("%s: collecting %v, expected %v", tt.name, artifacts, tt.artifacts)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/kola/register"
+)
+
+// RunBenchmarks runs the registered benchmarks matching a glob pattern
+// on a platform. They run one at a time, each on fresh machines, so they
+// don't compete for the host. Besides the usual report.json, the metrics
+// they report are written to reports/benchmarks.json in outputDir, which
+// can be compared with that of another OS version using
+// reporters.DiffBenchmarks. If outputDir already exists it will be
+// erased!
+func RunBenchmarks(pattern, pltfrm, outputDir string) error {
+	tests := make(map[string]*register.Test)
+	for name, b := range register.Benchmarks {
+		tests[name] = b.Test()
+	}
+	tests, err := filterTests(tests, pattern, pltfrm, semver.Version{})
+	if err != nil {
+		return err
+	}
+	if len(tests) == 0 {
+		return fmt.Errorf("no benchmarks match %q on %s", pattern, pltfrm)
+	}
+	if MaxInstances > 0 {
+		for _, test := range tests {
+			if test.ClusterSize > MaxInstances {
+				return fmt.Errorf("--max-instances %d leaves no room for the %d machines of %s", MaxInstances, test.ClusterSize, test.Name)
+			}
+		}
+	}
+
+	// results are only comparable knowing what they were measured on
+	plog.Info("Creating cluster to check semver...")
+	version, err := getClusterSemver(pltfrm, outputDir)
+	if err != nil {
+		return err
+	}
+
+	opts := harness.Options{
+		OutputDir: outputDir,
+		Parallel:  1,
+		Verbose:   true,
+		Reporters: reporters.Reporters{
+			reporters.NewJSONReporter("report.json", pltfrm, version.String()),
+			reporters.NewBenchmarkReporter("benchmarks.json", pltfrm, version.String()),
+		},
+	}
+	res := &testResources{
+		platform:  pltfrm,
+		outputDir: outputDir,
+		limit:     newInstanceLimit(MaxInstances),
+	}
+
+	var htests harness.Tests
+	for _, test := range tests {
+		test := test // for the closure
+		run := func(h *harness.H) {
+			runTest(h, test, pltfrm, res)
+		}
+		htests.Add(test.Name, run)
+	}
+
+	suite := harness.NewSuite(opts, htests)
+	err = suite.Run()
+
+	if err2 := res.Destroy(); err == nil && err2 != nil {
+		err = err2
+	}
+
+	if err != nil {
+		fmt.Printf("FAIL, output in %v\n", outputDir)
+	} else {
+		fmt.Printf("PASS, output in %v\n", outputDir)
+	}
+
+	return err
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bootperf measures how long Container Linux machines take to
+// boot and detects regressions against a baseline.
+package bootperf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/util"
+)
+
+// Boot holds the timings of one boot, in seconds.
+type Boot struct {
+	Firmware  float64 `json:"firmware,omitempty"`
+	Loader    float64 `json:"loader,omitempty"`
+	Kernel    float64 `json:"kernel"`
+	Initrd    float64 `json:"initrd"`
+	Userspace float64 `json:"userspace"`
+	Total     float64 `json:"total"`
+
+	// Units is the time each unit took to start.
+	Units map[string]float64 `json:"units"`
+
+	// CriticalChain is the chain of units the default target waited
+	// on, from the target down.
+	CriticalChain []ChainLink `json:"critical_chain"`
+}
+
+// ChainLink is a unit on the critical chain.
+type ChainLink struct {
+	Unit   string  `json:"unit"`
+	Active float64 `json:"active"`          // when it became active
+	Start  float64 `json:"start,omitempty"` // how long it took to start
+}
+
+// phases returns b's boot phases by name.
+func (b *Boot) phases() map[string]float64 {
+	return map[string]float64{
+		"kernel":    b.Kernel,
+		"initrd":    b.Initrd,
+		"userspace": b.Userspace,
+		"total":     b.Total,
+	}
+}
+
+// Collect waits for m to finish booting and returns its timings.
+func Collect(m platform.Machine) (*Boot, error) {
+	var b Boot
+	// systemd-analyze fails until the boot is finished
+	err := util.Retry(60, 5*time.Second, func() error {
+		out, stderr, err := m.SSH("systemd-analyze time")
+		if err != nil {
+			return fmt.Errorf("systemd-analyze time: %v: %s", err, stderr)
+		}
+		return ParseTime(string(out), &b)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, stderr, err := m.SSH("systemd-analyze blame --no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-analyze blame: %v: %s", err, stderr)
+	}
+	if b.Units, err = ParseBlame(string(out)); err != nil {
+		return nil, err
+	}
+
+	out, stderr, err = m.SSH("systemd-analyze critical-chain --no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-analyze critical-chain: %v: %s", err, stderr)
+	}
+	if b.CriticalChain, err = ParseCriticalChain(string(out)); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Stat summarizes a series of timings, in seconds.
+type Stat struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+func newStat(values []float64) Stat {
+	s := Stat{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	s.Min, s.Max = values[0], values[0]
+	for _, v := range values {
+		s.Mean += v
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+	}
+	s.Mean /= float64(s.N)
+	if s.N > 1 {
+		for _, v := range values {
+			s.StdDev += (v - s.Mean) * (v - s.Mean)
+		}
+		s.StdDev = math.Sqrt(s.StdDev / float64(s.N-1))
+	}
+	return s
+}
+
+// Results are the timings of a series of boots on one platform.
+type Results struct {
+	Platform string          `json:"platform"`
+	Version  string          `json:"version,omitempty"` // OS version booted
+	Boots    []Boot          `json:"boots"`
+	Phases   map[string]Stat `json:"phases"` // kernel, initrd, userspace and total
+	Units    map[string]Stat `json:"units"`
+}
+
+// Summarize fills in r's statistics from its boots. Units are only
+// summarized if they started in every boot.
+func (r *Results) Summarize() {
+	phases := make(map[string][]float64)
+	units := make(map[string][]float64)
+	for _, b := range r.Boots {
+		for name, d := range b.phases() {
+			phases[name] = append(phases[name], d)
+		}
+		for unit, d := range b.Units {
+			units[unit] = append(units[unit], d)
+		}
+	}
+
+	r.Phases = make(map[string]Stat)
+	for name, values := range phases {
+		r.Phases[name] = newStat(values)
+	}
+	r.Units = make(map[string]Stat)
+	for unit, values := range units {
+		if len(values) == len(r.Boots) {
+			r.Units[unit] = newStat(values)
+		}
+	}
+}
+
+// WriteFile writes r to path as JSON.
+func (r *Results) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadFile reads results written by WriteFile.
+func ReadFile(path string) (*Results, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Results
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if r.Phases == nil {
+		r.Summarize()
+	}
+	return &r, nil
+}
+
+// Thresholds decide how much slower than the baseline a timing may get.
+// A timing regresses only if its mean grows by more than all of them.
+type Thresholds struct {
+	// Relative is the allowed slowdown as a fraction of the
+	// baseline mean, e.g. 0.1 for 10%.
+	Relative float64
+	// Absolute is the allowed slowdown in seconds, so units taking
+	// milliseconds don't trip on noise.
+	Absolute float64
+	// Sigmas is the allowed slowdown in standard errors of the
+	// difference of the means, which accounts for how noisy the
+	// timing is on both sides.
+	Sigmas float64
+}
+
+// DefaultThresholds flag slowdowns of 10% and 0.5s that are three
+// standard errors out.
+var DefaultThresholds = Thresholds{
+	Relative: 0.1,
+	Absolute: 0.5,
+	Sigmas:   3,
+}
+
+// Regression is a timing that got slower than the thresholds allow.
+type Regression struct {
+	Name     string // boot phase, or unit
+	Baseline Stat
+	Current  Stat
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %.3fs ± %.3fs, was %.3fs ± %.3fs (+%.0f%%)",
+		r.Name, r.Current.Mean, r.Current.StdDev, r.Baseline.Mean, r.Baseline.StdDev,
+		100*(r.Current.Mean-r.Baseline.Mean)/r.Baseline.Mean)
+}
+
+// regressed reports whether cur is slower than base by more than t.
+func (t Thresholds) regressed(base, cur Stat) bool {
+	if base.N == 0 || cur.N == 0 {
+		return false
+	}
+	delta := cur.Mean - base.Mean
+	stderr := math.Sqrt(base.StdDev*base.StdDev/float64(base.N) + cur.StdDev*cur.StdDev/float64(cur.N))
+	return delta > t.Relative*base.Mean && delta > t.Absolute && delta > t.Sigmas*stderr
+}
+
+// Compare returns the boot phases and units of current that regressed
+// from baseline, sorted by name. Units missing from either side are
+// ignored.
+func Compare(baseline, current *Results, t Thresholds) ([]Regression, error) {
+	if baseline.Platform != current.Platform {
+		return nil, fmt.Errorf("baseline is for platform %q, not %q", baseline.Platform, current.Platform)
+	}
+
+	var ret []Regression
+	for name, cur := range current.Phases {
+		if base, ok := baseline.Phases[name]; ok && t.regressed(base, cur) {
+			ret = append(ret, Regression{name, base, cur})
+		}
+	}
+	for unit, cur := range current.Units {
+		if base, ok := baseline.Units[unit]; ok && t.regressed(base, cur) {
+			ret = append(ret, Regression{unit, base, cur})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		// phases first
+		iu, ju := strings.Contains(ret[i].Name, "."), strings.Contains(ret[j].Name, ".")
+		if iu != ju {
+			return ju
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
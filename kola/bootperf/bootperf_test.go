@@ -0,0 +1,111 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootperf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// results returns results of boots with the given total and
+// docker.service times.
+func results(totals, docker []float64) *Results {
+	r := &Results{Platform: "qemu"}
+	for i := range totals {
+		r.Boots = append(r.Boots, Boot{
+			Total: totals[i],
+			Units: map[string]float64{
+				"docker.service":  docker[i],
+				"tiny.service":    0.01 * float64(i+1),
+				"sometimes.mount": 1,
+			},
+		})
+	}
+	// a unit that didn't start in every boot
+	delete(r.Boots[0].Units, "sometimes.mount")
+	r.Summarize()
+	return r
+}
+
+func TestSummarize(t *testing.T) {
+	r := results([]float64{9, 10, 11}, []float64{1, 1, 1})
+	total := r.Phases["total"]
+	if total.N != 3 || !near(total.Mean, 10) || !near(total.StdDev, 1) || total.Min != 9 || total.Max != 11 {
+		t.Errorf("unexpected total %+v", total)
+	}
+	if _, ok := r.Units["sometimes.mount"]; ok {
+		t.Errorf("unit missing from a boot was summarized")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := results([]float64{10, 10.2, 9.8, 10.1, 9.9}, []float64{1, 1.1, 0.9, 1, 1})
+
+	// noise, and tiny.service tripling, aren't regressions
+	cur := results([]float64{10.3, 10.1, 9.9, 10.4, 10}, []float64{1.1, 1, 1, 0.9, 1})
+	cur.Boots[0].Units["tiny.service"] = 0.3
+	cur.Summarize()
+	regs, err := Compare(base, cur, DefaultThresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 0 {
+		t.Errorf("unexpected regressions %v", regs)
+	}
+
+	// docker.service taking 2s longer slows down the whole boot
+	cur = results([]float64{12, 12.3, 11.9, 12.1, 12.2}, []float64{3, 3.2, 2.9, 3, 3.1})
+	regs, err = Compare(base, cur, DefaultThresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 2 || regs[0].Name != "total" || regs[1].Name != "docker.service" {
+		t.Errorf("unexpected regressions %v", regs)
+	}
+
+	// too noisy to tell
+	cur = results([]float64{7, 17, 9, 15, 12}, []float64{1, 1, 1, 1, 1})
+	if regs, _ := Compare(base, cur, DefaultThresholds); len(regs) != 0 {
+		t.Errorf("unexpected regressions %v", regs)
+	}
+
+	cur.Platform = "aws"
+	if _, err := Compare(base, cur, DefaultThresholds); err == nil {
+		t.Errorf("compared results from different platforms")
+	}
+}
+
+func TestResultsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootperf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "boot.json")
+	r := results([]float64{9, 10, 11}, []float64{1, 2, 3})
+	if err := r.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(got.Boots) != 3 || got.Phases["total"] != r.Phases["total"] || got.Units["docker.service"] != r.Units["docker.service"] {
+		t.Errorf("read back %+v", got)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootperf
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spanUnits are the units of systemd's time spans, e.g. "1min 2.345s".
+var spanUnits = map[string]time.Duration{
+	"h":   time.Hour,
+	"min": time.Minute,
+	"s":   time.Second,
+	"ms":  time.Millisecond,
+	"us":  time.Microsecond,
+	"µs":  time.Microsecond,
+}
+
+var spanPart = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zµ]+)$`)
+
+// parseSpan parses a systemd time span into seconds.
+func parseSpan(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty time span")
+	}
+	var d float64
+	for _, f := range fields {
+		m := spanPart.FindStringSubmatch(f)
+		if m == nil {
+			return 0, fmt.Errorf("bad time span %q", s)
+		}
+		unit, ok := spanUnits[m[2]]
+		if !ok {
+			return 0, fmt.Errorf("bad unit in time span %q", s)
+		}
+		v, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		d += v * unit.Seconds()
+	}
+	return d, nil
+}
+
+var timePhase = regexp.MustCompile(`([0-9][^()+=]*?) \(([a-z]+)\)`)
+
+// ParseTime parses the output of systemd-analyze time, e.g.
+// "Startup finished in 1.2s (kernel) + 2.3s (initrd) + 4.5s (userspace) = 8s".
+func ParseTime(out string, b *Boot) error {
+	line := strings.SplitN(strings.TrimSpace(out), "\n", 2)[0]
+	i := strings.Index(line, "Startup finished in ")
+	j := strings.LastIndex(line, " = ")
+	if i < 0 || j < 0 {
+		return fmt.Errorf("unexpected systemd-analyze time output %q", line)
+	}
+
+	total, err := parseSpan(line[j+3:])
+	if err != nil {
+		return err
+	}
+	b.Total = total
+	for _, m := range timePhase.FindAllStringSubmatch(line[i:j], -1) {
+		d, err := parseSpan(m[1])
+		if err != nil {
+			return err
+		}
+		switch m[2] {
+		case "firmware":
+			b.Firmware = d
+		case "loader":
+			b.Loader = d
+		case "kernel":
+			b.Kernel = d
+		case "initrd":
+			b.Initrd = d
+		case "userspace":
+			b.Userspace = d
+		}
+	}
+	return nil
+}
+
+// ParseBlame parses the output of systemd-analyze blame into the time
+// each unit took to start.
+func ParseBlame(out string) (map[string]float64, error) {
+	units := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		unit := fields[len(fields)-1]
+		d, err := parseSpan(strings.Join(fields[:len(fields)-1], " "))
+		if err != nil {
+			return nil, err
+		}
+		units[unit] = d
+	}
+	return units, scanner.Err()
+}
+
+var chainLink = regexp.MustCompile(`([^\s└─│]+) @([^+]+?)(?: \+(.+))?$`)
+
+// ParseCriticalChain parses the output of systemd-analyze critical-chain,
+// from the default target down.
+func ParseCriticalChain(out string) ([]ChainLink, error) {
+	var chain []ChainLink
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		m := chainLink.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		link := ChainLink{Unit: m[1]}
+		var err error
+		if link.Active, err = parseSpan(m[2]); err != nil {
+			return nil, err
+		}
+		if m[3] != "" {
+			if link.Start, err = parseSpan(m[3]); err != nil {
+				return nil, err
+			}
+		}
+		chain = append(chain, link)
+	}
+	return chain, scanner.Err()
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootperf
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestParseSpan(t *testing.T) {
+	for s, want := range map[string]float64{
+		"1.234s":        1.234,
+		"123ms":         0.123,
+		"1min 2.5s":     62.5,
+		"1h 2min 3.04s": 3723.04,
+		"50us":          0.00005,
+		"7µs":           0.000007,
+	} {
+		got, err := parseSpan(s)
+		if err != nil || !near(got, want) {
+			t.Errorf("parseSpan(%q) = %v, %v; expected %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "1.2", "3 weeks", "s"} {
+		if _, err := parseSpan(s); err == nil {
+			t.Errorf("parseSpan(%q) succeeded", s)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	var b Boot
+	out := "Startup finished in 1.105s (kernel) + 2.563s (initrd) + 1min 4.302s (userspace) = 1min 7.971s\nmulti-user.target reached after 1min 4.281s in userspace\n"
+	if err := ParseTime(out, &b); err != nil {
+		t.Fatalf("ParseTime failed: %v", err)
+	}
+	if !near(b.Kernel, 1.105) || !near(b.Initrd, 2.563) || !near(b.Userspace, 64.302) || !near(b.Total, 67.971) {
+		t.Errorf("unexpected timings %+v", b)
+	}
+
+	out = "Startup finished in 3.1s (firmware) + 1.5s (loader) + 812ms (kernel) + 2.2s (userspace) = 7.612s\n"
+	if err := ParseTime(out, &b); err != nil {
+		t.Fatalf("ParseTime failed: %v", err)
+	}
+	if !near(b.Firmware, 3.1) || !near(b.Loader, 1.5) || !near(b.Kernel, 0.812) || !near(b.Total, 7.612) {
+		t.Errorf("unexpected timings %+v", b)
+	}
+
+	if err := ParseTime("Bootup is not yet finished.", &b); err == nil {
+		t.Errorf("ParseTime accepted an unfinished boot")
+	}
+}
+
+func TestParseBlame(t *testing.T) {
+	units, err := ParseBlame(`     1min 1.5s docker.service
+          2.017s coreos-metadata.service
+           130ms systemd-journald.service
+`)
+	if err != nil {
+		t.Fatalf("ParseBlame failed: %v", err)
+	}
+	if len(units) != 3 || !near(units["docker.service"], 61.5) || !near(units["systemd-journald.service"], 0.13) {
+		t.Errorf("unexpected units %v", units)
+	}
+}
+
+func TestParseCriticalChain(t *testing.T) {
+	chain, err := ParseCriticalChain(`The time when unit became active or started is printed after the "@" character.
+The time the unit took to start is printed after the "+" character.
+
+multi-user.target @4.302s
+└─docker.service @3.1s +1.2s
+  └─network.target @3.09s
+    └─systemd-networkd.service @2.5s +590ms
+`)
+	if err != nil {
+		t.Fatalf("ParseCriticalChain failed: %v", err)
+	}
+	want := []ChainLink{
+		{"multi-user.target", 4.302, 0},
+		{"docker.service", 3.1, 1.2},
+		{"network.target", 3.09, 0},
+		{"systemd-networkd.service", 2.5, 0.59},
+	}
+	if len(chain) != len(want) {
+		t.Fatalf("got chain %+v", chain)
+	}
+	for i := range want {
+		if chain[i].Unit != want[i].Unit || !near(chain[i].Active, want[i].Active) || !near(chain[i].Start, want[i].Start) {
+			t.Errorf("link %d is %+v, expected %+v", i, chain[i], want[i])
+		}
+	}
+}
@@ -17,11 +17,14 @@ package cluster
 import (
 	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/harness/testresult"
+	"github.com/coreos/mantle/kola/native"
+	"github.com/coreos/mantle/network/sftp"
 	"github.com/coreos/mantle/platform"
 )
 
@@ -40,10 +43,16 @@ func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
 	})
 }
 
-// RunNative runs a registered NativeFunc on a remote machine
+// RunNative runs a registered NativeFunc on a remote machine. kolet
+// reports the function's logs, subtests and result as native.Events,
+// which are replayed as subtests of the returned test.
 func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
-	command := fmt.Sprintf("./kolet run %q %q", t.Name(), funcName)
 	return t.Run(funcName, func(c TestCluster) {
+		command := fmt.Sprintf("./kolet run %q %q", t.Name(), funcName)
+		if deadline, ok := c.Context().Deadline(); ok {
+			command = fmt.Sprintf("./kolet run --timeout %s %q %q", time.Until(deadline), t.Name(), funcName)
+		}
+
 		client, err := m.SSHClient()
 		if err != nil {
 			c.Fatalf("kolet SSH client: %v", err)
@@ -56,14 +65,30 @@ func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
 		}
 		defer session.Close()
 
-		b, err := session.CombinedOutput(command)
-		b = bytes.TrimSpace(b)
+		var stderr bytes.Buffer
+		session.Stderr = &stderr
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			c.Fatalf("kolet SSH session: %v", err)
+		}
+
+		if err := session.Start(command); err != nil {
+			c.Fatalf("kolet: %v", err)
+		}
+		result, collectErr := native.Collect(stdout, funcName)
+		err = session.Wait()
+
+		b := bytes.TrimSpace(stderr.Bytes())
 		if len(b) > 0 {
-			t.Logf("kolet:\n%s", b)
+			c.Logf("kolet:\n%s", b)
 		}
-		if err != nil {
+		if collectErr != nil {
+			c.Fatalf("kolet: %v", collectErr)
+		}
+		if err != nil && result.Status != testresult.Fail {
 			c.Errorf("kolet: %v", err)
 		}
+		result.Replay(c.H)
 	})
 }
 
@@ -73,39 +98,54 @@ func (t *TestCluster) ListNativeFunctions() []string {
 	return t.NativeFuncs
 }
 
-// DropFile places file from localPath to ~/ on every machine in cluster
+// DropFile places the file or directory at localPath in ~/ on every
+// machine in the cluster, keeping its mode.
 func (t *TestCluster) DropFile(localPath string) error {
-	in, err := os.Open(localPath)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
 	for _, m := range t.Machines() {
-		if _, err := in.Seek(0, 0); err != nil {
-			return err
-		}
-		if err := platform.InstallFile(in, m, filepath.Base(localPath)); err != nil {
+		if err := platform.Upload(m, localPath, filepath.Base(localPath), sftp.TransferOptions{}); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// FetchFiles copies the file or directory tree remotePath on m to
+// localPath, keeping modes and modification times. The copy is cut off
+// if the test times out.
+func (t *TestCluster) FetchFiles(m platform.Machine, remotePath, localPath string) error {
+	return platform.Download(t.Context(), m, remotePath, localPath, sftp.TransferOptions{})
+}
+
 // SSH runs a ssh command on the given machine in the cluster. It differs from
 // Machine.SSH in that stderr is written to the test's output as a 'Log' line.
 // This ensures the output will be correctly accumulated under the correct
-// test.
+// test. The command is killed if it is still running when the test finishes.
 func (t *TestCluster) SSH(m platform.Machine, cmd string) ([]byte, error) {
-	stdout, stderr, err := m.SSH(cmd)
+	var stdout, stderr bytes.Buffer
+	c, err := t.Start(m, cmd, platform.ExecOptions{
+		Stdin:  bytes.NewReader(nil),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = c.Wait()
 
-	if len(stderr) > 0 {
-		for _, line := range strings.Split(string(stderr), "\n") {
+	if errBytes := bytes.TrimSpace(stderr.Bytes()); len(errBytes) > 0 {
+		for _, line := range strings.Split(string(errBytes), "\n") {
 			t.Log(line)
 		}
 	}
 
-	return stdout, err
+	return bytes.TrimSpace(stdout.Bytes()), err
+}
+
+// Start starts cmd on m with streaming I/O, e.g. to drive an interactive
+// tool with ExecOptions.PTY. The command is killed if it is still
+// running when the test finishes.
+func (t *TestCluster) Start(m platform.Machine, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return m.Start(t.Context(), cmd, opts)
 }
 
 // MustSSH runs a ssh command on the given machine in the cluster, writes
@@ -0,0 +1,276 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package external loads kola tests that are described by files on disk
+// rather than written in Go.
+//
+// An external test is a directory containing:
+//
+//	test.yaml or test.json  metadata, see Metadata
+//	config.yaml             optional Container Linux Config for the machines
+//	config.ign              optional Ignition config for the machines
+//	*.sh                    scripts run as root on every machine, in lexical order
+//
+// Each script is a subtest. The scripts see KOLA_MACHINE, the index of the
+// machine they run on, and KOLA_PRIVATE_IPS, the private IPs of all of the
+// test's machines separated by spaces.
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/yaml"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+// Metadata is the contents of an external test's test.yaml or test.json.
+type Metadata struct {
+	// Name defaults to "ext." followed by the name of the directory.
+	Name             string   `json:"name" yaml:"name"`
+	Description      string   `json:"description" yaml:"description"`
+	Owner            string   `json:"owner" yaml:"owner"`
+	Tags             []string `json:"tags" yaml:"tags"`
+	Platforms        []string `json:"platforms" yaml:"platforms"`
+	ExcludePlatforms []string `json:"exclude_platforms" yaml:"exclude_platforms"`
+	Architectures    []string `json:"architectures" yaml:"architectures"`
+	// ClusterSize defaults to 1.
+	ClusterSize int    `json:"cluster_size" yaml:"cluster_size"`
+	MinVersion  string `json:"min_version" yaml:"min_version"`
+	EndVersion  string `json:"end_version" yaml:"end_version"`
+	// Flags are the names of register.Flags, e.g. "no-enable-selinux".
+	Flags []string `json:"flags" yaml:"flags"`
+	// Timeout is a duration such as "10m".
+	Timeout string `json:"timeout" yaml:"timeout"`
+	// JournalAllow lists expected findings of kola's journal checks.
+	JournalAllow []register.JournalAllow `json:"journal_allow" yaml:"journal_allow"`
+	// Artifacts are collected from every machine if the test fails.
+	Artifacts []register.Artifact `json:"artifacts" yaml:"artifacts"`
+}
+
+// Register loads the external test in dir, or if dir has no metadata file,
+// each external test in its subdirectories, and registers them.
+func Register(dir string) error {
+	tests, err := Load(dir)
+	if err != nil {
+		return err
+	}
+	for _, t := range tests {
+		if _, ok := register.Tests[t.Name]; ok {
+			return fmt.Errorf("%s: test %v already registered", dir, t.Name)
+		}
+	}
+	for _, t := range tests {
+		register.Register(t)
+	}
+	return nil
+}
+
+// Load loads the external test in dir, or if dir has no metadata file,
+// each external test in its subdirectories.
+func Load(dir string) ([]*register.Test, error) {
+	if metadataPath(dir) != "" {
+		t, err := loadTest(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []*register.Test{t}, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var tests []*register.Test
+	for _, entry := range entries {
+		sub := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() || metadataPath(sub) == "" {
+			continue
+		}
+		t, err := loadTest(sub)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, t)
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("%s: no external tests found", dir)
+	}
+	return tests, nil
+}
+
+// metadataPath returns the path to dir's metadata file, or "" if it has
+// none.
+func metadataPath(dir string) string {
+	for _, name := range []string{"test.yaml", "test.json"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func loadTest(dir string) (*register.Test, error) {
+	path := metadataPath(dir)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta Metadata
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &meta)
+	} else {
+		err = yaml.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	t := &register.Test{
+		Name:             meta.Name,
+		Description:      meta.Description,
+		Owner:            meta.Owner,
+		Tags:             meta.Tags,
+		JournalAllow:     meta.JournalAllow,
+		Artifacts:        meta.Artifacts,
+		Platforms:        meta.Platforms,
+		ExcludePlatforms: meta.ExcludePlatforms,
+		Architectures:    meta.Architectures,
+		ClusterSize:      meta.ClusterSize,
+	}
+	if t.Name == "" {
+		t.Name = "ext." + filepath.Base(dir)
+	}
+	if t.ClusterSize == 0 {
+		t.ClusterSize = 1
+	}
+	if meta.MinVersion != "" {
+		v, err := semver.NewVersion(meta.MinVersion)
+		if err != nil {
+			return nil, fmt.Errorf("%s: min_version: %v", path, err)
+		}
+		t.MinVersion = *v
+	}
+	if meta.EndVersion != "" {
+		v, err := semver.NewVersion(meta.EndVersion)
+		if err != nil {
+			return nil, fmt.Errorf("%s: end_version: %v", path, err)
+		}
+		if !t.MinVersion.LessThan(*v) {
+			return nil, fmt.Errorf("%s: invalid version range", path)
+		}
+		t.EndVersion = *v
+	}
+	for _, name := range meta.Flags {
+		flag, err := register.ParseFlag(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		t.Flags = append(t.Flags, flag)
+	}
+	for _, a := range t.Artifacts {
+		if err := a.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if meta.Timeout != "" {
+		t.Timeout, err = time.ParseDuration(meta.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: timeout: %v", path, err)
+		}
+	}
+
+	t.UserData, err = loadUserData(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts, err := filepath.Glob(filepath.Join(dir, "*.sh"))
+	if err != nil {
+		return nil, err
+	}
+	if len(scripts) == 0 {
+		return nil, fmt.Errorf("%s: no scripts found", dir)
+	}
+	sort.Strings(scripts)
+	t.Run = func(c cluster.TestCluster) {
+		runScripts(c, scripts)
+	}
+
+	return t, nil
+}
+
+// loadUserData returns the test's config, or nil if it has none.
+func loadUserData(dir string) (*conf.UserData, error) {
+	var userdata *conf.UserData
+	for name, kind := range map[string]func(string) *conf.UserData{
+		"config.yaml": conf.ContainerLinuxConfig,
+		"config.ign":  conf.Ignition,
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if userdata != nil {
+			return nil, fmt.Errorf("%s: only one of config.yaml and config.ign may be given", dir)
+		}
+		userdata = kind(string(data))
+	}
+	return userdata, nil
+}
+
+func runScripts(c cluster.TestCluster, scripts []string) {
+	var ips []string
+	for _, m := range c.Machines() {
+		ips = append(ips, m.PrivateIP())
+	}
+
+	for _, script := range scripts {
+		if err := c.DropFile(script); err != nil {
+			c.Fatalf("dropping %s: %v", filepath.Base(script), err)
+		}
+	}
+
+	for _, script := range scripts {
+		name := filepath.Base(script)
+		ok := c.Run(strings.TrimSuffix(name, ".sh"), func(c cluster.TestCluster) {
+			for i, m := range c.Machines() {
+				cmd := fmt.Sprintf("sudo env KOLA_MACHINE=%d KOLA_PRIVATE_IPS=%q ./%s", i, strings.Join(ips, " "), name)
+				out, err := c.SSH(m, cmd)
+				if err != nil {
+					c.Errorf("%s failed on %s: %v\n%s", name, m.ID(), err, out)
+				} else if len(out) > 0 {
+					c.Logf("%s on %s:\n%s", name, m.ID(), out)
+				}
+			}
+		})
+		if !ok {
+			// later scripts may depend on this one
+			c.Fatalf("%s failed; not running later scripts", name)
+		}
+	}
+}
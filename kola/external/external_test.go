@@ -0,0 +1,110 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package external
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/mantle/kola/register"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"yaml/test.yaml": `
+platforms: [qemu]
+cluster_size: 3
+min_version: 1520.0.0
+flags: [no-emergency-shell-check]
+timeout: 5m
+artifacts: [{name: etcd.txt, command: etcdctl cluster-health}]
+`,
+		"yaml/config.yaml": "passwd: {}\n",
+		"yaml/10-first.sh": "#!/bin/bash\n",
+		"json/test.json":   `{"name": "custom.name", "exclude_platforms": ["aws"]}`,
+		"json/check.sh":    "#!/bin/bash\n",
+		"README":           "not a test\n",
+	})
+
+	tests, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 2 {
+		t.Fatalf("expected 2 tests, got %d", len(tests))
+	}
+
+	j, y := tests[0], tests[1]
+	if j.Name != "custom.name" || len(j.ExcludePlatforms) != 1 || j.ClusterSize != 1 || j.UserData != nil {
+		t.Errorf("unexpected json test: %+v", j)
+	}
+	if y.Name != "ext.yaml" || len(y.Platforms) != 1 || y.ClusterSize != 3 {
+		t.Errorf("unexpected yaml test: %+v", y)
+	}
+	if y.MinVersion.String() != "1520.0.0" || y.Timeout != 5*time.Minute {
+		t.Errorf("unexpected yaml test: %+v", y)
+	}
+	if !y.HasFlag(register.NoEmergencyShellCheck) {
+		t.Errorf("yaml test is missing its flag")
+	}
+	if len(y.Artifacts) != 1 || y.Artifacts[0].Command != "etcdctl cluster-health" {
+		t.Errorf("unexpected yaml test artifacts: %+v", y.Artifacts)
+	}
+	if y.UserData == nil || !y.UserData.Contains("passwd") {
+		t.Errorf("yaml test is missing its config")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"no scripts":   {"test.yaml": "{}\n"},
+		"bad flag":     {"test.yaml": "flags: [bogus]\n", "a.sh": ""},
+		"bad versions": {"test.yaml": "min_version: 2.0.0\nend_version: 1.0.0\n", "a.sh": ""},
+		"bad artifact": {"test.yaml": "artifacts: [{name: a/b, path: /etc}]\n", "a.sh": ""},
+		"two configs":  {"test.yaml": "{}\n", "a.sh": "", "config.yaml": "", "config.ign": ""},
+	} {
+		dir := tempDir(t)
+		writeFiles(t, dir, files)
+		if _, err := Load(dir); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		os.RemoveAll(dir)
+	}
+}
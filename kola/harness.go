@@ -18,11 +18,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-semver/semver"
@@ -34,12 +34,16 @@ import (
 	"github.com/coreos/mantle/kola/register"
 	"github.com/coreos/mantle/kola/torcx"
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/accounting"
 	awsapi "github.com/coreos/mantle/platform/api/aws"
+	azureapi "github.com/coreos/mantle/platform/api/azure"
 	doapi "github.com/coreos/mantle/platform/api/do"
 	esxapi "github.com/coreos/mantle/platform/api/esx"
 	gcloudapi "github.com/coreos/mantle/platform/api/gcloud"
 	packetapi "github.com/coreos/mantle/platform/api/packet"
+	"github.com/coreos/mantle/platform/api/throttle"
 	"github.com/coreos/mantle/platform/machine/aws"
+	"github.com/coreos/mantle/platform/machine/azure"
 	"github.com/coreos/mantle/platform/machine/do"
 	"github.com/coreos/mantle/platform/machine/esx"
 	"github.com/coreos/mantle/platform/machine/gcloud"
@@ -53,15 +57,23 @@ var (
 
 	Options       = platform.Options{}
 	AWSOptions    = awsapi.Options{Options: &Options}    // glue to set platform options from main
+	AzureOptions  = azureapi.Options{Options: &Options}  // glue to set platform options from main
 	DOOptions     = doapi.Options{Options: &Options}     // glue to set platform options from main
 	ESXOptions    = esxapi.Options{Options: &Options}    // glue to set platform options from main
 	GCEOptions    = gcloudapi.Options{Options: &Options} // glue to set platform options from main
 	PacketOptions = packetapi.Options{Options: &Options} // glue to set platform options from main
 	QEMUOptions   = qemu.Options{Options: &Options}      // glue to set platform options from main
 
-	TestParallelism   int    //glue var to set test parallelism from main
-	TAPFile           string // if not "", write TAP results here
-	TorcxManifestFile string // torcx manifest to expose to tests, if set
+	TestParallelism   int              //glue var to set test parallelism from main
+	DefaultTimeout    time.Duration    // glue var to set the timeout of tests without one from main
+	ShareClusters     bool             // glue var to let NonDestructive tests share clusters from main
+	PoolSize          int              // glue var to set the number of machines to keep booted from main
+	MaxInstances      int              // glue var to cap the number of machines running at once from main
+	JournalFormats    []string         // glue var to record journals in additional formats from main
+	NoArtifacts       bool             // glue var to skip collecting artifacts, except on timeout, from failed tests from main
+	TAPFile           string           // if not "", write TAP results here
+	Tags              register.TagExpr // if not nil, only run tests matching this expression
+	TorcxManifestFile string           // torcx manifest to expose to tests, if set
 	// TorcxManifest is the unmarshalled torcx manifest file. It is available for
 	// tests to access via `kola.TorcxManifest`. It will be nil if there was no
 	// manifest given to kola.
@@ -150,6 +162,8 @@ func NewCluster(pltfrm string, rconf *platform.RuntimeConfig) (cluster platform.
 	switch pltfrm {
 	case "aws":
 		cluster, err = aws.NewCluster(&AWSOptions, rconf)
+	case "azure":
+		cluster, err = azure.NewCluster(&AzureOptions, rconf)
 	case "do":
 		cluster, err = do.NewCluster(&DOOptions, rconf)
 	case "esx":
@@ -178,6 +192,10 @@ func filterTests(tests map[string]*register.Test, pattern, platform string, vers
 			continue
 		}
 
+		if !t.MatchTags(Tags) {
+			continue
+		}
+
 		// Check the test's min and end versions when running more than one test
 		if t.Name != pattern && versionOutsideRange(version, t.MinVersion, t.EndVersion) {
 			continue
@@ -303,11 +321,24 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 			reporters.NewJSONReporter("report.json", pltfrm, versionStr),
 		},
 	}
+	res := &testResources{
+		platform:  pltfrm,
+		outputDir: outputDir,
+		poolSize:  PoolSize,
+		limit:     newInstanceLimit(MaxInstances),
+	}
+	if ShareClusters {
+		res.shared = newClusterPool(pltfrm, outputDir, res.limit)
+	}
+	if err := res.checkLimit(tests); err != nil {
+		return err
+	}
+
 	var htests harness.Tests
 	for _, test := range tests {
 		test := test // for the closure
 		run := func(h *harness.H) {
-			runTest(h, test, pltfrm)
+			runTest(h, test, pltfrm, res)
 		}
 		htests.Add(test.Name, run)
 	}
@@ -315,6 +346,24 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 	suite := harness.NewSuite(opts, htests)
 	err = suite.Run()
 
+	if err2 := res.Destroy(); err == nil && err2 != nil {
+		err = err2
+	}
+
+	report, err2 := accounting.WriteFile(filepath.Join(outputDir, "resources.json"))
+	if err2 != nil {
+		plog.Errorf("Failed writing resource report: %v", err2)
+	} else {
+		plog.Infof("Estimated cost of cloud resources: $%.2f", report.TotalEstimatedCost)
+		if report.Leaked > 0 {
+			plog.Warningf("%d cloud resources were not cleaned up, see %v", report.Leaked, filepath.Join(outputDir, "resources.json"))
+		}
+	}
+
+	for name, stats := range throttle.AllStats() {
+		plog.Infof("%s API: %d requests, %d throttled, %d retried", name, stats.Requests, stats.Throttled, stats.Retries)
+	}
+
 	if TAPFile != "" {
 		src := filepath.Join(outputDir, "test.tap")
 		if err2 := system.CopyRegularFile(src, TAPFile); err == nil && err2 != nil {
@@ -367,55 +416,222 @@ func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
 	return version, nil
 }
 
-// runTest is a harness for running a single test.
-// outputDir is where various test logs and data will be written for
-// analysis after the test run. It should already exist.
-func runTest(h *harness.H, t *register.Test, pltfrm string) {
-	h.Parallel()
+// testResources are shared by the tests of a RunTests call.
+type testResources struct {
+	platform  string
+	outputDir string
+	poolSize  int
+	limit     *instanceLimit
+	shared    *clusterPool // nil unless ShareClusters is set
 
-	// don't go too fast, in case we're talking to a rate limiting api like AWS EC2.
-	// FIXME(marineam): API requests must do their own
-	// backoff due to rate limiting, this is unreliable.
-	max := int64(2 * time.Second)
-	splay := time.Duration(rand.Int63n(max))
-	time.Sleep(splay)
+	poolOnce sync.Once
+	pool     *machinePool // nil unless poolSize is set
+}
 
-	rconf := &platform.RuntimeConfig{
-		OutputDir:          h.OutputDir(),
-		NoSSHKeyInUserData: t.HasFlag(register.NoSSHKeyInUserData),
-		NoSSHKeyInMetadata: t.HasFlag(register.NoSSHKeyInMetadata),
-		NoEnableSelinux:    t.HasFlag(register.NoEnableSelinux),
+// machinePool returns the machine pool, starting it on first use since
+// the harness cleans the output directory when it starts.
+func (r *testResources) machinePool() *machinePool {
+	r.poolOnce.Do(func() {
+		if r.poolSize <= 0 {
+			return
+		}
+		pool, err := newMachinePool(r.platform, r.outputDir, r.poolSize, r.limit)
+		if err != nil {
+			plog.Errorf("Not using a machine pool: %v", err)
+			return
+		}
+		r.pool = pool
+	})
+	return r.pool
+}
+
+// checkLimit returns an error if the limit on running machines leaves no
+// room for the machines of one of tests. The machine pool holds its
+// machines, but idle shared clusters are evicted to make room.
+func (r *testResources) checkLimit(tests map[string]*register.Test) error {
+	if r.limit == nil {
+		return nil
 	}
-	c, err := NewCluster(pltfrm, rconf)
-	if err != nil {
-		h.Fatalf("Cluster failed: %v", err)
+	for _, test := range tests {
+		if r.poolSize+test.ClusterSize > r.limit.max {
+			return fmt.Errorf("--max-instances %d leaves no room for the %d machines of %s next to a pool of %d", r.limit.max, test.ClusterSize, test.Name, r.poolSize)
+		}
+	}
+	return nil
+}
+
+// Destroy tears down the shared clusters and the machine pool.
+func (r *testResources) Destroy() error {
+	// keep the pool from starting now if it never did
+	r.poolOnce.Do(func() {})
+	if r.pool != nil {
+		r.pool.Destroy()
 	}
+	if r.shared != nil {
+		return r.shared.Destroy()
+	}
+	return nil
+}
+
+// abandonTimeout is how long a test that timed out waits for its
+// goroutine to exit once its cluster has been torn down.
+const abandonTimeout = time.Minute
+
+// runTest runs t on a cluster of its own, on a shared cluster if t is
+// NonDestructive and ShareClusters is set, or with machines from the
+// machine pool if t can use them.
+func runTest(h *harness.H, t *register.Test, pltfrm string, res *testResources) {
+	h.Parallel()
+
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if timeout > 0 {
+		h.SetTimeout(timeout)
+	}
+
+	pool := res.machinePool()
+
+	var c platform.Cluster
+	// journals of shared machines are only checked from when this test
+	// got them
+	var journalSince time.Time
+	// closed when the test goroutine exits
+	done := make(chan struct{})
+	// teardown is deferred, but also run early if the test times out
+	var teardownOnce sync.Once
+	var teardown func()
 	defer func() {
-		c.Destroy()
-		for id, output := range c.ConsoleOutput() {
-			for _, badness := range CheckConsole([]byte(output), t) {
-				h.Errorf("Found %s on machine %s console", badness, id)
+		if teardown != nil {
+			teardownOnce.Do(teardown)
+		}
+	}()
+	if res.shared != nil && t.HasFlag(register.NonDestructive) {
+		sc := res.shared.Acquire(h, t)
+		c = sc
+		journalSince = time.Now()
+		teardown = func() {
+			select {
+			case <-done:
+				res.shared.Release(h, sc, false)
+			default:
+				// the test may still be running commands on sc
+				res.shared.Release(h, sc, true)
 			}
 		}
+	} else {
+		var err error
+		c, err = NewCluster(pltfrm, runtimeConfig(t, h.OutputDir()))
+		if err != nil {
+			h.Fatalf("Cluster failed: %v", err)
+		}
+		// pooled clusters release their machines' slots themselves
+		acquired := 0
+		if pool != nil && pool.Eligible(t) {
+			c = pool.Take(h, t, c)
+		} else {
+			if err := res.limit.Acquire(h.Context(), t.ClusterSize); err != nil {
+				c.Destroy()
+				h.Fatalf("Waiting to start machines: %v", err)
+			}
+			acquired = t.ClusterSize
+		}
+		teardown = func() {
+			c.Destroy()
+			res.limit.Release(acquired)
+			for id, output := range c.ConsoleOutput() {
+				for _, badness := range CheckConsole([]byte(output), t) {
+					h.Errorf("Found %s on machine %s console", badness, id)
+					h.ReportFinding(reporters.Finding{
+						Check:   "console",
+						Machine: id,
+						Message: badness,
+					})
+				}
+			}
+			for id, err := range c.HostKeyErrors() {
+				h.Errorf("Found SSH host key mismatch on machine %s: %v", id, err)
+				h.ReportFinding(reporters.Finding{
+					Check:   "host-key",
+					Machine: id,
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+
+	// Run the test in its own goroutine so a hung machine can't stall
+	// the whole run. FailNow and friends only exit that goroutine,
+	// which is enough: the test has been marked failed or skipped and
+	// we return as soon as it's done.
+	go func() {
+		defer close(done)
+		runCluster(h, t, c, pltfrm)
 	}()
 
-	if t.ClusterSize > 0 {
-		userdata := t.UserData
-		if userdata != nil && userdata.Contains("$discovery") {
-			url, err := c.GetDiscoveryURL(t.ClusterSize)
-			if err != nil {
-				// Skip instead of failing since the harness not being able to
-				// get a discovery url is likely an outage (e.g
-				// 503 Service Unavailable: Back-end server is at capacity)
-				// not a problem with the OS
-				h.Skipf("Failed to create discovery endpoint: %v", err)
-			}
-			userdata = userdata.Subst("$discovery", url)
+	select {
+	case <-done:
+		checkJournals(h, t, c, journalSince)
+		if h.Failed() {
+			collectArtifacts(h, c, artifactsFor(t, false))
 		}
+	case <-h.Context().Done():
+		h.Errorf("Test timed out after %v", timeout)
+		collectArtifacts(h, c, artifactsFor(t, true))
+		// Tearing down the cluster cuts off the test goroutine's SSH
+		// sessions. Give it a chance to notice before returning.
+		teardownOnce.Do(teardown)
+		select {
+		case <-done:
+		case <-time.After(abandonTimeout):
+			h.Logf("Abandoning test goroutine still running %v after teardown", abandonTimeout)
+		}
+		h.FailNow()
+	}
+}
+
+// runtimeConfig returns the configuration for t's cluster.
+func runtimeConfig(t *register.Test, outputDir string) *platform.RuntimeConfig {
+	return &platform.RuntimeConfig{
+		OutputDir:          outputDir,
+		NoSSHKeyInUserData: t.HasFlag(register.NoSSHKeyInUserData),
+		NoSSHKeyInMetadata: t.HasFlag(register.NoSSHKeyInMetadata),
+		NoEnableSelinux:    t.HasFlag(register.NoEnableSelinux),
+		JournalFormats:     JournalFormats,
+		SSHKeyTypes:        t.SSHKeyTypes,
+	}
+}
 
-		if _, err := platform.NewMachines(c, userdata, t.ClusterSize); err != nil {
-			h.Fatalf("Cluster failed starting machines: %v", err)
+// startMachines starts t's machines in c.
+func startMachines(h *harness.H, t *register.Test, c platform.Cluster) {
+	if t.ClusterSize == 0 {
+		return
+	}
+
+	userdata := t.UserData
+	if userdata != nil && userdata.Contains("$discovery") {
+		url, err := c.GetDiscoveryURL(t.ClusterSize)
+		if err != nil {
+			// Skip instead of failing since the harness not being able to
+			// get a discovery url is likely an outage (e.g
+			// 503 Service Unavailable: Back-end server is at capacity)
+			// not a problem with the OS
+			h.Skipf("Failed to create discovery endpoint: %v", err)
 		}
+		userdata = userdata.Subst("$discovery", url)
+	}
+
+	if _, err := platform.NewMachines(c, userdata, t.ClusterSize); err != nil {
+		h.Fatalf("Cluster failed starting machines: %v", err)
+	}
+}
+
+// runCluster starts the test's machines unless c is already running them,
+// and runs it.
+func runCluster(h *harness.H, t *register.Test, c platform.Cluster, pltfrm string) {
+	if len(c.Machines()) == 0 {
+		startMachines(h, t, c)
 	}
 
 	// pass along all registered native functions
@@ -423,6 +639,9 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 	for k := range t.NativeFuncs {
 		names = append(names, k)
 	}
+	for k := range t.NativeTests {
+		names = append(names, k)
+	}
 
 	// Cluster -> TestCluster
 	tcluster := cluster.TestCluster{
@@ -432,7 +651,7 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 	}
 
 	// drop kolet binary on machines
-	if t.NativeFuncs != nil {
+	if t.NativeFuncs != nil || t.NativeTests != nil {
 		scpKolet(tcluster, architecture(pltfrm))
 	}
 
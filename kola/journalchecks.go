@@ -0,0 +1,202 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/platform"
+)
+
+// journalCheck is a kind of badness to look for in machine journals.
+// Tests can allow findings with register.JournalAllow.
+type journalCheck struct {
+	name  string // for allow-lists
+	desc  string
+	match []journal.Matcher
+	// detail identifies what the finding is about, e.g. a unit
+	detail func(journal.Entry) string
+}
+
+var journalChecks = []journalCheck{
+	{
+		name:   "coredump",
+		desc:   "core dump",
+		match:  []journal.Matcher{journal.HasField(journal.FIELD_COREDUMP_UNIT)},
+		detail: fieldDetail(journal.FIELD_COREDUMP_UNIT),
+	},
+	{
+		name: "oom-kill",
+		desc: "OOM kill",
+		match: []journal.Matcher{
+			journal.Field(journal.FIELD_TRANSPORT, "kernel"),
+			journal.Message(oomKillMessage),
+		},
+		detail: messageDetail(oomKillMessage),
+	},
+	{
+		name: "segfault",
+		desc: "segfault",
+		match: []journal.Matcher{
+			journal.Field(journal.FIELD_TRANSPORT, "kernel"),
+			journal.Message(segfaultMessage),
+		},
+		detail: messageDetail(segfaultMessage),
+	},
+	{
+		name: "failed-unit",
+		desc: "failed unit",
+		match: []journal.Matcher{
+			journal.Identifier("systemd"),
+			journal.HasField(journal.FIELD_UNIT),
+			journal.Message(regexp.MustCompile(`Failed with result|entered failed state|^Failed to start `)),
+		},
+		detail: fieldDetail(journal.FIELD_UNIT),
+	},
+	{
+		// Denials in permissive mode are only logged, so they
+		// don't break anything.
+		name:   "selinux-avc",
+		desc:   "SELinux AVC denial",
+		match:  []journal.Matcher{journal.Message(avcMessage)},
+		detail: messageDetail(avcMessage),
+	},
+}
+
+var (
+	oomKillMessage  = regexp.MustCompile(`Out of memory: Kill(?:ed)? process \d+ \(([^)]*)\)`)
+	segfaultMessage = regexp.MustCompile(`^(\S+)\[\d+\]: segfault at`)
+	avcMessage      = regexp.MustCompile(`avc:\s+denied .* comm="([^"]*)" .*\bpermissive=0\b`)
+)
+
+func fieldDetail(field string) func(journal.Entry) string {
+	return func(e journal.Entry) string {
+		return string(e[field])
+	}
+}
+
+// messageDetail returns the first subexpression of re in the message.
+func messageDetail(re *regexp.Regexp) func(journal.Entry) string {
+	return func(e journal.Entry) string {
+		if match := re.FindSubmatch(e[journal.FIELD_MESSAGE]); len(match) > 1 {
+			return string(match[1])
+		}
+		return ""
+	}
+}
+
+// JournalFinding is badness found in a machine journal.
+type JournalFinding struct {
+	Check  string // name of the journal check
+	Desc   string
+	Detail string
+	Entry  journal.Entry
+}
+
+func (f JournalFinding) String() string {
+	if f.Detail == "" {
+		return f.Desc
+	}
+	return fmt.Sprintf("%s (%s)", f.Desc, f.Detail)
+}
+
+// CheckJournal checks the entries of a journal recorded since the given
+// time, or all of them if since is zero, for badness. If t is specified,
+// its JournalAllow list is respected. Each check reports a given detail
+// only once.
+func CheckJournal(j *platform.Journal, t *register.Test, since time.Time) ([]JournalFinding, error) {
+	var matchers []journal.Matcher
+	if !since.IsZero() {
+		matchers = append(matchers, journal.Since(since))
+	}
+	entries, err := j.Entries(matchers...)
+	if err != nil {
+		return nil, err
+	}
+
+	var allow []register.JournalAllow
+	var allowDetail []*regexp.Regexp
+	if t != nil {
+		for _, a := range t.JournalAllow {
+			re, err := regexp.Compile(a.Detail)
+			if err != nil {
+				return nil, fmt.Errorf("journal allow-list of %s: %v", t.Name, err)
+			}
+			allow = append(allow, a)
+			allowDetail = append(allowDetail, re)
+		}
+	}
+
+	var findings []JournalFinding
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+	checks:
+		for _, check := range journalChecks {
+			if !entry.Match(check.match...) {
+				continue
+			}
+			f := JournalFinding{
+				Check:  check.name,
+				Desc:   check.desc,
+				Detail: check.detail(entry),
+				Entry:  entry,
+			}
+			for i, a := range allow {
+				if a.Check == f.Check && allowDetail[i].MatchString(f.Detail) {
+					continue checks
+				}
+			}
+			if key := f.Check + "\x00" + f.Detail; !seen[key] {
+				seen[key] = true
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// checkJournals fails h for badness in the journals of c's machines
+// recorded since the given time. Tests that skipped themselves aren't
+// checked.
+func checkJournals(h *harness.H, t *register.Test, c platform.Cluster, since time.Time) {
+	if h.Skipped() {
+		return
+	}
+	for _, m := range c.Machines() {
+		j := m.Journal()
+		if j == nil {
+			continue
+		}
+		findings, err := CheckJournal(j, t, since)
+		if err != nil {
+			h.Errorf("Checking journal of machine %s: %v", m.ID(), err)
+			continue
+		}
+		for _, f := range findings {
+			h.Errorf("Found %s on machine %s journal: %s", f, m.ID(), f.Entry[journal.FIELD_MESSAGE])
+			h.ReportFinding(reporters.Finding{
+				Check:   "journal/" + f.Check,
+				Machine: m.ID(),
+				Message: f.String(),
+			})
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// Entries as exported by journalctl -o export on Container Linux.
+var (
+	coredumpEntry = exportEntry(1,
+		"COREDUMP_UNIT=docker.service",
+		"MESSAGE=Process 1234 (dockerd) of user 0 dumped core.")
+	oomKillEntry = exportEntry(2,
+		"_TRANSPORT=kernel",
+		"MESSAGE=Out of memory: Kill process 1234 (etcd) score 912 or sacrifice child")
+	oomKillEchoEntry = exportEntry(3,
+		"_TRANSPORT=stdout",
+		"MESSAGE=Out of memory: Kill process 1 (test) score 1 or sacrifice child")
+	segfaultEntry = exportEntry(4,
+		"_TRANSPORT=kernel",
+		"MESSAGE=locksmithd[812]: segfault at 0 ip 000000000045c3a1 sp 000000c42004dd58 error 4 in locksmithd[400000+5f9000]")
+	failedUnitEntry = exportEntry(5,
+		"SYSLOG_IDENTIFIER=systemd",
+		"UNIT=update-engine.service",
+		"MESSAGE=update-engine.service: Failed with result 'exit-code'.")
+	avcEnforcingEntry = exportEntry(6,
+		"_TRANSPORT=kernel",
+		`MESSAGE=audit: type=1400 audit(1519143127.461:4): avc:  denied  { read } for  pid=822 comm="dockerd" name="overlay2" dev="sda9" ino=12 scontext=system_u:system_r:container_runtime_t:s0 tcontext=system_u:object_r:var_lib_t:s0 tclass=dir permissive=0`)
+	avcPermissiveEntry = exportEntry(7,
+		"_TRANSPORT=kernel",
+		`MESSAGE=audit: type=1400 audit(1519143127.462:5): avc:  denied  { write } for  pid=901 comm="sshd" name="lastlog" dev="sda9" ino=34 scontext=system_u:system_r:sshd_t:s0 tcontext=system_u:object_r:var_log_t:s0 tclass=file permissive=1`)
+)
+
+// journalEpoch is the time of the first test entry.
+var journalEpoch = time.Unix(1519143127, 0)
+
+// exportEntry formats a journal entry logged seconds after journalEpoch
+// in the export format.
+func exportEntry(seconds int, fields ...string) string {
+	usec := journalEpoch.Add(time.Duration(seconds)*time.Second).UnixNano() / 1000
+	return fmt.Sprintf("__REALTIME_TIMESTAMP=%d\n%s\n\n", usec, strings.Join(fields, "\n"))
+}
+
+// recordedJournal returns a Journal in dir that has already recorded
+// the given export entries, as after a machine reboot.
+func recordedJournal(t *testing.T, dir string, export string) *platform.Journal {
+	f, err := os.Create(filepath.Join(dir, "journal-raw.txt.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := gzip.NewWriter(f)
+	if _, err := z.Write([]byte(export)); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := platform.NewJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestCheckJournal(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		export   string
+		allow    []register.JournalAllow
+		since    time.Time
+		findings []string // check:detail
+	}{
+		{name: "coredump", export: coredumpEntry, findings: []string{"coredump:docker.service"}},
+		{name: "oom-kill", export: oomKillEntry, findings: []string{"oom-kill:etcd"}},
+		{name: "oom-kill not from the kernel", export: oomKillEchoEntry},
+		{name: "segfault", export: segfaultEntry, findings: []string{"segfault:locksmithd"}},
+		{name: "failed-unit", export: failedUnitEntry, findings: []string{"failed-unit:update-engine.service"}},
+		{name: "enforcing AVC denial", export: avcEnforcingEntry, findings: []string{"selinux-avc:dockerd"}},
+		{name: "permissive AVC denial", export: avcPermissiveEntry},
+		{
+			name:     "reported once",
+			export:   failedUnitEntry + failedUnitEntry,
+			findings: []string{"failed-unit:update-engine.service"},
+		},
+		{
+			name:   "allowed detail",
+			export: failedUnitEntry,
+			allow:  []register.JournalAllow{{Check: "failed-unit", Detail: `^update-engine\.service$`}},
+		},
+		{
+			name:     "other detail allowed",
+			export:   failedUnitEntry,
+			allow:    []register.JournalAllow{{Check: "failed-unit", Detail: `^docker\.service$`}},
+			findings: []string{"failed-unit:update-engine.service"},
+		},
+		{
+			name:     "other check allowed",
+			export:   coredumpEntry + failedUnitEntry,
+			allow:    []register.JournalAllow{{Check: "coredump"}},
+			findings: []string{"failed-unit:update-engine.service"},
+		},
+		{
+			name:     "since",
+			export:   coredumpEntry + oomKillEntry + segfaultEntry,
+			since:    journalEpoch.Add(2 * time.Second),
+			findings: []string{"oom-kill:etcd", "segfault:locksmithd"},
+		},
+	} {
+		dir, err := ioutil.TempDir("", "kola")
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := recordedJournal(t, dir, tt.export)
+
+		test := &register.Test{Name: "test", JournalAllow: tt.allow}
+		findings, err := CheckJournal(j, test, tt.since)
+		j.Destroy()
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		var got []string
+		for _, f := range findings {
+			got = append(got, f.Check+":"+f.Detail)
+		}
+		if !reflect.DeepEqual(got, tt.findings) {
+			t.Errorf("%s: found %v, expected %v", tt.name, got, tt.findings)
+		}
+	}
+}
+
+func TestCheckJournalBadAllowList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kola")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	j := recordedJournal(t, dir, failedUnitEntry)
+	defer j.Destroy()
+
+	test := &register.Test{Name: "test", JournalAllow: []register.JournalAllow{{Check: "failed-unit", Detail: "("}}}
+	if _, err := CheckJournal(j, test, time.Time{}); err == nil {
+		t.Error("invalid allow-list was accepted")
+	}
+}
+
+// journalMachine is a platform.Machine that only has a journal.
+type journalMachine struct {
+	platform.Machine
+	journal *platform.Journal
+}
+
+func (m journalMachine) ID() string { return "m1" }
+
+func (m journalMachine) Journal() *platform.Journal { return m.journal }
+
+func TestCheckJournals(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		allow  []register.JournalAllow
+		skip   bool
+		passed bool
+	}{
+		{name: "found"},
+		{name: "allowed", allow: []register.JournalAllow{{Check: "failed-unit"}}, passed: true},
+		{name: "skipped", skip: true, passed: true},
+	} {
+		dir, err := ioutil.TempDir("", "kola")
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := recordedJournal(t, dir, failedUnitEntry)
+		c := &fakeCluster{machines: []platform.Machine{journalMachine{journal: j}}}
+		test := &register.Test{Name: "test", JournalAllow: tt.allow}
+
+		var skipped bool
+		passed := runH(t, func(h *harness.H) {
+			// Like runTest, check the journal once the test's
+			// goroutine is done.
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if tt.skip {
+					h.Skip("skipping")
+				}
+			}()
+			<-done
+			checkJournals(h, test, c, time.Time{})
+			skipped = h.Skipped()
+		})
+		j.Destroy()
+		os.RemoveAll(dir)
+
+		if passed != tt.passed {
+			t.Errorf("%s: passed %v, expected %v", tt.name, passed, tt.passed)
+		}
+		if skipped != tt.skip {
+			t.Errorf("%s: skipped %v, expected %v", tt.name, skipped, tt.skip)
+		}
+	}
+}
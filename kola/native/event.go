@@ -0,0 +1,80 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package native implements the protocol kolet uses to report the results
+// of native functions back to kola. kolet writes one JSON encoded Event
+// per line to stdout, in the spirit of `go tool test2json`; kola collects
+// them into a Result tree and replays it into the test harness.
+package native
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event actions.
+const (
+	ActionRun    = "run"    // the test has started running
+	ActionOutput = "output" // the test printed output
+	ActionPass   = "pass"   // the test passed
+	ActionFail   = "fail"   // the test failed
+	ActionSkip   = "skip"   // the test was skipped
+)
+
+// Event is a single line of kolet output.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Test    string    `json:"test"`              // full name, subtests separated by "/"
+	Elapsed float64   `json:"elapsed,omitempty"` // seconds, for pass, fail and skip
+	Output  string    `json:"output,omitempty"`
+}
+
+// Encoder writes Events. It is safe for concurrent use.
+type Encoder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{enc: json.NewEncoder(w)}
+}
+
+// Encode writes e, setting its Time if it is unset.
+func (e *Encoder) Encode(ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(&ev)
+}
+
+// Run reports that test has started.
+func (e *Encoder) Run(test string) error {
+	return e.Encode(Event{Action: ActionRun, Test: test})
+}
+
+// Output reports output printed by test.
+func (e *Encoder) Output(test, output string) error {
+	return e.Encode(Event{Action: ActionOutput, Test: test, Output: output})
+}
+
+// Done reports that test finished with the given action after elapsed.
+func (e *Encoder) Done(test, action string, elapsed time.Duration) error {
+	return e.Encode(Event{Action: action, Test: test, Elapsed: elapsed.Seconds()})
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/harness/testresult"
+)
+
+// Reporter is a harness reporter that streams test progress as Events.
+type Reporter struct {
+	enc *Encoder
+}
+
+func NewReporter(enc *Encoder) *Reporter {
+	return &Reporter{enc: enc}
+}
+
+func (r *Reporter) ReportRun(name string) {
+	r.enc.Run(name)
+}
+
+func (r *Reporter) ReportOutput(name string, b []byte) {
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		r.enc.Output(name, line)
+	}
+}
+
+// ReportTest reports the result of a test. Its output has already been
+// sent by ReportOutput.
+func (r *Reporter) ReportTest(name string, result testresult.TestResult, duration time.Duration, b []byte) {
+	r.enc.Done(name, strings.ToLower(string(result)), duration)
+}
+
+func (r *Reporter) Output(path string) error {
+	return nil
+}
+
+func (r *Reporter) SetResult(result testresult.TestResult) {}
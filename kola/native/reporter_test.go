@@ -0,0 +1,86 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/harness/testresult"
+)
+
+func TestReporterRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	suite := harness.NewSuite(harness.Options{
+		OutputDir: filepath.Join(dir, "_test"),
+		Parallel:  1,
+		Reporters: reporters.Reporters{NewReporter(NewEncoder(&buf))},
+	}, harness.Tests{
+		"Native": func(h *harness.H) {
+			h.Run("sub", func(h *harness.H) {
+				h.Skip("nothing to do")
+			})
+			h.Error("oops")
+		},
+	})
+	if err := suite.Run(); err == nil {
+		t.Fatal("suite unexpectedly passed")
+	}
+
+	result, err := Collect(&buf, "Native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != testresult.Fail {
+		t.Errorf("unexpected root status: %s", result.Status)
+	}
+	if len(result.Output) == 0 || !strings.Contains(result.Output[len(result.Output)-1], "oops") {
+		t.Errorf("unexpected root output: %q", result.Output)
+	}
+	if len(result.Subtests) != 1 {
+		t.Fatalf("unexpected subtests: %+v", result.Subtests)
+	}
+	if sub := result.Subtests[0]; sub.Name != "Native/sub" || sub.Status != testresult.Skip {
+		t.Errorf("unexpected subtest result: %+v", sub)
+	}
+}
+
+func TestReporterOutput(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(NewEncoder(&buf))
+	r.ReportOutput("Native", []byte("    native.go:12: units:\n        a.service\n\tb.service \n"))
+
+	result, err := Collect(&buf, "Native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"    native.go:12: units:", "        a.service", "\tb.service "}
+	if !reflect.DeepEqual(result.Output, expected) {
+		t.Errorf("collected output %q, expected %q", result.Output, expected)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/harness/testresult"
+)
+
+// Result is the outcome of a test run by kolet and of its subtests.
+type Result struct {
+	Name     string                // full test name
+	Status   testresult.TestResult // empty if the test never finished
+	Elapsed  time.Duration
+	Output   []string
+	Subtests []*Result
+}
+
+// Collect reads kolet's Events from r. Lines that aren't Events, such as
+// stray prints to stdout, are attributed to the innermost running test.
+// The returned Result is the root test named root.
+func Collect(r io.Reader, root string) (*Result, error) {
+	result := &Result{Name: root}
+	tests := map[string]*Result{root: result}
+	running := []*Result{result}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var ev Event
+		if !bytes.HasPrefix(line, []byte("{")) || json.Unmarshal(line, &ev) != nil || ev.Action == "" {
+			current := running[len(running)-1]
+			current.Output = append(current.Output, string(line))
+			continue
+		}
+
+		test, ok := tests[ev.Test]
+		if !ok {
+			test = &Result{Name: ev.Test}
+			tests[ev.Test] = test
+			parent := result
+			if i := strings.LastIndex(ev.Test, "/"); i >= 0 {
+				if p, ok := tests[ev.Test[:i]]; ok {
+					parent = p
+				}
+			}
+			parent.Subtests = append(parent.Subtests, test)
+		}
+
+		switch ev.Action {
+		case ActionRun:
+			running = append(running, test)
+		case ActionOutput:
+			test.Output = append(test.Output, strings.TrimSuffix(ev.Output, "\n"))
+		case ActionPass, ActionFail, ActionSkip:
+			test.Status = testresult.TestResult(strings.ToUpper(ev.Action))
+			test.Elapsed = time.Duration(ev.Elapsed * float64(time.Second))
+			for i := len(running) - 1; i > 0; i-- {
+				if running[i] == test {
+					running = append(running[:i], running[i+1:]...)
+					break
+				}
+			}
+		default:
+			return nil, fmt.Errorf("kolet: unknown action %q for %s", ev.Action, ev.Test)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Replay reports the result of r and its subtests through h, which
+// should be the test corresponding to r. Subtests are replayed as
+// subtests of h.
+func (r *Result) Replay(h *harness.H) {
+	for _, line := range r.Output {
+		h.Log(line)
+	}
+
+	for _, sub := range r.Subtests {
+		sub := sub
+		h.Run(strings.TrimPrefix(sub.Name, r.Name+"/"), func(h *harness.H) {
+			sub.Replay(h)
+		})
+	}
+
+	if r.Elapsed > 0 {
+		h.Logf("kolet: ran in %v", r.Elapsed)
+	}
+
+	switch r.Status {
+	case testresult.Fail:
+		h.Fail()
+	case testresult.Skip:
+		h.SkipNow()
+	case testresult.Pass:
+	default:
+		h.Errorf("kolet: %s did not finish", r.Name)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/mantle/harness/testresult"
+)
+
+func TestCollect(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Run("Native")
+	enc.Run("Native/sub")
+	enc.Output("Native/sub", "hello\n")
+	buf.WriteString("stray print\n")
+	enc.Done("Native/sub", ActionSkip, time.Second)
+	enc.Output("Native", "oops")
+	enc.Done("Native", ActionFail, 2*time.Second)
+
+	result, err := Collect(&buf, "Native")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Status != testresult.Fail || result.Elapsed != 2*time.Second {
+		t.Errorf("unexpected root result: %+v", result)
+	}
+	if len(result.Output) != 1 || result.Output[0] != "oops" {
+		t.Errorf("unexpected root output: %q", result.Output)
+	}
+	if len(result.Subtests) != 1 {
+		t.Fatalf("unexpected subtests: %+v", result.Subtests)
+	}
+
+	sub := result.Subtests[0]
+	if sub.Name != "Native/sub" || sub.Status != testresult.Skip || sub.Elapsed != time.Second {
+		t.Errorf("unexpected subtest result: %+v", sub)
+	}
+	if len(sub.Output) != 2 || sub.Output[0] != "hello" || sub.Output[1] != "stray print" {
+		t.Errorf("unexpected subtest output: %q", sub.Output)
+	}
+}
+
+func TestCollectUnfinished(t *testing.T) {
+	result, err := Collect(bytes.NewBufferString("panic: boom\n"), "Native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "" {
+		t.Errorf("unexpected status %q", result.Status)
+	}
+	if len(result.Output) != 1 || result.Output[0] != "panic: boom" {
+		t.Errorf("unexpected output: %q", result.Output)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// instanceLimit caps the number of machines kola starts at once. A nil
+// *instanceLimit is unlimited.
+type instanceLimit struct {
+	max   int
+	lock  chan struct{} // held while acquiring, so waiters don't deadlock on partial acquisitions
+	slots chan struct{}
+
+	// reclaim frees slots held by idle machines, such as those of idle
+	// shared clusters, and reports whether it freed any. It may be nil.
+	reclaim func() bool
+	waiting int32 // callers of Acquire waiting for a slot
+}
+
+func newInstanceLimit(max int) *instanceLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &instanceLimit{
+		max:   max,
+		lock:  make(chan struct{}, 1),
+		slots: make(chan struct{}, max),
+	}
+}
+
+// Acquire waits for n machines to be allowed to start. Idle machines are
+// reclaimed to make room for them.
+func (l *instanceLimit) Acquire(ctx context.Context, n int) error {
+	return l.acquire(ctx, n, true)
+}
+
+// AcquireSpare is like Acquire, but for machines that are only kept ready
+// in case they're needed. It waits for free slots rather than reclaiming
+// idle machines.
+func (l *instanceLimit) AcquireSpare(ctx context.Context, n int) error {
+	return l.acquire(ctx, n, false)
+}
+
+func (l *instanceLimit) acquire(ctx context.Context, n int, reclaim bool) error {
+	if l == nil || n == 0 {
+		return nil
+	}
+	if n > l.max {
+		return fmt.Errorf("%d machines exceed the limit of %d", n, l.max)
+	}
+
+	select {
+	case l.lock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.lock }()
+
+	for i := 0; i < n; i++ {
+		if err := l.acquireOne(ctx, reclaim); err != nil {
+			l.Release(i)
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *instanceLimit) acquireOne(ctx context.Context, reclaim bool) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if reclaim {
+		// Count as waiting before trying to reclaim, so that machines
+		// going idle afterwards see us and are freed instead.
+		atomic.AddInt32(&l.waiting, 1)
+		defer atomic.AddInt32(&l.waiting, -1)
+		for l.reclaim != nil {
+			select {
+			case l.slots <- struct{}{}:
+				return nil
+			default:
+			}
+			if !l.reclaim() {
+				break
+			}
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Waiting reports whether a caller of Acquire is waiting for machines to
+// be freed.
+func (l *instanceLimit) Waiting() bool {
+	return l != nil && atomic.LoadInt32(&l.waiting) > 0
+}
+
+// Release frees n machines acquired with Acquire.
+func (l *instanceLimit) Release(n int) {
+	if l == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-l.slots
+	}
+}
+
+// machinePoolFailures is how many times in a row a machinePool worker may
+// fail to create a machine before giving up.
+const machinePoolFailures = 3
+
+// machinePool keeps machines with the default userdata booted in the
+// background so tests that need such machines don't wait for them.
+type machinePool struct {
+	cluster platform.Cluster
+	limit   *instanceLimit
+	ready   chan platform.Machine // closed once every worker gave up
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// newMachinePool starts size workers that each keep one machine ready.
+// The machines' output is kept in outputDir/_pool.
+func newMachinePool(pltfrm, outputDir string, size int, limit *instanceLimit) (*machinePool, error) {
+	dir := filepath.Join(outputDir, "_pool")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	c, err := NewCluster(pltfrm, &platform.RuntimeConfig{
+		OutputDir:      dir,
+		JournalFormats: JournalFormats,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &machinePool{
+		cluster: c,
+		limit:   limit,
+		ready:   make(chan platform.Machine),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.worker()
+	}
+	go func() {
+		p.wg.Wait()
+		close(p.ready)
+	}()
+	return p, nil
+}
+
+func (p *machinePool) worker() {
+	defer p.wg.Done()
+	failures := 0
+	for failures < machinePoolFailures {
+		if err := p.limit.AcquireSpare(p.ctx, 1); err != nil {
+			return
+		}
+		m, err := p.cluster.NewMachine(nil)
+		if err != nil {
+			p.limit.Release(1)
+			failures++
+			plog.Warningf("Machine pool failed to create a machine: %v", err)
+			time.Sleep(time.Duration(failures) * 10 * time.Second)
+			continue
+		}
+		failures = 0
+
+		select {
+		case p.ready <- m:
+		case <-p.ctx.Done():
+			m.Destroy()
+			p.limit.Release(1)
+			return
+		}
+	}
+	plog.Errorf("Machine pool worker giving up after %d failures", machinePoolFailures)
+}
+
+// Eligible reports whether t can use machines from the pool.
+func (p *machinePool) Eligible(t *register.Test) bool {
+	return t.ClusterSize > 0 && t.UserData == nil && len(t.SSHKeyTypes) == 0 &&
+		!t.HasFlag(register.NoSSHKeyInUserData) &&
+		!t.HasFlag(register.NoSSHKeyInMetadata) &&
+		!t.HasFlag(register.NoEnableSelinux)
+}
+
+// Take returns a cluster running t.ClusterSize machines from the pool.
+// Machines the test creates itself are created in c, which the returned
+// cluster takes ownership of. If the pool has run dry, the remaining
+// machines are started in c.
+func (p *machinePool) Take(h *harness.H, t *register.Test, c platform.Cluster) platform.Cluster {
+	pc := &pooledCluster{Cluster: c, pool: p.cluster, limit: p.limit}
+	for len(pc.taken) < t.ClusterSize {
+		var m platform.Machine
+		var ok bool
+		select {
+		case m, ok = <-p.ready:
+		case <-h.Context().Done():
+			pc.Destroy()
+			h.Fatalf("Waiting for pooled machines: %v", h.Context().Err())
+		}
+		if !ok {
+			break
+		}
+		// the machine may have been idle for a while
+		if _, stderr, err := m.SSH("true"); err != nil {
+			h.Logf("Discarding pooled machine %s: %v: %s", m.ID(), err, stderr)
+			m.Destroy()
+			p.limit.Release(1)
+			continue
+		}
+		h.Logf("Using pooled machine %s", m.ID())
+		pc.taken = append(pc.taken, m)
+	}
+
+	if n := t.ClusterSize - len(pc.taken); n > 0 {
+		h.Logf("Machine pool is empty; starting %d machines", n)
+		if err := p.limit.Acquire(h.Context(), n); err != nil {
+			pc.Destroy()
+			h.Fatalf("Waiting to start machines: %v", err)
+		}
+		pc.started = n
+		if _, err := platform.NewMachines(c, nil, n); err != nil {
+			pc.Destroy()
+			h.Fatalf("Cluster failed starting machines: %v", err)
+		}
+	}
+	return pc
+}
+
+// Destroy stops refilling the pool and destroys its idle machines.
+func (p *machinePool) Destroy() {
+	p.cancel()
+	for m := range p.ready {
+		m.Destroy()
+		p.limit.Release(1)
+	}
+	p.cluster.Destroy()
+}
+
+// pooledCluster is a test's cluster holding machines from a machinePool.
+type pooledCluster struct {
+	platform.Cluster
+	pool    platform.Cluster // cluster the taken machines belong to
+	taken   []platform.Machine
+	started int // machines started in Cluster by Take
+	limit   *instanceLimit
+
+	mu          sync.Mutex
+	console     map[string]string
+	hostKeyErrs map[string]error
+}
+
+func (pc *pooledCluster) Machines() []platform.Machine {
+	return append(pc.Cluster.Machines(), pc.taken...)
+}
+
+func (pc *pooledCluster) Destroy() {
+	console := make(map[string]string)
+	for _, m := range pc.taken {
+		m.Destroy()
+		console[m.ID()] = m.ConsoleOutput()
+	}
+	hostKeyErrs := make(map[string]error)
+	if len(pc.taken) > 0 {
+		poolErrs := pc.pool.HostKeyErrors()
+		for _, m := range pc.taken {
+			if err, ok := poolErrs[m.ID()]; ok {
+				hostKeyErrs[m.ID()] = err
+			}
+		}
+	}
+	pc.limit.Release(len(pc.taken) + pc.started)
+	pc.Cluster.Destroy()
+
+	pc.mu.Lock()
+	pc.console = console
+	pc.hostKeyErrs = hostKeyErrs
+	pc.mu.Unlock()
+}
+
+func (pc *pooledCluster) ConsoleOutput() map[string]string {
+	output := make(map[string]string)
+	for id, console := range pc.Cluster.ConsoleOutput() {
+		output[id] = console
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for id, console := range pc.console {
+		output[id] = console
+	}
+	return output
+}
+
+func (pc *pooledCluster) HostKeyErrors() map[string]error {
+	errs := make(map[string]error)
+	for id, err := range pc.Cluster.HostKeyErrors() {
+		errs[id] = err
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for id, err := range pc.hostKeyErrs {
+		errs[id] = err
+	}
+	return errs
+}
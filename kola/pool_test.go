@@ -0,0 +1,161 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+)
+
+func TestInstanceLimit(t *testing.T) {
+	var unlimited *instanceLimit
+	if err := unlimited.Acquire(context.Background(), 100); err != nil {
+		t.Errorf("nil limit: %v", err)
+	}
+	unlimited.Release(100)
+
+	limit := newInstanceLimit(3)
+	if err := limit.Acquire(context.Background(), 4); err == nil {
+		t.Error("acquired more machines than the limit")
+	}
+	if err := limit.Acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// A partial acquisition is given back when the wait is abandoned.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limit.Acquire(ctx, 2); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if n := len(limit.slots); n != 2 {
+		t.Errorf("%d slots held, expected 2", n)
+	}
+
+	limit.Release(2)
+	if err := limit.Acquire(context.Background(), 3); err != nil {
+		t.Error(err)
+	}
+}
+
+// idleSharedCluster returns a pool holding an idle shared cluster that
+// fills limit.
+func idleSharedCluster(t *testing.T, limit *instanceLimit) (*clusterPool, *fakeCluster) {
+	p := newClusterPool("fake", "", limit)
+	if err := limit.Acquire(context.Background(), limit.max); err != nil {
+		t.Fatal(err)
+	}
+	fc := &fakeCluster{}
+	sc := &sharedCluster{Cluster: fc, size: limit.max, limit: limit}
+	runH(t, func(h *harness.H) {
+		p.Release(h, sc, false)
+	})
+	if len(p.idle) != 1 {
+		t.Fatalf("shared cluster didn't go idle")
+	}
+	return p, fc
+}
+
+func TestLimitEvictsIdleSharedClusters(t *testing.T) {
+	limit := newInstanceLimit(2)
+	p, fc := idleSharedCluster(t, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := limit.Acquire(ctx, 1); err != nil {
+		t.Fatalf("starved by an idle shared cluster: %v", err)
+	}
+	if fc.Destroyed() != 1 || len(p.idle) != 0 {
+		t.Errorf("idle shared cluster wasn't evicted")
+	}
+}
+
+func TestLimitSpareDoesNotEvict(t *testing.T) {
+	limit := newInstanceLimit(2)
+	p, fc := idleSharedCluster(t, limit)
+
+	// The machine pool keeps spare machines; refilling it isn't worth
+	// giving up a shared cluster for.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limit.AcquireSpare(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if fc.Destroyed() != 0 || len(p.idle) != 1 {
+		t.Errorf("idle shared cluster was evicted for a spare machine")
+	}
+}
+
+func TestReleaseSharedClusterToWaiter(t *testing.T) {
+	limit := newInstanceLimit(2)
+	p := newClusterPool("fake", "", limit)
+	if err := limit.Acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	fc := &fakeCluster{}
+	sc := &sharedCluster{Cluster: fc, size: 2, limit: limit}
+
+	// Another test starts waiting while the shared cluster is in use.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- limit.Acquire(ctx, 2)
+	}()
+	for !limit.Waiting() {
+		time.Sleep(time.Millisecond)
+	}
+
+	runH(t, func(h *harness.H) {
+		p.Release(h, sc, false)
+	})
+	if err := <-acquired; err != nil {
+		t.Fatalf("starved by a released shared cluster: %v", err)
+	}
+	if fc.Destroyed() != 1 || len(p.idle) != 0 {
+		t.Errorf("shared cluster went idle instead of making room")
+	}
+}
+
+func TestCheckLimit(t *testing.T) {
+	tests := map[string]*register.Test{
+		"small": {Name: "small", ClusterSize: 1},
+		"large": {Name: "large", ClusterSize: 3},
+	}
+	for _, tt := range []struct {
+		max      int
+		poolSize int
+		ok       bool
+	}{
+		{max: 0, poolSize: 10, ok: true},
+		{max: 3, ok: true},
+		{max: 2},
+		{max: 5, poolSize: 2, ok: true},
+		{max: 5, poolSize: 3},
+	} {
+		res := &testResources{
+			poolSize: tt.poolSize,
+			limit:    newInstanceLimit(tt.max),
+		}
+		if err := res.checkLimit(tests); (err == nil) != tt.ok {
+			t.Errorf("max %d, pool %d: got %v", tt.max, tt.poolSize, err)
+		}
+	}
+}
@@ -16,10 +16,14 @@ package register
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 
+	"github.com/coreos/mantle/harness"
 	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/network"
 	"github.com/coreos/mantle/platform/conf"
 )
 
@@ -30,16 +34,73 @@ const (
 	NoSSHKeyInMetadata                // don't add SSH key to platform metadata
 	NoEmergencyShellCheck             // don't check console output for emergency shell invocation
 	NoEnableSelinux                   // don't enable selinux when starting or rebooting a machine
+	NonDestructive                    // test leaves its machines fit for reuse by other tests
 )
 
+var flagNames = map[Flag]string{
+	NoSSHKeyInUserData:    "no-ssh-key-in-userdata",
+	NoSSHKeyInMetadata:    "no-ssh-key-in-metadata",
+	NoEmergencyShellCheck: "no-emergency-shell-check",
+	NoEnableSelinux:       "no-enable-selinux",
+	NonDestructive:        "non-destructive",
+}
+
+func (f Flag) String() string {
+	if name, ok := flagNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Flag(%d)", int(f))
+}
+
+// ParseFlag returns the Flag with the given name, as returned by
+// Flag.String.
+func ParseFlag(name string) (Flag, error) {
+	for f, n := range flagNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown flag %q", name)
+}
+
+// JournalAllow allows findings of one of kola's journal checks, e.g.
+// {Check: "failed-unit", Detail: `^docker\.service$`}.
+type JournalAllow struct {
+	Check  string `json:"check" yaml:"check"`   // name of the check
+	Detail string `json:"detail" yaml:"detail"` // regexp the finding's detail must match; empty matches any
+}
+
+// Artifact is a file, directory tree or command output collected from
+// each machine when a test fails, e.g.
+// {Name: "etcd.txt", Command: "etcdctl cluster-health"}.
+type Artifact struct {
+	Name    string `json:"name" yaml:"name"`                           // file or directory name to save it as
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`       // file or directory to download
+	Command string `json:"command,omitempty" yaml:"command,omitempty"` // command whose output is saved instead
+}
+
+// Validate checks that a has a plain name and exactly one source.
+func (a Artifact) Validate() error {
+	if a.Name == "" || a.Name == "." || a.Name == ".." || strings.Contains(a.Name, "/") {
+		return fmt.Errorf("artifact has invalid name %q", a.Name)
+	}
+	if (a.Path == "") == (a.Command == "") {
+		return fmt.Errorf("artifact %q needs exactly one of path and command", a.Name)
+	}
+	return nil
+}
+
 // Test provides the main test abstraction for kola. The run function is
 // the actual testing function while the other fields provide ways to
 // statically declare state of the platform.TestCluster before the test
 // function is run.
 type Test struct {
 	Name             string // should be unique
+	Description      string // what the test checks, for kola list
+	Owner            string // who to contact when the test breaks
 	Run              func(cluster.TestCluster)
 	NativeFuncs      map[string]func() error
+	NativeTests      map[string]harness.Test // like NativeFuncs, but run with a harness.H in kolet
 	UserData         *conf.UserData
 	ClusterSize      int
 	Platforms        []string // whitelist of platforms to run test against -- defaults to all
@@ -47,6 +108,26 @@ type Test struct {
 	Architectures    []string // whitelist of machine architectures supported -- defaults to all
 	Flags            []Flag   // special-case options for this test
 
+	// Tags group tests for selection with kola's --tags, e.g.
+	// "smoke", "network", "slow" or "requires-internet".
+	Tags []string
+
+	// SSHKeyTypes are the types of the keys kola authenticates with,
+	// instead of those chosen with kola's --ssh-key-type.
+	SSHKeyTypes []network.KeyType
+
+	// JournalAllow lists findings of kola's journal checks that are
+	// expected from this test and shouldn't fail it.
+	JournalAllow []JournalAllow
+
+	// Artifacts are collected from every machine if the test fails, in
+	// addition to kola's defaults.
+	Artifacts []Artifact
+
+	// Timeout is the maximum time the test may take, including
+	// starting its machines. Defaults to kola's --default-timeout.
+	Timeout time.Duration
+
 	// MinVersion prevents the test from executing on CoreOS machines
 	// less than MinVersion. This will be ignored if the name fully
 	// matches without globbing.
@@ -58,22 +139,34 @@ type Test struct {
 	EndVersion semver.Version
 }
 
+// DefaultTimeout is the default Timeout of tests that don't set one.
+const DefaultTimeout = 30 * time.Minute
+
 // Registered tests live here. Mapping of names to tests.
 var Tests = map[string]*Test{}
 
 // Register is usually called in init() functions and is how kola test
 // harnesses knows which tests it can choose from. Panics if existing
-// name is registered
+// name is registered as a test or benchmark.
 func Register(t *Test) {
 	_, ok := Tests[t.Name]
 	if ok {
 		panic(fmt.Sprintf("test %v already registered", t.Name))
 	}
+	if _, ok := Benchmarks[t.Name]; ok {
+		panic(fmt.Sprintf("test %v already registered as a benchmark", t.Name))
+	}
 
 	if (t.EndVersion != semver.Version{}) && !t.MinVersion.LessThan(t.EndVersion) {
 		panic(fmt.Sprintf("test %v has an invalid version range", t.Name))
 	}
 
+	for _, a := range t.Artifacts {
+		if err := a.Validate(); err != nil {
+			panic(fmt.Sprintf("test %v: %v", t.Name, err))
+		}
+	}
+
 	Tests[t.Name] = t
 }
 
@@ -85,3 +178,53 @@ func (t *Test) HasFlag(flag Flag) bool {
 	}
 	return false
 }
+
+// Benchmark measures the performance of Container Linux. It runs like a
+// Test, reporting its measurements with the harness's ReportMetric
+// instead of merely passing or failing, so results from different OS
+// versions can be compared.
+type Benchmark struct {
+	Name             string // should be unique
+	Description      string // what the benchmark measures, for kola list
+	Run              func(cluster.TestCluster)
+	UserData         *conf.UserData
+	ClusterSize      int
+	Platforms        []string // whitelist of platforms to run benchmark against -- defaults to all
+	ExcludePlatforms []string // blacklist of platforms to ignore -- defaults to none
+	Architectures    []string // whitelist of machine architectures supported -- defaults to all
+
+	// Timeout is the maximum time the benchmark may take, including
+	// starting its machines. Defaults to kola's --default-timeout.
+	Timeout time.Duration
+}
+
+// Registered benchmarks live here. Mapping of names to benchmarks.
+var Benchmarks = map[string]*Benchmark{}
+
+// RegisterBenchmark is like Register for benchmarks. Panics if the name
+// is already registered as a test or benchmark.
+func RegisterBenchmark(b *Benchmark) {
+	if _, ok := Benchmarks[b.Name]; ok {
+		panic(fmt.Sprintf("benchmark %v already registered", b.Name))
+	}
+	if _, ok := Tests[b.Name]; ok {
+		panic(fmt.Sprintf("benchmark %v already registered as a test", b.Name))
+	}
+
+	Benchmarks[b.Name] = b
+}
+
+// Test returns a Test running b, for use with kola's test machinery.
+func (b *Benchmark) Test() *Test {
+	return &Test{
+		Name:             b.Name,
+		Description:      b.Description,
+		Run:              b.Run,
+		UserData:         b.UserData,
+		ClusterSize:      b.ClusterSize,
+		Platforms:        b.Platforms,
+		ExcludePlatforms: b.ExcludePlatforms,
+		Architectures:    b.Architectures,
+		Timeout:          b.Timeout,
+	}
+}
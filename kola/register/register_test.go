@@ -0,0 +1,55 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"testing"
+)
+
+// registers reports whether fn registered without panicking.
+func registers(fn func()) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+func TestRegisterNameClashes(t *testing.T) {
+	defer func(tests map[string]*Test, benchmarks map[string]*Benchmark) {
+		Tests, Benchmarks = tests, benchmarks
+	}(Tests, Benchmarks)
+	Tests = map[string]*Test{}
+	Benchmarks = map[string]*Benchmark{}
+
+	for _, tt := range []struct {
+		name string
+		fn   func()
+		ok   bool
+	}{
+		{"test", func() { Register(&Test{Name: "a"}) }, true},
+		{"benchmark", func() { RegisterBenchmark(&Benchmark{Name: "b"}) }, true},
+		{"duplicate test", func() { Register(&Test{Name: "a"}) }, false},
+		{"duplicate benchmark", func() { RegisterBenchmark(&Benchmark{Name: "b"}) }, false},
+		{"benchmark named like a test", func() { RegisterBenchmark(&Benchmark{Name: "a"}) }, false},
+		{"test named like a benchmark", func() { Register(&Test{Name: "b"}) }, false},
+	} {
+		if ok := registers(tt.fn); ok != tt.ok {
+			t.Errorf("%s: registered %v, expected %v", tt.name, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TagExpr is a boolean expression over test tags, such as
+// "smoke && !slow". Tags may be combined with &&, || and ! and grouped
+// with parentheses; && binds tighter than ||.
+type TagExpr interface {
+	// Match reports whether a test with the given tags satisfies the
+	// expression.
+	Match(tags []string) bool
+}
+
+type tagExpr string
+type notExpr struct{ x TagExpr }
+type andExpr struct{ x, y TagExpr }
+type orExpr struct{ x, y TagExpr }
+
+func (e tagExpr) Match(tags []string) bool {
+	for _, tag := range tags {
+		if tag == string(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e notExpr) Match(tags []string) bool { return !e.x.Match(tags) }
+func (e andExpr) Match(tags []string) bool { return e.x.Match(tags) && e.y.Match(tags) }
+func (e orExpr) Match(tags []string) bool  { return e.x.Match(tags) || e.y.Match(tags) }
+
+// ParseTagExpr parses a tag expression.
+func ParseTagExpr(s string) (TagExpr, error) {
+	p := &tagParser{s: s}
+	p.next()
+	e, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("parsing tag expression %q: %v", s, err)
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("parsing tag expression %q: unexpected %q", s, p.tok)
+	}
+	return e, nil
+}
+
+// MatchTags reports whether the test's tags satisfy e. A nil e matches
+// every test.
+func (t *Test) MatchTags(e TagExpr) bool {
+	return e == nil || e.Match(t.Tags)
+}
+
+type tagParser struct {
+	s   string // remaining input
+	tok string // current token, or "" at the end of the input
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.", r)
+}
+
+// next advances to the next token.
+func (p *tagParser) next() {
+	p.s = strings.TrimLeftFunc(p.s, unicode.IsSpace)
+	n := strings.IndexFunc(p.s, func(r rune) bool { return !isTagRune(r) })
+	switch {
+	case p.s == "":
+		n = 0
+	case n == 0 && (strings.HasPrefix(p.s, "&&") || strings.HasPrefix(p.s, "||")):
+		n = 2
+	case n == 0:
+		n = 1
+	case n < 0:
+		n = len(p.s)
+	}
+	p.tok, p.s = p.s[:n], p.s[n:]
+}
+
+func (p *tagParser) or() (TagExpr, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "||" {
+		p.next()
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = orExpr{x, y}
+	}
+	return x, nil
+}
+
+func (p *tagParser) and() (TagExpr, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "&&" {
+		p.next()
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = andExpr{x, y}
+	}
+	return x, nil
+}
+
+func (p *tagParser) not() (TagExpr, error) {
+	switch tok := p.tok; {
+	case tok == "!":
+		p.next()
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	case tok == "(":
+		p.next()
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next()
+		return x, nil
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case strings.IndexFunc(tok, func(r rune) bool { return !isTagRune(r) }) < 0:
+		p.next()
+		return tagExpr(tok), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"testing"
+)
+
+func TestTagExpr(t *testing.T) {
+	tags := []string{"smoke", "network", "requires-internet"}
+	for _, tt := range []struct {
+		expr  string
+		match bool
+	}{
+		{"smoke", true},
+		{"slow", false},
+		{"!slow", true},
+		{"smoke && !slow", true},
+		{"smoke && slow", false},
+		{"slow || network", true},
+		{"slow || smoke && !network", false},
+		{"!(slow || network)", false},
+		{" ( slow||smoke )&&requires-internet ", true},
+		{"!!smoke", true},
+	} {
+		e, err := ParseTagExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if match := e.Match(tags); match != tt.match {
+			t.Errorf("%q: got %v, expected %v", tt.expr, match, tt.match)
+		}
+	}
+}
+
+func TestTagExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"smoke &&",
+		"smoke & slow",
+		"(smoke",
+		"smoke)",
+		"smoke slow",
+		"!",
+	} {
+		if _, err := ParseTagExpr(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+// sharedCluster is a cluster whose machines are reused by NonDestructive
+// tests with the same userdata, cluster size, flags and SSH key types.
+type sharedCluster struct {
+	platform.Cluster
+	dir         string
+	userdata    *conf.UserData
+	size        int
+	flags       []register.Flag
+	sshKeyTypes []network.KeyType
+	limit       *instanceLimit
+}
+
+// compatible reports whether t can run on sc.
+func (sc *sharedCluster) compatible(t *register.Test) bool {
+	if sc.size != t.ClusterSize || !sc.userdata.Equal(t.UserData) {
+		return false
+	}
+	if len(sc.flags) != len(t.Flags) || len(sc.sshKeyTypes) != len(t.SSHKeyTypes) {
+		return false
+	}
+	// the machines only accept keys of the types they were created with
+	for i, keyType := range sc.sshKeyTypes {
+		if t.SSHKeyTypes[i] != keyType {
+			return false
+		}
+	}
+	for _, f := range sc.flags {
+		if !t.HasFlag(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// reset checks that each machine is still reachable and clears any failed
+// units left behind by the previous test.
+func (sc *sharedCluster) reset() error {
+	machines := sc.Machines()
+	if len(machines) != sc.size {
+		return fmt.Errorf("expected %d machines, found %d", sc.size, len(machines))
+	}
+	for _, m := range machines {
+		if _, stderr, err := m.SSH("sudo systemctl reset-failed"); err != nil {
+			return fmt.Errorf("machine %s: %v: %s", m.ID(), err, stderr)
+		}
+	}
+	return nil
+}
+
+// destroy tears down sc and returns descriptions of any badness found on
+// its machines' consoles, including SSH host keys that don't match them.
+func (sc *sharedCluster) destroy() []string {
+	sc.Destroy()
+	sc.limit.Release(sc.size)
+	var badnesses []string
+	t := &register.Test{Flags: sc.flags}
+	for id, output := range sc.ConsoleOutput() {
+		for _, badness := range CheckConsole([]byte(output), t) {
+			badnesses = append(badnesses, fmt.Sprintf("%s on machine %s console", badness, id))
+		}
+	}
+	for id, err := range sc.HostKeyErrors() {
+		badnesses = append(badnesses, fmt.Sprintf("SSH host key mismatch on machine %s: %v", id, err))
+	}
+	return badnesses
+}
+
+// clusterPool holds idle shared clusters between tests.
+type clusterPool struct {
+	platform  string
+	outputDir string
+	limit     *instanceLimit
+
+	mu      sync.Mutex
+	idle    []*sharedCluster
+	created int
+	badness []string // found on the consoles of destroyed clusters
+}
+
+// newClusterPool returns a pool whose idle clusters are evicted when
+// machines of other tests are waiting on limit.
+func newClusterPool(pltfrm, outputDir string, limit *instanceLimit) *clusterPool {
+	p := &clusterPool{
+		platform:  pltfrm,
+		outputDir: outputDir,
+		limit:     limit,
+	}
+	if limit != nil {
+		limit.reclaim = p.evict
+	}
+	return p
+}
+
+// take removes and returns an idle cluster compatible with t, or nil.
+func (p *clusterPool) take(t *register.Test) *sharedCluster {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, sc := range p.idle {
+		if sc.compatible(t) {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return sc
+		}
+	}
+	return nil
+}
+
+// evict destroys the least recently used idle cluster, freeing its
+// machines for other tests. It reports whether there was one.
+func (p *clusterPool) evict() bool {
+	p.mu.Lock()
+	if len(p.idle) == 0 {
+		p.mu.Unlock()
+		return false
+	}
+	sc := p.idle[0]
+	p.idle = p.idle[1:]
+	p.mu.Unlock()
+
+	plog.Infof("Evicting idle shared cluster in %s to make room for other tests", sc.dir)
+	p.discard(sc)
+	return true
+}
+
+// discard destroys sc, remembering any console badness for Destroy.
+func (p *clusterPool) discard(sc *sharedCluster) {
+	badness := sc.destroy()
+	p.mu.Lock()
+	p.badness = append(p.badness, badness...)
+	p.mu.Unlock()
+}
+
+// Acquire returns a healthy cluster for t with its machines running,
+// reusing an idle one if possible.
+func (p *clusterPool) Acquire(h *harness.H, t *register.Test) *sharedCluster {
+	for sc := p.take(t); sc != nil; sc = p.take(t) {
+		if err := sc.reset(); err != nil {
+			h.Logf("Discarding shared cluster in %s: %v", sc.dir, err)
+			p.discard(sc)
+			continue
+		}
+		h.Logf("Reusing shared cluster in %s", sc.dir)
+		return sc
+	}
+
+	p.mu.Lock()
+	p.created++
+	dir := filepath.Join(p.outputDir, "_shared", strconv.Itoa(p.created))
+	p.mu.Unlock()
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		h.Fatalf("Cluster failed: %v", err)
+	}
+
+	if err := p.limit.Acquire(h.Context(), t.ClusterSize); err != nil {
+		h.Fatalf("Waiting to start machines: %v", err)
+	}
+	c, err := NewCluster(p.platform, runtimeConfig(t, dir))
+	if err != nil {
+		p.limit.Release(t.ClusterSize)
+		h.Fatalf("Cluster failed: %v", err)
+	}
+	sc := &sharedCluster{
+		Cluster:     c,
+		dir:         dir,
+		userdata:    t.UserData,
+		size:        t.ClusterSize,
+		flags:       t.Flags,
+		sshKeyTypes: t.SSHKeyTypes,
+		limit:       p.limit,
+	}
+	// don't leak the cluster if h.FailNow or h.SkipNow is called
+	started := false
+	defer func() {
+		if !started {
+			p.discard(sc)
+		}
+	}()
+	startMachines(h, t, c)
+	started = true
+
+	h.Logf("Created shared cluster in %s", dir)
+	return sc
+}
+
+// Release returns sc to the pool once h is done with it. Clusters of
+// failed tests are destroyed since their state is suspect, as are those
+// still busy with a test goroutine that hasn't exited.
+func (p *clusterPool) Release(h *harness.H, sc *sharedCluster, busy bool) {
+	if busy {
+		h.Logf("Discarding shared cluster in %s still in use by the test", sc.dir)
+	}
+	if h.Failed() || busy {
+		for _, badness := range sc.destroy() {
+			h.Errorf("Found %s", badness)
+		}
+		return
+	}
+	// Check for waiters with the lock held, so that an Acquire that
+	// started waiting after this either sees sc in idle or is seen.
+	p.mu.Lock()
+	if p.limit.Waiting() {
+		p.mu.Unlock()
+		h.Logf("Destroying shared cluster in %s to make room for other tests", sc.dir)
+		p.discard(sc)
+		return
+	}
+	p.idle = append(p.idle, sc)
+	p.mu.Unlock()
+}
+
+// Destroy tears down every idle cluster. It returns an error if any
+// console badness was found on shared clusters outside of a failed test.
+func (p *clusterPool) Destroy() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, sc := range idle {
+		p.discard(sc)
+	}
+	if len(p.badness) > 0 {
+		for _, badness := range p.badness {
+			plog.Errorf("Found %s", badness)
+		}
+		return fmt.Errorf("found badness on the consoles of shared clusters")
+	}
+	return nil
+}
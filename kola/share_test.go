@@ -0,0 +1,175 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+// fakeCluster is a platform.Cluster of the given machines that records
+// whether it was destroyed.
+type fakeCluster struct {
+	mu          sync.Mutex
+	destroyed   int
+	machines    []platform.Machine
+	hostKeyErrs map[string]error
+}
+
+func (fc *fakeCluster) Platform() platform.Name { return "fake" }
+
+func (fc *fakeCluster) NewMachine(*conf.UserData) (platform.Machine, error) { return nil, nil }
+
+func (fc *fakeCluster) Machines() []platform.Machine { return fc.machines }
+
+func (fc *fakeCluster) GetDiscoveryURL(int) (string, error) { return "", nil }
+
+func (fc *fakeCluster) ConsoleOutput() map[string]string { return nil }
+
+func (fc *fakeCluster) HostKeyErrors() map[string]error { return fc.hostKeyErrs }
+
+func (fc *fakeCluster) Destroy() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.destroyed++
+}
+
+func (fc *fakeCluster) Destroyed() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.destroyed
+}
+
+// runH runs fn as the only test of a suite and reports whether it
+// passed.
+func runH(t *testing.T, fn func(h *harness.H)) bool {
+	dir, err := ioutil.TempDir("", "kola")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	suite := harness.NewSuite(harness.Options{
+		OutputDir: filepath.Join(dir, "_test"),
+		Parallel:  1,
+	}, harness.Tests{"test": fn})
+	return suite.Run() == nil
+}
+
+func TestClusterPoolRelease(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fail   bool
+		busy   bool
+		reused bool
+	}{
+		{name: "passed", reused: true},
+		{name: "failed", fail: true},
+		{name: "busy", busy: true},
+	} {
+		limit := newInstanceLimit(4)
+		if err := limit.Acquire(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		fc := &fakeCluster{}
+		sc := &sharedCluster{Cluster: fc, size: 1, limit: limit}
+		p := newClusterPool("fake", "", limit)
+		test := &register.Test{ClusterSize: 1}
+
+		runH(t, func(h *harness.H) {
+			if tt.fail {
+				h.Error("failed")
+			}
+			p.Release(h, sc, tt.busy)
+		})
+
+		reused := p.take(test) == sc
+		if reused != tt.reused {
+			t.Errorf("%s: reused %v, expected %v", tt.name, reused, tt.reused)
+		}
+		if destroyed := fc.Destroyed() > 0; destroyed == tt.reused {
+			t.Errorf("%s: destroyed %v, expected %v", tt.name, destroyed, !tt.reused)
+		}
+		if !tt.reused && len(limit.slots) != 0 {
+			t.Errorf("%s: destroyed cluster still holds %d slots", tt.name, len(limit.slots))
+		}
+	}
+}
+
+func TestSharedClusterCompatible(t *testing.T) {
+	sc := &sharedCluster{size: 1, flags: []register.Flag{register.NoEnableSelinux}}
+	for _, tt := range []struct {
+		name       string
+		test       *register.Test
+		compatible bool
+	}{
+		{
+			name:       "same",
+			test:       &register.Test{ClusterSize: 1, Flags: []register.Flag{register.NoEnableSelinux}},
+			compatible: true,
+		},
+		{
+			name: "size",
+			test: &register.Test{ClusterSize: 2, Flags: []register.Flag{register.NoEnableSelinux}},
+		},
+		{
+			name: "flags",
+			test: &register.Test{ClusterSize: 1},
+		},
+		{
+			name: "userdata",
+			test: &register.Test{ClusterSize: 1, Flags: []register.Flag{register.NoEnableSelinux}, UserData: conf.Ignition(`{}`)},
+		},
+		{
+			name: "ssh key types",
+			test: &register.Test{
+				ClusterSize: 1,
+				Flags:       []register.Flag{register.NoEnableSelinux},
+				SSHKeyTypes: []network.KeyType{network.KeyEd25519},
+			},
+		},
+	} {
+		if compatible := sc.compatible(tt.test); compatible != tt.compatible {
+			t.Errorf("%s: compatible %v, expected %v", tt.name, compatible, tt.compatible)
+		}
+	}
+
+	sc.sshKeyTypes = []network.KeyType{network.KeyEd25519, network.KeyRSA}
+	for _, keyTypes := range [][]network.KeyType{
+		nil,
+		{network.KeyRSA},
+		{network.KeyEd25519, network.KeyECDSA},
+	} {
+		test := &register.Test{ClusterSize: 1, Flags: sc.flags, SSHKeyTypes: keyTypes}
+		if sc.compatible(test) {
+			t.Errorf("cluster with keys %v is compatible with %v", sc.sshKeyTypes, keyTypes)
+		}
+	}
+	test := &register.Test{ClusterSize: 1, Flags: sc.flags, SSHKeyTypes: []network.KeyType{network.KeyEd25519, network.KeyRSA}}
+	if !sc.compatible(test) {
+		t.Errorf("cluster isn't compatible with its own key types")
+	}
+}
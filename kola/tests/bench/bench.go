@@ -0,0 +1,92 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench contains kola's benchmarks, which measure the
+// performance of Container Linux rather than test its behavior.
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/harness/reporters"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
+)
+
+// timeCommand runs cmd on m n times, after an untimed run to warm up
+// caches, and returns how long each run took in milliseconds.
+func timeCommand(c cluster.TestCluster, m platform.Machine, cmd string, n int) []float64 {
+	script := fmt.Sprintf(`set -e
+%[1]s >/dev/null
+for i in $(seq %[2]d); do
+	start=$(date +%%s%%N)
+	%[1]s >/dev/null
+	end=$(date +%%s%%N)
+	echo $(( (end - start) / 1000 ))
+done`, cmd, n)
+
+	out := c.MustSSH(m, script)
+	var ret []float64
+	for _, line := range strings.Fields(string(out)) {
+		us, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			c.Fatalf("parsing timing of %q: %v", cmd, err)
+		}
+		ret = append(ret, us/1000)
+	}
+	if len(ret) != n {
+		c.Fatalf("expected %d timings of %q, got %d", n, cmd, len(ret))
+	}
+	return ret
+}
+
+// reportLatency reports the median and maximum of latencies in
+// milliseconds as the metrics name-median and name-max.
+func reportLatency(c cluster.TestCluster, name string, latencies []float64) {
+	sorted := append([]float64(nil), latencies...)
+	sort.Float64s(sorted)
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	max := sorted[len(sorted)-1]
+
+	c.Logf("%s: median %.1fms, max %.1fms over %d runs", name, median, max, len(sorted))
+	reportDuration(c, name+"-median", median)
+	reportDuration(c, name+"-max", max)
+}
+
+// reportDuration reports a duration in milliseconds as the metric name.
+func reportDuration(c cluster.TestCluster, name string, ms float64) {
+	c.ReportMetric(reporters.Metric{
+		Name:          name,
+		Value:         ms,
+		Unit:          "ms",
+		LowerIsBetter: true,
+	})
+}
+
+// reportThroughput reports a throughput in MB/s as the metric name.
+func reportThroughput(c cluster.TestCluster, name string, mbps float64) {
+	c.Logf("%s: %.1f MB/s", name, mbps)
+	c.ReportMetric(reporters.Metric{
+		Name:  name,
+		Value: mbps,
+		Unit:  "MB/s",
+	})
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	tutil "github.com/coreos/mantle/kola/tests/util"
+)
+
+func init() {
+	register.RegisterBenchmark(&register.Benchmark{
+		Name:        "bench.docker.start",
+		Description: "Latency of running a minimal docker container.",
+		Run:         dockerStart,
+		ClusterSize: 1,
+	})
+	register.RegisterBenchmark(&register.Benchmark{
+		Name:        "bench.rkt.start",
+		Description: "Latency of running a minimal rkt pod.",
+		Run:         rktStart,
+		ClusterSize: 1,
+	})
+}
+
+func dockerStart(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	tutil.GenDockerContainer(c, m, "echo", []string{"echo"})
+	reportLatency(c, "run", timeCommand(c, m, "sudo docker run --rm echo echo", 20))
+}
+
+func rktStart(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	// TODO this should not be necessary, but is at the time of writing
+	c.MustSSH(m, "sudo setenforce 0")
+
+	tutil.CreateTestAci(c, m, "test.rkt.aci", []string{"echo"})
+	reportLatency(c, "run", timeCommand(c, m, "sudo rkt run test.rkt.aci:latest --exec=echo -- hi", 20))
+	c.MustSSH(m, "sudo rkt gc --grace-period=0")
+}
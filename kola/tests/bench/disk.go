@@ -0,0 +1,64 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+)
+
+// dd's summary, e.g. "1073741824 bytes (1.1 GB, 1.0 GiB) copied, 2.5 s, 430 MB/s"
+var ddSummary = regexp.MustCompile(`(\d+) bytes .*copied, ([0-9.]+) s`)
+
+func init() {
+	register.RegisterBenchmark(&register.Benchmark{
+		Name:        "bench.disk",
+		Description: "Sequential throughput of the root filesystem with direct I/O.",
+		Run:         diskThroughput,
+		ClusterSize: 1,
+	})
+}
+
+// fio isn't part of Container Linux, so measure with dd, bypassing the
+// page cache.
+func diskThroughput(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	defer c.SSH(m, "sudo rm -f /var/tmp/bench.img")
+
+	dd := func(cmd string) float64 {
+		out := c.MustSSH(m, cmd+" 2>&1")
+		match := ddSummary.FindSubmatch(out)
+		if match == nil {
+			c.Fatalf("couldn't parse dd output: %s", out)
+		}
+		bytes, err := strconv.ParseFloat(string(match[1]), 64)
+		if err != nil {
+			c.Fatal(err)
+		}
+		secs, err := strconv.ParseFloat(string(match[2]), 64)
+		if err != nil || secs <= 0 {
+			c.Fatalf("couldn't parse dd duration %q", match[2])
+		}
+		return bytes / secs / 1e6
+	}
+
+	const count = 1024 // MiB
+	reportThroughput(c, "seq-write", dd(fmt.Sprintf("sudo dd if=/dev/zero of=/var/tmp/bench.img bs=1M count=%d oflag=direct conv=fsync", count)))
+	reportThroughput(c, "seq-read", dd("sudo dd if=/var/tmp/bench.img of=/dev/null bs=1M iflag=direct"))
+}
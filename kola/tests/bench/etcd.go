@@ -0,0 +1,66 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/kola/tests/etcd"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+func init() {
+	register.RegisterBenchmark(&register.Benchmark{
+		Name:        "bench.etcd.write",
+		Description: "Latency of writing keys to a single member etcd cluster.",
+		Run:         etcdWrite,
+		ClusterSize: 1,
+		// etcd-member fetches etcd from the internet
+		ExcludePlatforms: []string{"qemu"},
+		UserData: conf.ContainerLinuxConfig(`
+systemd:
+  units:
+    - name: etcd-member.service
+      enable: true`),
+	})
+}
+
+func etcdWrite(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	if err := etcd.GetClusterHealth(c, m, 1); err != nil {
+		c.Fatalf("etcd never became healthy: %v", err)
+	}
+
+	// time the requests with curl rather than timeCommand, which
+	// would include starting curl
+	out := c.MustSSH(m, `set -e
+for i in $(seq 100); do
+	curl -sf -o /dev/null -w '%{time_total}\n' -XPUT http://127.0.0.1:2379/v2/keys/bench/$i -d value=$i
+done`)
+
+	var latencies []float64
+	for _, line := range strings.Fields(string(out)) {
+		secs, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			c.Fatalf("parsing curl timing: %v", err)
+		}
+		latencies = append(latencies, secs*1000)
+	}
+	reportLatency(c, "put", latencies)
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/util"
+)
+
+// ping's summary, e.g. "rtt min/avg/max/mdev = 0.211/0.305/0.412/0.061 ms"
+var pingSummary = regexp.MustCompile(`= ([0-9.]+)/([0-9.]+)/([0-9.]+)/[0-9.]+ ms`)
+
+func init() {
+	register.RegisterBenchmark(&register.Benchmark{
+		Name:        "bench.network",
+		Description: "TCP throughput and round trip time between two machines.",
+		Run:         networkPerformance,
+		ClusterSize: 2,
+	})
+}
+
+// iperf isn't part of Container Linux, so measure throughput with ncat.
+func networkPerformance(c cluster.TestCluster) {
+	machines := c.Machines()
+	src, dest := machines[0], machines[1]
+
+	c.Run("throughput", func(c cluster.TestCluster) {
+		const size = 1 << 30
+
+		c.MustSSH(dest, "sudo systemd-run --unit=bench-ncat sh -c 'ncat --recv-only --listen 9988 >/dev/null'")
+		defer c.SSH(dest, "sudo systemctl stop bench-ncat")
+		if err := util.Retry(50, 100*time.Millisecond, func() error {
+			_, err := c.SSH(dest, "ss -tln | grep -q :9988")
+			return err
+		}); err != nil {
+			c.Fatalf("ncat didn't start listening: %v", err)
+		}
+
+		out := c.MustSSH(src, fmt.Sprintf(`set -e
+start=$(date +%%s%%N)
+head -c %d /dev/zero | ncat --send-only %s 9988
+end=$(date +%%s%%N)
+echo $(( (end - start) / 1000 ))`, size, dest.PrivateIP()))
+		us, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+		if err != nil || us <= 0 {
+			c.Fatalf("couldn't parse transfer time %q", out)
+		}
+		reportThroughput(c, "tcp-throughput", size/us)
+	})
+
+	c.Run("latency", func(c cluster.TestCluster) {
+		out := c.MustSSH(src, fmt.Sprintf("ping -q -c 50 -i 0.2 %s", dest.PrivateIP()))
+		match := pingSummary.FindSubmatch(out)
+		if match == nil {
+			c.Fatalf("couldn't parse ping output: %s", out)
+		}
+		for i, name := range []string{"rtt-min", "rtt-avg", "rtt-max"} {
+			ms, err := strconv.ParseFloat(string(match[i+1]), 64)
+			if err != nil {
+				c.Fatal(err)
+			}
+			c.Logf("%s: %.3fms", name, ms)
+			reportDuration(c, name, ms)
+		}
+	})
+}
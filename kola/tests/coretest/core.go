@@ -28,8 +28,10 @@ const (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.basic",
+		Description: "Checks the basic state of a freshly booted machine.",
 		Run:         LocalTests,
 		ClusterSize: 1,
+		Tags:        []string{"smoke"},
 		NativeFuncs: map[string]func() error{
 			"CloudConfig":      TestCloudinitCloudConfig,
 			"Script":           TestCloudinitScript,
@@ -91,6 +93,7 @@ func init() {
 		Run:              InternetTests,
 		ClusterSize:      1,
 		ExcludePlatforms: []string{"qemu"},
+		Tags:             []string{"network", "requires-internet"},
 		NativeFuncs: map[string]func() error{
 			"UpdateEngine": TestUpdateEngine,
 			"DockerPing":   TestDockerPing,
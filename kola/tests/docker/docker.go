@@ -29,6 +29,7 @@ import (
 
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
+	tutil "github.com/coreos/mantle/kola/tests/util"
 	"github.com/coreos/mantle/lang/worker"
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/conf"
@@ -203,16 +204,6 @@ systemd:
 	})
 }
 
-// make a docker container out of binaries on the host
-func genDockerContainer(c cluster.TestCluster, m platform.Machine, name string, binnames []string) {
-	cmd := `tmpdir=$(mktemp -d); cd $tmpdir; echo -e "FROM scratch\nCOPY . /" > Dockerfile;
-	        b=$(which %s); libs=$(sudo ldd $b | grep -o /lib'[^ ]*' | sort -u);
-	        sudo rsync -av --relative --copy-links $b $libs ./;
-	        sudo docker build -t %s .`
-
-	c.MustSSH(m, fmt.Sprintf(cmd, strings.Join(binnames, " "), name))
-}
-
 func dockerBaseTests(c cluster.TestCluster) {
 	c.Run("docker-info", func(c cluster.TestCluster) {
 		testDockerInfo("overlay", c)
@@ -230,7 +221,7 @@ func dockerBaseTests(c cluster.TestCluster) {
 func dockerResources(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "sleep", []string{"sleep"})
+	tutil.GenDockerContainer(c, m, "sleep", []string{"sleep"})
 
 	dockerFmt := "docker run --rm %s sleep sleep 0.2"
 
@@ -293,8 +284,8 @@ func dockerNetwork(c cluster.TestCluster) {
 
 	c.Log("creating ncat containers")
 
-	genDockerContainer(c, src, "ncat", []string{"ncat"})
-	genDockerContainer(c, dest, "ncat", []string{"ncat"})
+	tutil.GenDockerContainer(c, src, "ncat", []string{"ncat"})
+	tutil.GenDockerContainer(c, dest, "ncat", []string{"ncat"})
 
 	listener := func(ctx context.Context) error {
 		// Will block until a message is recieved
@@ -368,7 +359,7 @@ func dockerOldClient(c cluster.TestCluster) {
 	}
 	c.DropFile(oldclient)
 
-	genDockerContainer(c, m, "echo", []string{"echo"})
+	tutil.GenDockerContainer(c, m, "echo", []string{"echo"})
 
 	output := c.MustSSH(m, "/home/core/docker-1.9.1 run echo echo 'IT WORKED'")
 
@@ -381,7 +372,7 @@ func dockerOldClient(c cluster.TestCluster) {
 func dockerUserns(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "userns-test", []string{"echo", "sleep"})
+	tutil.GenDockerContainer(c, m, "userns-test", []string{"echo", "sleep"})
 
 	// A docker bug causes the docker daemon to fail in creating a container
 	// when the '--userns-remap' option is used and SELinux is enforcing.
@@ -416,7 +407,7 @@ func dockerUserns(c cluster.TestCluster) {
 func dockerNetworksReliably(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "ping", []string{"sh", "ping"})
+	tutil.GenDockerContainer(c, m, "ping", []string{"sh", "ping"})
 
 	output := c.MustSSH(m, `for i in $(seq 1 100); do
 		echo -n "$i: "
@@ -441,7 +432,7 @@ func dockerNetworksReliably(c cluster.TestCluster) {
 func dockerUserNoCaps(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "captest", []string{"capsh", "sh", "grep", "cat", "ls"})
+	tutil.GenDockerContainer(c, m, "captest", []string{"capsh", "sh", "grep", "cat", "ls"})
 
 	// With the current SELinux policy the docker daemon does not have
 	// access to the '/root' directory.  Set SELinux to permisive mode
@@ -478,7 +469,7 @@ func dockerUserNoCaps(c cluster.TestCluster) {
 func dockerSelRestricted(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "permtest", []string{"ls"})
+	tutil.GenDockerContainer(c, m, "permtest", []string{"ls"})
 
 	_, stderr, _ := m.SSH("sudo setenforce 1 && docker run -v /root:/root permtest sh -c 'ls -dlZ /root'")
 
@@ -493,7 +484,7 @@ func dockerSelRestricted(c cluster.TestCluster) {
 func dockerSelReadOnly(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "writetest", []string{"echo"})
+	tutil.GenDockerContainer(c, m, "writetest", []string{"echo"})
 
 	// Test ro mount as baseline, should succeed.
 	_, stderr, err := m.SSH("sudo setenforce 1 && docker run -v /etc/passwd:/etc/passwd:ro writetest sh -c 'echo badguy >> /etc/passwd'")
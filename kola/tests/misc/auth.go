@@ -15,8 +15,14 @@
 package misc
 
 import (
+	"regexp"
+	"strings"
+	"time"
+
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network"
+	"github.com/coreos/mantle/network/journal"
 )
 
 func init() {
@@ -24,6 +30,14 @@ func init() {
 		Run:         AuthVerify,
 		ClusterSize: 1,
 		Name:        "coreos.auth.verify",
+		Flags:       []register.Flag{register.NonDestructive},
+	})
+	register.Register(&register.Test{
+		Run:         AuthKeyTypes,
+		ClusterSize: 1,
+		Name:        "coreos.auth.key-types",
+		Flags:       []register.Flag{register.NonDestructive},
+		SSHKeyTypes: []network.KeyType{network.KeyEd25519, network.KeyECDSA, network.KeyRSA},
 	})
 }
 
@@ -39,3 +53,23 @@ func AuthVerify(c cluster.TestCluster) {
 		c.Fatalf("Successfully authenticated despite invalid password auth")
 	}
 }
+
+// AuthKeyTypes asserts that sshd accepts ed25519 keys and that every key
+// given to the machine is written to authorized_keys.
+func AuthKeyTypes(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	keys := string(c.MustSSH(m, "cat ~/.ssh/authorized_keys"))
+	for _, keyType := range []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "ssh-rsa"} {
+		if !strings.Contains(keys, keyType+" ") {
+			c.Errorf("no %s key in authorized_keys:\n%s", keyType, keys)
+		}
+	}
+
+	// The agent offers the ed25519 key first, so that is the one sshd
+	// should have accepted.
+	accepted := regexp.MustCompile(`^Accepted publickey for core .* ED25519 `)
+	if _, err := m.Journal().WaitFor(time.Minute, journal.Message(accepted)); err != nil {
+		c.Fatalf("sshd did not accept an ed25519 key: %v", err)
+	}
+}
@@ -30,6 +30,7 @@ func init() {
 		Run:         NetworkListeners,
 		ClusterSize: 1,
 		Name:        "coreos.network.listeners",
+		Flags:       []register.Flag{register.NonDestructive},
 	})
 	register.Register(&register.Test{
 		Run:              NetworkInitramfsSecondBoot,
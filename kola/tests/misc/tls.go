@@ -21,6 +21,8 @@ func init() {
 		ClusterSize:      1,
 		Name:             "coreos.tls.fetch-urls",
 		ExcludePlatforms: []string{"qemu"}, // Networking outside cluster required
+		Tags:             []string{"network", "requires-internet"},
+		Flags:            []register.Flag{register.NonDestructive},
 	})
 }
 
@@ -17,15 +17,12 @@ package rkt
 import (
 	"bytes"
 	"fmt"
-	"strings"
 	"time"
 
-	"github.com/coreos/mantle/kola"
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
-	"github.com/coreos/mantle/platform"
+	tutil "github.com/coreos/mantle/kola/tests/util"
 	"github.com/coreos/mantle/platform/conf"
-	"github.com/coreos/mantle/platform/machine/qemu"
 	"github.com/coreos/mantle/util"
 )
 
@@ -84,7 +81,7 @@ func rktBase(c cluster.TestCluster) {
 	// TODO this should not be necessary, but is at the time of writing
 	c.MustSSH(m, "sudo setenforce 0")
 
-	createTestAci(c, m, "test.rkt.aci", []string{"echo", "sleep", "sh"})
+	tutil.CreateTestAci(c, m, "test.rkt.aci", []string{"echo", "sleep", "sh"})
 
 	journalForPodContains := func(c cluster.TestCluster, uuidFile string, contains string) {
 		output := c.MustSSH(m, fmt.Sprintf("journalctl --dir /var/log/journal/$(cat %s | sed 's/-//g')", uuidFile))
@@ -137,39 +134,3 @@ func rktBase(c cluster.TestCluster) {
 		c.MustSSH(m, fmt.Sprintf("rkt status --wait $(cat %s)", uuidFile))
 	})
 }
-
-// TODO: once rkt can fetch a local 'docker' image, using `genDockerContainer`
-// from the docker test file could be a better solution.
-func createTestAci(c cluster.TestCluster, m platform.Machine, name string, bins []string) {
-	// Has format strings for:
-	// 1) aci name
-	// 2) arch
-	testAciManifest := `{
-	"acKind": "ImageManifest",
-	"acVersion": "0.8.9",
-	"name": "%s",
-	"labels": [{"name": "os","value": "linux"},{"name": "arch","value": "%s"},{"name": "version","value": "latest"}]
-}`
-
-	arch := "amd64"
-	if _, ok := c.Cluster.(*qemu.Cluster); ok && kola.QEMUOptions.Board == "arm64-usr" {
-		arch = "aarch64"
-	}
-
-	c.MustSSH(m, `set -e
-	tmpdir=$(mktemp -d)
-	cd $tmpdir
-	cat > manifest <<EOF
-`+fmt.Sprintf(testAciManifest, name, arch)+`
-EOF
-
-	mkdir rootfs
-	bins=$(which `+strings.Join(bins, " ")+`)
-	libs=$(sudo ldd $bins | grep -o /lib'[^ ]*' | sort -u)
-	sudo rsync -av --relative --copy-links $bins $libs ./rootfs/
-
-	sudo tar cf /tmp/test-aci.aci .
-	sudo rkt image fetch --insecure-options=image /tmp/test-aci.aci
-	cd
-	sudo rm -rf /tmp/test-aci.aci $tmpdir`)
-}
@@ -40,6 +40,10 @@ func init() {
 		NativeFuncs: map[string]func() error{
 			"Omaha": Serve,
 		},
+		// locksmithd is stopped so the test controls reboots
+		JournalAllow: []register.JournalAllow{
+			{Check: "failed-unit", Detail: `^locksmithd\.service$`},
+		},
 	})
 }
 
@@ -0,0 +1,73 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+// GenDockerContainer makes a docker container out of binaries on the host.
+func GenDockerContainer(c cluster.TestCluster, m platform.Machine, name string, binnames []string) {
+	cmd := `tmpdir=$(mktemp -d); cd $tmpdir; echo -e "FROM scratch\nCOPY . /" > Dockerfile;
+	        b=$(which %s); libs=$(sudo ldd $b | grep -o /lib'[^ ]*' | sort -u);
+	        sudo rsync -av --relative --copy-links $b $libs ./;
+	        sudo docker build -t %s .`
+
+	c.MustSSH(m, fmt.Sprintf(cmd, strings.Join(binnames, " "), name))
+}
+
+// CreateTestAci makes an ACI out of binaries on the host and fetches it
+// into rkt's store.
+// TODO: once rkt can fetch a local 'docker' image, using GenDockerContainer
+// could be a better solution.
+func CreateTestAci(c cluster.TestCluster, m platform.Machine, name string, bins []string) {
+	// Has format strings for:
+	// 1) aci name
+	// 2) arch
+	testAciManifest := `{
+	"acKind": "ImageManifest",
+	"acVersion": "0.8.9",
+	"name": "%s",
+	"labels": [{"name": "os","value": "linux"},{"name": "arch","value": "%s"},{"name": "version","value": "latest"}]
+}`
+
+	arch := "amd64"
+	if _, ok := c.Cluster.(*qemu.Cluster); ok && kola.QEMUOptions.Board == "arm64-usr" {
+		arch = "aarch64"
+	}
+
+	c.MustSSH(m, `set -e
+	tmpdir=$(mktemp -d)
+	cd $tmpdir
+	cat > manifest <<EOF
+`+fmt.Sprintf(testAciManifest, name, arch)+`
+EOF
+
+	mkdir rootfs
+	bins=$(which `+strings.Join(bins, " ")+`)
+	libs=$(sudo ldd $bins | grep -o /lib'[^ ]*' | sort -u)
+	sudo rsync -av --relative --copy-links $bins $libs ./rootfs/
+
+	sudo tar cf /tmp/test-aci.aci .
+	sudo rkt image fetch --insecure-options=image /tmp/test-aci.aci
+	cd
+	sudo rm -rf /tmp/test-aci.aci $tmpdir`)
+}
@@ -81,6 +81,10 @@ const (
 	FIELD_OBJECT_SYSTEMD_USER_UNIT = "OBJECT_SYSTEMD_USER_UNIT"
 	FIELD_OBJECT_SYSTEMD_OWNER_UID = "OBJECT_SYSTEMD_OWNER_UID"
 
+	// Set by systemd on its own messages about a unit
+	FIELD_UNIT      = "UNIT"
+	FIELD_USER_UNIT = "USER_UNIT"
+
 	// Address Fields
 	FIELD_CURSOR              = "__CURSOR"
 	FIELD_REALTIME_TIMESTAMP  = "__REALTIME_TIMESTAMP"
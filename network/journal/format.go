@@ -16,8 +16,13 @@ package journal
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 	"unicode"
 	"unicode/utf8"
@@ -132,3 +137,229 @@ func writeEscaped(buf *bytes.Buffer, line []byte) {
 		line = line[n:]
 	}
 }
+
+// Formats understood by NewFormatter.
+const (
+	FormatShort   = "short"
+	FormatJSON    = "json"
+	FormatVerbose = "verbose"
+)
+
+// NewFormatter returns a Formatter for one of the named formats.
+func NewFormatter(format string, w io.Writer) (Formatter, error) {
+	switch format {
+	case FormatShort:
+		return ShortWriter(w), nil
+	case FormatJSON:
+		return JSONWriter(w), nil
+	case FormatVerbose:
+		return VerboseWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown journal format %q", format)
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+// JSONWriter writes journal entries as one JSON object per line, like
+// journalctl's "json" format. Field values that aren't printable text
+// are written as arrays of bytes.
+func JSONWriter(w io.Writer) Formatter {
+	return &jsonWriter{enc: json.NewEncoder(w)}
+}
+
+// SetTimezone does nothing; timestamps are written as microseconds.
+func (j *jsonWriter) SetTimezone(tz *time.Location) {}
+
+func (j *jsonWriter) WriteEntry(entry Entry) error {
+	fields := make(map[string]interface{}, len(entry))
+	for name, value := range entry {
+		if isText(value) {
+			fields[name] = string(value)
+		} else {
+			blob := make([]int, len(value))
+			for i, b := range value {
+				blob[i] = int(b)
+			}
+			fields[name] = blob
+		}
+	}
+	return j.enc.Encode(fields)
+}
+
+type verboseWriter struct {
+	w  io.Writer
+	tz *time.Location
+}
+
+// VerboseWriter writes journal entries with all of their fields, like
+// journalctl's "verbose" format.
+func VerboseWriter(w io.Writer) Formatter {
+	return &verboseWriter{
+		w:  w,
+		tz: time.Local,
+	}
+}
+
+// SetTimezone updates the time location. The default is local time.
+func (v *verboseWriter) SetTimezone(tz *time.Location) {
+	v.tz = tz
+}
+
+func (v *verboseWriter) WriteEntry(entry Entry) error {
+	var buf bytes.Buffer
+	if realtime := entry.Realtime(); realtime.IsZero() {
+		buf.WriteString("unknown time")
+	} else {
+		buf.WriteString(realtime.In(v.tz).Format("Mon 2006-01-02 15:04:05.000000 MST"))
+	}
+	if cursor, ok := entry[FIELD_CURSOR]; ok {
+		buf.WriteString(" [")
+		buf.Write(cursor)
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('\n')
+
+	names := make([]string, 0, len(entry))
+	for name := range entry {
+		// address fields are only used for the header
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := entry[name]
+		buf.WriteString("    ")
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		if !isText(value) {
+			fmt.Fprintf(&buf, "[%d bytes blob data]\n", len(value))
+			continue
+		}
+		indent := bytes.Repeat([]byte{' '}, 4+len(name)+1)
+		lines := bytes.Split(value, []byte{'\n'})
+		writeEscaped(&buf, lines[0])
+		for _, line := range lines[1:] {
+			buf.WriteByte('\n')
+			buf.Write(indent)
+			writeEscaped(&buf, line)
+		}
+		buf.WriteByte('\n')
+	}
+
+	_, err := buf.WriteTo(v.w)
+	return err
+}
+
+// UnitWriter writes the entries of each unit to a separate file in a
+// directory, named after the unit. Kernel messages go to kernel.txt and
+// other entries without a unit to unknown.txt.
+type UnitWriter struct {
+	dir          string
+	newFormatter func(io.Writer) Formatter
+	tz           *time.Location
+	units        map[string]*unitFile
+}
+
+type unitFile struct {
+	f *os.File
+	Formatter
+}
+
+// NewUnitWriter returns a UnitWriter creating files in dir, formatted
+// with the Formatter returned by newFormatter.
+func NewUnitWriter(dir string, newFormatter func(io.Writer) Formatter) *UnitWriter {
+	return &UnitWriter{
+		dir:          dir,
+		newFormatter: newFormatter,
+		tz:           time.Local,
+		units:        make(map[string]*unitFile),
+	}
+}
+
+// SetTimezone updates the time location. The default is local time.
+func (u *UnitWriter) SetTimezone(tz *time.Location) {
+	u.tz = tz
+	for _, uf := range u.units {
+		uf.SetTimezone(tz)
+	}
+}
+
+func (u *UnitWriter) WriteEntry(entry Entry) error {
+	unit := string(entry[FIELD_SYSTEMD_UNIT])
+	if unit == "" {
+		if string(entry[FIELD_TRANSPORT]) == "kernel" {
+			unit = "kernel"
+		} else {
+			unit = "unknown"
+		}
+	}
+
+	uf, ok := u.units[unit]
+	if !ok {
+		if err := os.MkdirAll(u.dir, 0777); err != nil {
+			return err
+		}
+		name := strings.Replace(unit, "/", "_", -1) + ".txt"
+		f, err := os.OpenFile(filepath.Join(u.dir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+		uf = &unitFile{f: f, Formatter: u.newFormatter(f)}
+		uf.SetTimezone(u.tz)
+		u.units[unit] = uf
+	}
+	return uf.WriteEntry(entry)
+}
+
+// Close closes the files of all units.
+func (u *UnitWriter) Close() error {
+	var err error
+	for unit, uf := range u.units {
+		if e := uf.f.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(u.units, unit)
+	}
+	return err
+}
+
+type multiFormatter []Formatter
+
+// MultiFormatter returns a Formatter that writes each entry with all of
+// the given formatters.
+func MultiFormatter(formatters ...Formatter) Formatter {
+	return multiFormatter(formatters)
+}
+
+func (m multiFormatter) SetTimezone(tz *time.Location) {
+	for _, f := range m {
+		f.SetTimezone(tz)
+	}
+}
+
+func (m multiFormatter) WriteEntry(entry Entry) error {
+	var err error
+	for _, f := range m {
+		if e := f.WriteEntry(entry); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// isText reports whether a field value can be written as text.
+func isText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
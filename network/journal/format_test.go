@@ -17,6 +17,9 @@ package journal
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -178,3 +181,94 @@ Feb 14 20:15:16.372858 python3[16853]: foo
 		t.Errorf("unexpected output:\n%s", d)
 	}
 }
+
+func TestFormatJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w := JSONWriter(&buf)
+	entries := []Entry{{
+		FIELD_REALTIME_TIMESTAMP: []byte("1342540861421465"),
+		FIELD_MESSAGE:            []byte("first\nsecond"),
+	}, {
+		FIELD_MESSAGE: []byte("\x01\xff"),
+	}}
+	for _, entry := range entries {
+		if err := w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const expect = `{"MESSAGE":"first\nsecond","__REALTIME_TIMESTAMP":"1342540861421465"}
+{"MESSAGE":[1,255]}
+`
+	if d := diff.Diff(buf.String(), expect); d != "" {
+		t.Errorf("unexpected output:\n%s", d)
+	}
+}
+
+func TestFormatVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	w := VerboseWriter(&buf)
+	w.SetTimezone(time.UTC)
+	err := w.WriteEntry(Entry{
+		FIELD_CURSOR:             []byte("s=1;i=2"),
+		FIELD_REALTIME_TIMESTAMP: []byte("1342540861421465"),
+		FIELD_PID:                []byte("8278"),
+		FIELD_MESSAGE:            []byte("first\nsecond"),
+		"BLOB":                   []byte("\x00\x01"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `Tue 2012-07-17 16:01:01.421465 UTC [s=1;i=2]
+    BLOB=[2 bytes blob data]
+    MESSAGE=first
+            second
+    _PID=8278
+`
+	if d := diff.Diff(buf.String(), expect); d != "" {
+		t.Errorf("unexpected output:\n%s", d)
+	}
+}
+
+func TestUnitWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	uw := NewUnitWriter(dir, ShortWriter)
+	uw.SetTimezone(time.UTC)
+	er := NewExportReader(strings.NewReader(exportText + exportBinary))
+	for {
+		entry, err := er.ReadEntry()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if err := uw.WriteEntry(entry); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := uw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expect := range map[string]string{
+		"unknown.txt": `Jul 17 16:01:01.413961 gdm-password][587]: AccountsService-DEBUG(+): ActUserManager: ignoring unspecified session '8' since it's not graphical: Success
+Jul 17 16:01:01.416351 /USR/SBIN/CROND[8278]: (root) CMD (run-parts /etc/cron.hourly)
+`,
+		"session-35898.scope.txt": `Feb 14 20:15:16.372858 python3[16853]: foo
+                                       bar
+`,
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if d := diff.Diff(string(data), expect); d != "" {
+			t.Errorf("unexpected %s:\n%s", name, d)
+		}
+	}
+}
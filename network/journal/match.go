@@ -0,0 +1,141 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syslog priorities, as found in the PRIORITY field.
+const (
+	PriEmerg = iota
+	PriAlert
+	PriCrit
+	PriErr
+	PriWarning
+	PriNotice
+	PriInfo
+	PriDebug
+)
+
+// Matcher reports whether a journal entry should be selected.
+type Matcher func(Entry) bool
+
+// Match reports whether the entry is selected by all of the matchers.
+func (e Entry) Match(matchers ...Matcher) bool {
+	for _, m := range matchers {
+		if !m(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unit selects entries logged by any of the given units, or logged by
+// systemd about them.
+func Unit(units ...string) Matcher {
+	return func(e Entry) bool {
+		for _, unit := range units {
+			for _, field := range []string{FIELD_SYSTEMD_UNIT, FIELD_UNIT, FIELD_COREDUMP_UNIT} {
+				if string(e[field]) == unit {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Identifier selects entries with the given syslog identifier, like
+// journalctl's -t option.
+func Identifier(id string) Matcher {
+	return Field(FIELD_SYSLOG_IDENTIFIER, id)
+}
+
+// MaxPriority selects entries at least as important as priority, like
+// journalctl's -p option. Entries without a priority are not selected.
+func MaxPriority(priority int) Matcher {
+	return func(e Entry) bool {
+		p, err := strconv.Atoi(string(e[FIELD_PRIORITY]))
+		return err == nil && p <= priority
+	}
+}
+
+// BootID selects entries from the given boot. The ID may be given as
+// found in /proc/sys/kernel/random/boot_id.
+func BootID(id string) Matcher {
+	id = normalizeID(id)
+	return func(e Entry) bool {
+		return normalizeID(string(e[FIELD_BOOT_ID])) == id
+	}
+}
+
+// MessageID selects entries with the given MESSAGE_ID.
+func MessageID(id string) Matcher {
+	id = normalizeID(id)
+	return func(e Entry) bool {
+		return normalizeID(string(e[FIELD_MESSAGE_ID])) == id
+	}
+}
+
+// Since selects entries logged at or after t.
+func Since(t time.Time) Matcher {
+	return func(e Entry) bool {
+		rt := e.Realtime()
+		return !rt.IsZero() && !rt.Before(t)
+	}
+}
+
+// Until selects entries logged before t.
+func Until(t time.Time) Matcher {
+	return func(e Entry) bool {
+		rt := e.Realtime()
+		return !rt.IsZero() && rt.Before(t)
+	}
+}
+
+// Message selects entries whose message matches re.
+func Message(re *regexp.Regexp) Matcher {
+	return func(e Entry) bool {
+		msg, ok := e[FIELD_MESSAGE]
+		return ok && re.Match(msg)
+	}
+}
+
+// Field selects entries where field is exactly value.
+func Field(field, value string) Matcher {
+	return func(e Entry) bool {
+		v, ok := e[field]
+		return ok && bytes.Equal(v, []byte(value))
+	}
+}
+
+// HasField selects entries that have field.
+func HasField(field string) Matcher {
+	return func(e Entry) bool {
+		_, ok := e[field]
+		return ok
+	}
+}
+
+// IDs are 128-bit values journald prints as plain hex, while others
+// print them as UUIDs.
+func normalizeID(id string) string {
+	return strings.ToLower(strings.Replace(id, "-", "", -1))
+}
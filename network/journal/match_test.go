@@ -0,0 +1,115 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	entry := Entry{
+		FIELD_MESSAGE:            []byte("Started Network Service."),
+		FIELD_MESSAGE_ID:         []byte("39f53479d3a045ac8e11786248231fbf"),
+		FIELD_PRIORITY:           []byte("6"),
+		FIELD_SYSLOG_IDENTIFIER:  []byte("systemd"),
+		FIELD_SYSTEMD_UNIT:       []byte("init.scope"),
+		FIELD_UNIT:               []byte("systemd-networkd.service"),
+		FIELD_BOOT_ID:            []byte("5ec94e10cde24d1b8c3e4bb9e9f2bd01"),
+		FIELD_REALTIME_TIMESTAMP: []byte("1342540861416409"),
+	}
+	realtime := time.Unix(1342540861, 416409000)
+
+	for _, testcase := range []struct {
+		name     string
+		matchers []Matcher
+		expect   bool
+	}{{
+		name:   "none",
+		expect: true,
+	}, {
+		name:     "unit",
+		matchers: []Matcher{Unit("docker.service", "systemd-networkd.service")},
+		expect:   true,
+	}, {
+		name:     "systemd_unit",
+		matchers: []Matcher{Unit("init.scope")},
+		expect:   true,
+	}, {
+		name:     "other_unit",
+		matchers: []Matcher{Unit("docker.service")},
+		expect:   false,
+	}, {
+		name:     "identifier",
+		matchers: []Matcher{Identifier("systemd")},
+		expect:   true,
+	}, {
+		name:     "priority",
+		matchers: []Matcher{MaxPriority(PriInfo)},
+		expect:   true,
+	}, {
+		name:     "important_priority",
+		matchers: []Matcher{MaxPriority(PriWarning)},
+		expect:   false,
+	}, {
+		name:     "boot_id_uuid",
+		matchers: []Matcher{BootID("5EC94E10-CDE2-4D1B-8C3E-4BB9E9F2BD01")},
+		expect:   true,
+	}, {
+		name:     "other_boot_id",
+		matchers: []Matcher{BootID("00000000-cde2-4d1b-8c3e-4bb9e9f2bd01")},
+		expect:   false,
+	}, {
+		name:     "message_id",
+		matchers: []Matcher{MessageID("39f53479-d3a0-45ac-8e11-786248231fbf")},
+		expect:   true,
+	}, {
+		name:     "time_range",
+		matchers: []Matcher{Since(realtime), Until(realtime.Add(time.Second))},
+		expect:   true,
+	}, {
+		name:     "until",
+		matchers: []Matcher{Until(realtime)},
+		expect:   false,
+	}, {
+		name:     "message",
+		matchers: []Matcher{Message(regexp.MustCompile("^Started Network"))},
+		expect:   true,
+	}, {
+		name:     "has_field",
+		matchers: []Matcher{HasField(FIELD_UNIT)},
+		expect:   true,
+	}, {
+		name:     "missing_field",
+		matchers: []Matcher{HasField(FIELD_COREDUMP_UNIT)},
+		expect:   false,
+	}, {
+		name:     "message_and_other_unit",
+		matchers: []Matcher{Message(regexp.MustCompile("Network")), Unit("docker.service")},
+		expect:   false,
+	},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if result := entry.Match(testcase.matchers...); result != testcase.expect {
+				t.Errorf("%v != %v", result, testcase.expect)
+			}
+		})
+	}
+
+	if (Entry{}).Match(MaxPriority(PriDebug)) {
+		t.Errorf("entry without priority matched")
+	}
+}
@@ -0,0 +1,681 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// chunkSize is the size of each read and write request, well within
+// what OpenSSH's sftp-server accepts.
+const chunkSize = 32 * 1024
+
+// maxInflight is how many read or write requests a File keeps
+// outstanding, so transfers aren't bound by the round trip time.
+const maxInflight = 64
+
+// Client is an SFTP client. Requests don't wait for the responses to
+// earlier ones; a Client is safe for concurrent use.
+type Client struct {
+	wmu sync.Mutex // serializes requests
+	w   io.WriteCloser
+
+	mu       sync.Mutex
+	nextID   uint32
+	inflight map[uint32]chan<- response
+	err      error // reading responses failed
+}
+
+// response is the type and payload of a response, or the error that
+// kept it from arriving.
+type response struct {
+	typ byte
+	d   decoder
+	err error
+}
+
+// NewClient starts an SFTP session with the server reading from w and
+// writing to r, typically the stdin and stdout of an sftp-server
+// process or subsystem. Close closes w.
+func NewClient(r io.Reader, w io.WriteCloser) (*Client, error) {
+	c := &Client{w: w, inflight: make(map[uint32]chan<- response)}
+
+	p := newPacket(fxpInit)
+	p.uint32(protocolVersion)
+	if err := writePacket(w, p); err != nil {
+		return nil, fmt.Errorf("sftp: sending init: %v", err)
+	}
+	typ, d, err := readPacket(r)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: reading version: %v", err)
+	}
+	if typ != fxpVersion {
+		return nil, fmt.Errorf("sftp: expected version packet, got type %d", typ)
+	}
+	version, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if version != protocolVersion {
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", version)
+	}
+	go c.receive(r)
+	return c, nil
+}
+
+// Close ends the session.
+func (c *Client) Close() error {
+	return c.w.Close()
+}
+
+// receive hands responses read from r to their requests until reading
+// fails, which fails all outstanding and later requests.
+func (c *Client) receive(r io.Reader) {
+	for {
+		typ, d, err := readPacket(r)
+		var id uint32
+		if err == nil {
+			id, err = d.uint32()
+		}
+		c.mu.Lock()
+		ch, ok := c.inflight[id]
+		if err == nil && !ok {
+			err = fmt.Errorf("sftp: response for unknown request %d", id)
+		}
+		if err != nil {
+			c.err = err
+			for id, ch := range c.inflight {
+				ch <- response{err: err}
+				delete(c.inflight, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+		delete(c.inflight, id)
+		c.mu.Unlock()
+		ch <- response{typ: typ, d: d}
+	}
+}
+
+// send sends a request of type typ with the payload built by fill and
+// returns a channel that receives the response.
+func (c *Client) send(typ byte, fill func(b *buffer)) <-chan response {
+	ch := make(chan response, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		ch <- response{err: c.err}
+		c.mu.Unlock()
+		return ch
+	}
+	c.nextID++
+	id := c.nextID
+	c.inflight[id] = ch
+	c.mu.Unlock()
+
+	p := newPacket(typ)
+	p.uint32(id)
+	fill(&p)
+	c.wmu.Lock()
+	err := writePacket(c.w, p)
+	c.wmu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		if _, ok := c.inflight[id]; ok {
+			delete(c.inflight, id)
+			ch <- response{err: err}
+		}
+		c.mu.Unlock()
+	}
+	return ch
+}
+
+// request sends a request of type typ with the payload built by fill and
+// returns the type and payload of the response.
+func (c *Client) request(typ byte, fill func(b *buffer)) (byte, decoder, error) {
+	r := <-c.send(typ, fill)
+	return r.typ, r.d, r.err
+}
+
+// status decodes a status response. StatusOK decodes to nil.
+func status(d decoder) error {
+	code, err := d.uint32()
+	if err != nil {
+		return err
+	}
+	if code == StatusOK {
+		return nil
+	}
+	msg, _ := d.string()
+	return &StatusError{Code: code, Message: msg}
+}
+
+func unexpected(typ byte) error {
+	return fmt.Errorf("sftp: unexpected response type %d", typ)
+}
+
+// statusResponse decodes a response that is only a status.
+func statusResponse(r response) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.typ != fxpStatus {
+		return unexpected(r.typ)
+	}
+	return status(r.d)
+}
+
+// dataResponse decodes the response to a read. StatusEOF decodes to
+// io.EOF.
+func dataResponse(r response) ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	switch r.typ {
+	case fxpData:
+		return r.d.bytes()
+	case fxpStatus:
+		err := status(r.d)
+		if se, ok := err.(*StatusError); ok && se.Code == StatusEOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return nil, unexpected(r.typ)
+}
+
+// expectStatus sends a request whose only response is a status.
+func (c *Client) expectStatus(typ byte, fill func(b *buffer)) error {
+	return statusResponse(<-c.send(typ, fill))
+}
+
+// expectHandle sends a request that opens a handle.
+func (c *Client) expectHandle(typ byte, fill func(b *buffer)) (string, error) {
+	rtyp, d, err := c.request(typ, fill)
+	if err != nil {
+		return "", err
+	}
+	switch rtyp {
+	case fxpHandle:
+		return d.string()
+	case fxpStatus:
+		if err := status(d); err != nil {
+			return "", err
+		}
+	}
+	return "", unexpected(rtyp)
+}
+
+// expectAttrs sends a request answered with file attributes.
+func (c *Client) expectAttrs(typ byte, fill func(b *buffer)) (*attrs, error) {
+	rtyp, d, err := c.request(typ, fill)
+	if err != nil {
+		return nil, err
+	}
+	switch rtyp {
+	case fxpAttrs:
+		return d.attrs()
+	case fxpStatus:
+		if err := status(d); err != nil {
+			return nil, err
+		}
+	}
+	return nil, unexpected(rtyp)
+}
+
+// expectName sends a request answered with a single name.
+func (c *Client) expectName(typ byte, fill func(b *buffer)) (string, error) {
+	names, err := c.expectNames(typ, fill)
+	if err != nil {
+		return "", err
+	}
+	if len(names) != 1 {
+		return "", fmt.Errorf("sftp: expected 1 name, got %d", len(names))
+	}
+	return names[0].name, nil
+}
+
+// expectNames sends a request answered with a list of names.
+func (c *Client) expectNames(typ byte, fill func(b *buffer)) ([]*fileInfo, error) {
+	rtyp, d, err := c.request(typ, fill)
+	if err != nil {
+		return nil, err
+	}
+	switch rtyp {
+	case fxpName:
+		count, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		names := make([]*fileInfo, 0, count)
+		for i := uint32(0); i < count; i++ {
+			name, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := d.string(); err != nil { // longname
+				return nil, err
+			}
+			a, err := d.attrs()
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, &fileInfo{name: name, a: a})
+		}
+		return names, nil
+	case fxpStatus:
+		if err := status(d); err != nil {
+			return nil, err
+		}
+	}
+	return nil, unexpected(rtyp)
+}
+
+func (c *Client) stat(typ byte, op, name string) (os.FileInfo, error) {
+	a, err := c.expectAttrs(typ, func(b *buffer) { b.string(name) })
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	return &fileInfo{name: path.Base(name), a: a}, nil
+}
+
+// Stat returns the attributes of name, following symlinks. Sys returns
+// a *FileStat.
+func (c *Client) Stat(name string) (os.FileInfo, error) {
+	return c.stat(fxpStat, "stat", name)
+}
+
+// Lstat returns the attributes of name, not following symlinks.
+func (c *Client) Lstat(name string) (os.FileInfo, error) {
+	return c.stat(fxpLstat, "lstat", name)
+}
+
+func (c *Client) setstat(op, name string, a *attrs) error {
+	err := c.expectStatus(fxpSetstat, func(b *buffer) {
+		b.string(name)
+		b.attrs(a)
+	})
+	if err != nil {
+		return pathError(op, name, err)
+	}
+	return nil
+}
+
+// Chmod changes the permissions of name.
+func (c *Client) Chmod(name string, mode os.FileMode) error {
+	return c.setstat("chmod", name, &attrs{
+		flags: attrPermissions,
+		mode:  fromFileMode(mode) &^ sIFMT,
+	})
+}
+
+// Chown changes the numeric owner and group of name.
+func (c *Client) Chown(name string, uid, gid int) error {
+	return c.setstat("chown", name, &attrs{
+		flags: attrUIDGID,
+		uid:   uint32(uid),
+		gid:   uint32(gid),
+	})
+}
+
+// Chtimes changes the access and modification times of name, with
+// one second precision.
+func (c *Client) Chtimes(name string, atime, mtime time.Time) error {
+	return c.setstat("chtimes", name, &attrs{
+		flags: attrACModTime,
+		atime: uint32(atime.Unix()),
+		mtime: uint32(mtime.Unix()),
+	})
+}
+
+// Mkdir creates the directory name.
+func (c *Client) Mkdir(name string, perm os.FileMode) error {
+	err := c.expectStatus(fxpMkdir, func(b *buffer) {
+		b.string(name)
+		b.attrs(&attrs{flags: attrPermissions, mode: uint32(perm.Perm())})
+	})
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// MkdirAll creates the directory name and any missing parents.
+func (c *Client) MkdirAll(name string, perm os.FileMode) error {
+	if fi, err := c.Stat(name); err == nil {
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("not a directory")}
+		}
+		return nil
+	}
+	if parent := path.Dir(name); parent != name && parent != "." {
+		if err := c.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := c.Mkdir(name, perm); err != nil {
+		// lost a race, or name is a symlink to a directory
+		if fi, serr := c.Stat(name); serr == nil && fi.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove removes the file name.
+func (c *Client) Remove(name string) error {
+	if err := c.expectStatus(fxpRemove, func(b *buffer) { b.string(name) }); err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// RemoveDir removes the empty directory name.
+func (c *Client) RemoveDir(name string) error {
+	if err := c.expectStatus(fxpRmdir, func(b *buffer) { b.string(name) }); err != nil {
+		return pathError("rmdir", name, err)
+	}
+	return nil
+}
+
+// Rename renames oldname to newname.
+func (c *Client) Rename(oldname, newname string) error {
+	err := c.expectStatus(fxpRename, func(b *buffer) {
+		b.string(oldname)
+		b.string(newname)
+	})
+	if err != nil {
+		return pathError("rename", oldname, err)
+	}
+	return nil
+}
+
+// ReadLink returns the target of the symlink name.
+func (c *Client) ReadLink(name string) (string, error) {
+	target, err := c.expectName(fxpReadlink, func(b *buffer) { b.string(name) })
+	if err != nil {
+		return "", pathError("readlink", name, err)
+	}
+	return target, nil
+}
+
+// Symlink creates newname as a symlink to oldname.
+func (c *Client) Symlink(oldname, newname string) error {
+	// OpenSSH swapped the arguments relative to the draft, and
+	// everyone followed it.
+	err := c.expectStatus(fxpSymlink, func(b *buffer) {
+		b.string(oldname)
+		b.string(newname)
+	})
+	if err != nil {
+		return pathError("symlink", newname, err)
+	}
+	return nil
+}
+
+// RealPath canonicalizes name into an absolute path.
+func (c *Client) RealPath(name string) (string, error) {
+	abs, err := c.expectName(fxpRealpath, func(b *buffer) { b.string(name) })
+	if err != nil {
+		return "", pathError("realpath", name, err)
+	}
+	return abs, nil
+}
+
+// ReadDir returns the entries of the directory name, excluding "." and
+// "..", in the order the server sends them.
+func (c *Client) ReadDir(name string) ([]os.FileInfo, error) {
+	handle, err := c.expectHandle(fxpOpendir, func(b *buffer) { b.string(name) })
+	if err != nil {
+		return nil, pathError("opendir", name, err)
+	}
+	defer c.closeHandle(handle)
+
+	var ret []os.FileInfo
+	for {
+		names, err := c.expectNames(fxpReaddir, func(b *buffer) { b.string(handle) })
+		if se, ok := err.(*StatusError); ok && se.Code == StatusEOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, pathError("readdir", name, err)
+		}
+		for _, fi := range names {
+			if fi.name != "." && fi.name != ".." {
+				ret = append(ret, fi)
+			}
+		}
+	}
+}
+
+func (c *Client) closeHandle(handle string) error {
+	return c.expectStatus(fxpClose, func(b *buffer) { b.string(handle) })
+}
+
+// Open opens name for reading.
+func (c *Client) Open(name string) (*File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates name for writing.
+func (c *Client) Create(name string) (*File, error) {
+	return c.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens name with the given os.O_* flags, creating it with
+// perm if needed. O_SYNC is not supported.
+func (c *Client) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	var pflags uint32
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		pflags = fxfRead
+	case os.O_WRONLY:
+		pflags = fxfWrite
+	case os.O_RDWR:
+		pflags = fxfRead | fxfWrite
+	}
+	if flag&os.O_APPEND != 0 {
+		pflags |= fxfAppend
+	}
+	if flag&os.O_CREATE != 0 {
+		pflags |= fxfCreat
+	}
+	if flag&os.O_TRUNC != 0 {
+		pflags |= fxfTrunc
+	}
+	if flag&os.O_EXCL != 0 {
+		pflags |= fxfExcl
+	}
+
+	handle, err := c.expectHandle(fxpOpen, func(b *buffer) {
+		b.string(name)
+		b.uint32(pflags)
+		b.attrs(&attrs{flags: attrPermissions, mode: uint32(perm.Perm())})
+	})
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &File{c: c, name: name, handle: handle}, nil
+}
+
+// File is an open remote file. Reads and writes are sequential from the
+// start of the file. Large writes, ReadFrom and WriteTo keep several
+// requests outstanding.
+type File struct {
+	c      *Client
+	name   string
+	handle string
+	offset int64
+}
+
+// Name returns the name the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// readRequest reads up to chunkSize bytes at offset.
+func (f *File) readRequest(offset int64) <-chan response {
+	return f.c.send(fxpRead, func(b *buffer) {
+		b.string(f.handle)
+		b.uint64(uint64(offset))
+		b.uint32(chunkSize)
+	})
+}
+
+// Read implements io.Reader.
+func (f *File) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	data, err := dataResponse(<-f.c.send(fxpRead, func(b *buffer) {
+		b.string(f.handle)
+		b.uint64(uint64(f.offset))
+		b.uint32(uint32(len(p)))
+	}))
+	if err == io.EOF {
+		return 0, err
+	} else if err != nil {
+		return 0, pathError("read", f.name, err)
+	}
+	n := copy(p, data)
+	f.offset += int64(n)
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo, reading ahead of w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	type read struct {
+		ch     <-chan response
+		offset int64
+	}
+	var inflight []read
+	defer func() {
+		// wait out reads past the end of the file
+		for _, r := range inflight {
+			<-r.ch
+		}
+	}()
+
+	var written int64
+	next := f.offset
+	for {
+		for len(inflight) < maxInflight {
+			inflight = append(inflight, read{f.readRequest(next), next})
+			next += chunkSize
+		}
+		r := inflight[0]
+		inflight = inflight[1:]
+		data, err := dataResponse(<-r.ch)
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, pathError("read", f.name, err)
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		f.offset += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if len(data) < chunkSize {
+			// the reads after a short one are at the wrong offsets
+			for _, r := range inflight {
+				<-r.ch
+			}
+			inflight = nil
+			next = f.offset
+		}
+	}
+}
+
+// Write implements io.Writer.
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.ReadFrom(bytes.NewReader(p))
+	return int(n), err
+}
+
+// ReadFrom implements io.ReaderFrom, writing without waiting for earlier
+// writes to be acknowledged.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	type write struct {
+		ch <-chan response
+		n  int
+	}
+	var inflight []write
+	var written int64
+	var err error
+	// wait for the oldest write
+	wait := func() {
+		w := inflight[0]
+		inflight = inflight[1:]
+		if werr := statusResponse(<-w.ch); werr != nil {
+			if err == nil {
+				err = pathError("write", f.name, werr)
+			}
+		} else if err == nil {
+			written += int64(w.n)
+		}
+	}
+
+	buf := make([]byte, chunkSize)
+	for err == nil {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			offset := f.offset
+			inflight = append(inflight, write{f.c.send(fxpWrite, func(b *buffer) {
+				b.string(f.handle)
+				b.uint64(uint64(offset))
+				b.bytes(buf[:n])
+			}), n})
+			f.offset += int64(n)
+			if len(inflight) == maxInflight {
+				wait()
+			}
+		}
+		if rerr != nil {
+			if rerr != io.EOF && err == nil {
+				err = rerr
+			}
+			break
+		}
+	}
+	for len(inflight) > 0 {
+		wait()
+	}
+	return written, err
+}
+
+// Stat returns the attributes of the open file.
+func (f *File) Stat() (os.FileInfo, error) {
+	a, err := f.c.expectAttrs(fxpFstat, func(b *buffer) { b.string(f.handle) })
+	if err != nil {
+		return nil, pathError("stat", f.name, err)
+	}
+	return &fileInfo{name: path.Base(f.name), a: a}, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	if err := f.c.closeHandle(f.handle); err != nil {
+		return pathError("close", f.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testServers are the servers the client is tested against: the one in
+// server_test.go and OpenSSH's sftp-server, if it's installed.
+var testServers = []string{"serve", "sftp-server"}
+
+// sftpServerPaths are where distributions install OpenSSH's sftp-server.
+var sftpServerPaths = []string{
+	"/usr/lib/openssh/sftp-server",
+	"/usr/libexec/openssh/sftp-server",
+	"/usr/lib/ssh/sftp-server",
+	"/usr/lib64/misc/sftp-server",
+}
+
+// newTestClient returns a client connected to the given test server,
+// and a temporary directory to work in.
+func newTestClient(t *testing.T, server string) (*Client, string, func()) {
+	var start func(r io.Reader, w io.WriteCloser) (func() error, error)
+	switch server {
+	case "serve":
+		start = func(r io.Reader, w io.WriteCloser) (func() error, error) {
+			done := make(chan error, 1)
+			go func() {
+				done <- serve(r, w)
+				w.Close()
+			}()
+			return func() error { return <-done }, nil
+		}
+	case "sftp-server":
+		var path string
+		for _, p := range sftpServerPaths {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			t.Skip("sftp-server not installed")
+		}
+		start = func(r io.Reader, w io.WriteCloser) (func() error, error) {
+			cmd := exec.Command(path)
+			cmd.Stdin = r
+			cmd.Stdout = w
+			cmd.Stderr = os.Stderr
+			if err := cmd.Start(); err != nil {
+				return nil, err
+			}
+			return func() error {
+				err := cmd.Wait()
+				w.Close()
+				return err
+			}, nil
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "mantle-sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	wait, err := start(reqR, respW)
+	if err != nil {
+		t.Fatalf("starting %s failed: %v", server, err)
+	}
+
+	c, err := NewClient(respR, reqW)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return c, dir, func() {
+		c.Close()
+		if err := wait(); err != nil {
+			t.Errorf("%s failed: %v", server, err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClientFiles(t *testing.T) {
+	for _, server := range testServers {
+		t.Run(server, func(t *testing.T) {
+			c, dir, cleanup := newTestClient(t, server)
+			defer cleanup()
+			testClientFiles(t, c, dir)
+		})
+	}
+}
+
+func testClientFiles(t *testing.T, c *Client, dir string) {
+	// larger than a chunk, to exercise split reads and writes
+	data := make([]byte, 3*chunkSize+17)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	name := filepath.Join(dir, "a", "b", "file")
+	if err := c.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	f, err := c.Create(name)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if n, err := f.Write(data); err != nil || n != len(data) {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	f, err = c.Open(name)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	got, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("read %d bytes back, expected the %d written", len(got), len(data))
+	}
+
+	mtime := time.Unix(1500000000, 0)
+	if err := c.Chmod(name, 0640); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if err := c.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	fi, err := c.Stat(name)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fi.Name() != "file" || fi.Size() != int64(len(data)) || fi.Mode() != 0640 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("unexpected attributes %s %d %v %v", fi.Name(), fi.Size(), fi.Mode(), fi.ModTime())
+	}
+	if st := fi.Sys().(*FileStat); int(st.UID) != os.Getuid() {
+		t.Errorf("owner %d, expected %d", st.UID, os.Getuid())
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := c.Symlink("a/b/file", link); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	if target, err := c.ReadLink(link); err != nil || target != "a/b/file" {
+		t.Errorf("ReadLink returned %q, %v", target, err)
+	}
+	if fi, err := c.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat returned %v, %v", fi, err)
+	}
+
+	entries, err := c.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("ReadDir returned %d entries, expected 2", len(entries))
+	}
+
+	if err := c.Remove(name); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := c.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Stat of removed file returned %v", err)
+	}
+	if _, err := c.Open(name); !os.IsNotExist(err) {
+		t.Errorf("Open of removed file returned %v", err)
+	}
+}
+
+// stallingServer answers the first batch requests only once they have
+// all arrived, so a client that waits for each response deadlocks. Reads
+// are answered with full chunks up to size and writes are discarded.
+func stallingServer(r io.Reader, w io.Writer, batch int, size int64) error {
+	if _, _, err := readPacket(r); err != nil {
+		return err
+	}
+	p := newPacket(fxpVersion)
+	p.uint32(protocolVersion)
+	if err := writePacket(w, p); err != nil {
+		return err
+	}
+
+	var held []buffer
+	for {
+		typ, d, err := readPacket(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		id, _ := d.uint32()
+		d.string() // handle
+		offset, _ := d.uint64()
+		var p buffer
+		if typ == fxpRead && int64(offset) < size {
+			p = newPacket(fxpData)
+			p.uint32(id)
+			p.bytes(make([]byte, chunkSize))
+		} else {
+			code := uint32(StatusOK)
+			if typ == fxpRead {
+				code = StatusEOF
+			}
+			p = newPacket(fxpStatus)
+			p.uint32(id)
+			p.uint32(code)
+			p.string("")
+			p.string("")
+		}
+		held = append(held, p)
+		if len(held) < batch {
+			continue
+		}
+		batch = 0
+		for _, p := range held {
+			if err := writePacket(w, p); err != nil {
+				return err
+			}
+		}
+		held = nil
+	}
+}
+
+func TestClientPipelining(t *testing.T) {
+	const batch = 8
+	for _, tt := range []struct {
+		name     string
+		transfer func(f *File) (int64, error)
+	}{
+		{"Write", func(f *File) (int64, error) {
+			n, err := f.Write(make([]byte, batch*chunkSize))
+			return int64(n), err
+		}},
+		{"ReadFrom", func(f *File) (int64, error) {
+			return f.ReadFrom(bytes.NewReader(make([]byte, batch*chunkSize)))
+		}},
+		{"WriteTo", func(f *File) (int64, error) {
+			return f.WriteTo(ioutil.Discard)
+		}},
+	} {
+		reqR, reqW := io.Pipe()
+		respR, respW := io.Pipe()
+		go func() {
+			stallingServer(reqR, respW, batch, batch*chunkSize)
+			respW.Close()
+		}()
+		c, err := NewClient(respR, reqW)
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			n, err := tt.transfer(&File{c: c, name: "file", handle: "h"})
+			if err == nil && n != batch*chunkSize {
+				err = fmt.Errorf("transferred %d bytes", n)
+			}
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Errorf("%s: requests weren't pipelined", tt.name)
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sftp implements version 3 of the SSH File Transfer Protocol,
+// as spoken by OpenSSH.
+// https://tools.ietf.org/html/draft-ietf-secsh-filexfer-02
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const protocolVersion = 3
+
+// maxPacket bounds the size of packets accepted from the peer.
+const maxPacket = 256 * 1024
+
+// short-hand to make the marshal functions less tedious
+var be = binary.BigEndian
+
+// packet types
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpReadlink = 19
+	fxpSymlink  = 20
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+)
+
+// open flags
+const (
+	fxfRead   = 0x01
+	fxfWrite  = 0x02
+	fxfAppend = 0x04
+	fxfCreat  = 0x08
+	fxfTrunc  = 0x10
+	fxfExcl   = 0x20
+)
+
+// attribute flags
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+// Status codes returned by the server.
+const (
+	StatusOK               = 0
+	StatusEOF              = 1
+	StatusNoSuchFile       = 2
+	StatusPermissionDenied = 3
+	StatusFailure          = 4
+	StatusBadMessage       = 5
+	StatusNoConnection     = 6
+	StatusConnectionLost   = 7
+	StatusOpUnsupported    = 8
+)
+
+// StatusError is an error status returned by the server.
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("sftp: status %d", e.Code)
+	}
+	return fmt.Sprintf("sftp: %s (status %d)", e.Message, e.Code)
+}
+
+// pathError wraps an error status for op on path, translating the
+// statuses that have an os package equivalent.
+func pathError(op, path string, err error) error {
+	if se, ok := err.(*StatusError); ok {
+		switch se.Code {
+		case StatusNoSuchFile:
+			err = os.ErrNotExist
+		case StatusPermissionDenied:
+			err = os.ErrPermission
+		}
+	}
+	return &os.PathError{Op: op, Path: path, Err: err}
+}
+
+var errShortPacket = errors.New("sftp: short packet")
+
+// buffer builds an outgoing packet.
+type buffer []byte
+
+func (b *buffer) byte(v byte) {
+	*b = append(*b, v)
+}
+
+func (b *buffer) uint32(v uint32) {
+	*b = append(*b, 0, 0, 0, 0)
+	be.PutUint32((*b)[len(*b)-4:], v)
+}
+
+func (b *buffer) uint64(v uint64) {
+	*b = append(*b, 0, 0, 0, 0, 0, 0, 0, 0)
+	be.PutUint64((*b)[len(*b)-8:], v)
+}
+
+func (b *buffer) string(s string) {
+	b.uint32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *buffer) bytes(p []byte) {
+	b.uint32(uint32(len(p)))
+	*b = append(*b, p...)
+}
+
+func (b *buffer) attrs(a *attrs) {
+	b.uint32(a.flags)
+	if a.flags&attrSize != 0 {
+		b.uint64(a.size)
+	}
+	if a.flags&attrUIDGID != 0 {
+		b.uint32(a.uid)
+		b.uint32(a.gid)
+	}
+	if a.flags&attrPermissions != 0 {
+		b.uint32(a.mode)
+	}
+	if a.flags&attrACModTime != 0 {
+		b.uint32(a.atime)
+		b.uint32(a.mtime)
+	}
+}
+
+// newPacket starts a packet of type typ, leaving room for its length.
+func newPacket(typ byte) buffer {
+	b := buffer{0, 0, 0, 0}
+	b.byte(typ)
+	return b
+}
+
+// writePacket fills in the length of b and sends it.
+func writePacket(w io.Writer, b buffer) error {
+	be.PutUint32(b, uint32(len(b)-4))
+	_, err := w.Write(b)
+	return err
+}
+
+// readPacket reads one packet and returns its type and payload.
+func readPacket(r io.Reader) (byte, decoder, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := be.Uint32(hdr[:])
+	if length < 1 || length > maxPacket+1024 {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], decoder(payload), nil
+}
+
+// decoder consumes an incoming packet.
+type decoder []byte
+
+func (d *decoder) uint32() (uint32, error) {
+	if len(*d) < 4 {
+		return 0, errShortPacket
+	}
+	v := be.Uint32(*d)
+	*d = (*d)[4:]
+	return v, nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if len(*d) < 8 {
+		return 0, errShortPacket
+	}
+	v := be.Uint64(*d)
+	*d = (*d)[8:]
+	return v, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(*d)) < n {
+		return nil, errShortPacket
+	}
+	v := (*d)[:n]
+	*d = (*d)[n:]
+	return v, nil
+}
+
+func (d *decoder) string() (string, error) {
+	v, err := d.bytes()
+	return string(v), err
+}
+
+func (d *decoder) attrs() (*attrs, error) {
+	var a attrs
+	var err error
+	if a.flags, err = d.uint32(); err != nil {
+		return nil, err
+	}
+	if a.flags&attrSize != 0 {
+		if a.size, err = d.uint64(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrUIDGID != 0 {
+		if a.uid, err = d.uint32(); err != nil {
+			return nil, err
+		}
+		if a.gid, err = d.uint32(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if a.mode, err = d.uint32(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		if a.atime, err = d.uint32(); err != nil {
+			return nil, err
+		}
+		if a.mtime, err = d.uint32(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrExtended != 0 {
+		count, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			if _, err := d.bytes(); err != nil {
+				return nil, err
+			}
+			if _, err := d.bytes(); err != nil {
+				return nil, err
+			}
+		}
+		a.flags &^= attrExtended
+	}
+	return &a, nil
+}
+
+// attrs are the file attributes carried by the protocol. mode holds
+// POSIX st_mode bits.
+type attrs struct {
+	flags uint32
+	size  uint64
+	uid   uint32
+	gid   uint32
+	mode  uint32
+	atime uint32
+	mtime uint32
+}
+
+// POSIX file type bits
+const (
+	sIFMT   = 0170000
+	sIFSOCK = 0140000
+	sIFLNK  = 0120000
+	sIFREG  = 0100000
+	sIFBLK  = 0060000
+	sIFDIR  = 0040000
+	sIFCHR  = 0020000
+	sIFIFO  = 0010000
+	sISUID  = 0004000
+	sISGID  = 0002000
+	sISVTX  = 0001000
+)
+
+// fromFileMode converts an os.FileMode to st_mode bits.
+func fromFileMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	switch {
+	case m&os.ModeDir != 0:
+		mode |= sIFDIR
+	case m&os.ModeSymlink != 0:
+		mode |= sIFLNK
+	case m&os.ModeNamedPipe != 0:
+		mode |= sIFIFO
+	case m&os.ModeSocket != 0:
+		mode |= sIFSOCK
+	case m&os.ModeCharDevice != 0:
+		mode |= sIFCHR
+	case m&os.ModeDevice != 0:
+		mode |= sIFBLK
+	default:
+		mode |= sIFREG
+	}
+	if m&os.ModeSetuid != 0 {
+		mode |= sISUID
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= sISGID
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= sISVTX
+	}
+	return mode
+}
+
+// toFileMode converts st_mode bits to an os.FileMode.
+func toFileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0777)
+	switch mode & sIFMT {
+	case sIFDIR:
+		m |= os.ModeDir
+	case sIFLNK:
+		m |= os.ModeSymlink
+	case sIFIFO:
+		m |= os.ModeNamedPipe
+	case sIFSOCK:
+		m |= os.ModeSocket
+	case sIFCHR:
+		m |= os.ModeDevice | os.ModeCharDevice
+	case sIFBLK:
+		m |= os.ModeDevice
+	}
+	if mode&sISUID != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&sISGID != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&sISVTX != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// FileStat holds the attributes of a remote file that os.FileInfo
+// doesn't. It is returned by FileInfo.Sys.
+type FileStat struct {
+	UID   uint32
+	GID   uint32
+	Atime time.Time
+}
+
+// fileInfo implements os.FileInfo for a remote file.
+type fileInfo struct {
+	name string
+	a    *attrs
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.a.size) }
+func (fi *fileInfo) Mode() os.FileMode  { return toFileMode(fi.a.mode) }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(int64(fi.a.mtime), 0) }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi *fileInfo) Sys() interface{} {
+	return &FileStat{
+		UID:   fi.a.uid,
+		GID:   fi.a.gid,
+		Atime: time.Unix(int64(fi.a.atime), 0),
+	}
+}
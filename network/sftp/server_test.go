@@ -0,0 +1,456 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// server serves the local file system to a single client.
+type server struct {
+	w       io.Writer
+	handles map[string]interface{} // *os.File or *dirHandle
+	next    int
+}
+
+// dirHandle holds the entries of an open directory not yet sent.
+type dirHandle struct {
+	path    string
+	entries []os.FileInfo
+}
+
+// serve serves the local file system over SFTP, reading requests from r
+// and writing responses to w, until r reaches EOF. Paths are not
+// confined to any directory.
+func serve(r io.Reader, w io.Writer) error {
+	s := &server{w: w, handles: make(map[string]interface{})}
+	defer func() {
+		for _, h := range s.handles {
+			if f, ok := h.(*os.File); ok {
+				f.Close()
+			}
+		}
+	}()
+
+	typ, _, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if typ != fxpInit {
+		return fmt.Errorf("sftp: expected init packet, got type %d", typ)
+	}
+	p := newPacket(fxpVersion)
+	p.uint32(protocolVersion)
+	if err := writePacket(w, p); err != nil {
+		return err
+	}
+
+	for {
+		typ, d, err := readPacket(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		id, err := d.uint32()
+		if err != nil {
+			return err
+		}
+		if err := s.handle(typ, id, d); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers one request; only errors writing the response are
+// returned.
+func (s *server) handle(typ byte, id uint32, d decoder) error {
+	var err error
+	switch typ {
+	case fxpOpen:
+		return s.open(id, d)
+	case fxpClose:
+		return s.close(id, d)
+	case fxpRead:
+		return s.read(id, d)
+	case fxpWrite:
+		return s.write(id, d)
+	case fxpStat, fxpLstat:
+		var name string
+		if name, err = d.string(); err == nil {
+			var fi os.FileInfo
+			if typ == fxpStat {
+				fi, err = os.Stat(name)
+			} else {
+				fi, err = os.Lstat(name)
+			}
+			if err == nil {
+				return s.sendAttrs(id, fi)
+			}
+		}
+	case fxpFstat:
+		var f *os.File
+		if f, err = s.file(&d); err == nil {
+			var fi os.FileInfo
+			if fi, err = f.Stat(); err == nil {
+				return s.sendAttrs(id, fi)
+			}
+		}
+	case fxpSetstat:
+		err = s.setstat(d)
+	case fxpOpendir:
+		return s.opendir(id, d)
+	case fxpReaddir:
+		return s.readdir(id, d)
+	case fxpRemove:
+		var name string
+		if name, err = d.string(); err == nil {
+			err = syscall.Unlink(name)
+		}
+	case fxpMkdir:
+		var name string
+		var a *attrs
+		if name, err = d.string(); err == nil {
+			if a, err = d.attrs(); err == nil {
+				err = os.Mkdir(name, os.FileMode(a.mode&0777))
+			}
+		}
+	case fxpRmdir:
+		var name string
+		if name, err = d.string(); err == nil {
+			err = syscall.Rmdir(name)
+		}
+	case fxpRealpath:
+		var name string
+		if name, err = d.string(); err == nil {
+			if name, err = filepath.Abs(name); err == nil {
+				return s.sendName(id, name, nil)
+			}
+		}
+	case fxpRename:
+		var oldname, newname string
+		if oldname, err = d.string(); err == nil {
+			if newname, err = d.string(); err == nil {
+				err = os.Rename(oldname, newname)
+			}
+		}
+	case fxpReadlink:
+		var name string
+		if name, err = d.string(); err == nil {
+			if name, err = os.Readlink(name); err == nil {
+				return s.sendName(id, name, nil)
+			}
+		}
+	case fxpSymlink:
+		// target first, as OpenSSH does
+		var target, name string
+		if target, err = d.string(); err == nil {
+			if name, err = d.string(); err == nil {
+				err = os.Symlink(target, name)
+			}
+		}
+	default:
+		return s.sendStatus(id, StatusOpUnsupported, fmt.Sprintf("unsupported request type %d", typ))
+	}
+	return s.sendError(id, err)
+}
+
+func (s *server) open(id uint32, d decoder) error {
+	name, err := d.string()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	pflags, err := d.uint32()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	a, err := d.attrs()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+
+	var flag int
+	switch {
+	case pflags&fxfRead != 0 && pflags&fxfWrite != 0:
+		flag = os.O_RDWR
+	case pflags&fxfWrite != 0:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+	if pflags&fxfAppend != 0 {
+		flag |= os.O_APPEND
+	}
+	if pflags&fxfCreat != 0 {
+		flag |= os.O_CREATE
+	}
+	if pflags&fxfTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if pflags&fxfExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	perm := os.FileMode(0666)
+	if a.flags&attrPermissions != 0 {
+		perm = os.FileMode(a.mode & 0777)
+	}
+
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	return s.sendHandle(id, f)
+}
+
+func (s *server) close(id uint32, d decoder) error {
+	handle, err := d.string()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	h, ok := s.handles[handle]
+	if !ok {
+		return s.sendStatus(id, StatusFailure, "invalid handle")
+	}
+	delete(s.handles, handle)
+	if f, ok := h.(*os.File); ok {
+		err = f.Close()
+	}
+	return s.sendError(id, err)
+}
+
+func (s *server) file(d *decoder) (*os.File, error) {
+	handle, err := d.string()
+	if err != nil {
+		return nil, err
+	}
+	f, ok := s.handles[handle].(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("invalid handle")
+	}
+	return f, nil
+}
+
+func (s *server) read(id uint32, d decoder) error {
+	f, err := s.file(&d)
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	offset, err := d.uint64()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	length, err := d.uint32()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	if length > maxPacket {
+		length = maxPacket
+	}
+	buf := make([]byte, length)
+	n, err := f.ReadAt(buf, int64(offset))
+	if n == 0 && err == io.EOF {
+		return s.sendStatus(id, StatusEOF, "EOF")
+	} else if n == 0 && err != nil {
+		return s.sendError(id, err)
+	}
+	p := newPacket(fxpData)
+	p.uint32(id)
+	p.bytes(buf[:n])
+	return writePacket(s.w, p)
+}
+
+func (s *server) write(id uint32, d decoder) error {
+	f, err := s.file(&d)
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	offset, err := d.uint64()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	data, err := d.bytes()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	_, err = f.WriteAt(data, int64(offset))
+	return s.sendError(id, err)
+}
+
+func (s *server) setstat(d decoder) error {
+	name, err := d.string()
+	if err != nil {
+		return err
+	}
+	a, err := d.attrs()
+	if err != nil {
+		return err
+	}
+	if a.flags&attrSize != 0 {
+		if err := os.Truncate(name, int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if err := os.Chmod(name, toFileMode(a.mode)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrUIDGID != 0 {
+		if err := os.Chown(name, int(a.uid), int(a.gid)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		atime := time.Unix(int64(a.atime), 0)
+		mtime := time.Unix(int64(a.mtime), 0)
+		if err := os.Chtimes(name, atime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) opendir(id uint32, d decoder) error {
+	name, err := d.string()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	dh := &dirHandle{path: name}
+	for _, n := range names {
+		fi, err := os.Lstat(filepath.Join(name, n))
+		if err != nil {
+			continue // removed since
+		}
+		dh.entries = append(dh.entries, fi)
+	}
+	return s.sendHandle(id, dh)
+}
+
+func (s *server) readdir(id uint32, d decoder) error {
+	handle, err := d.string()
+	if err != nil {
+		return s.sendError(id, err)
+	}
+	dh, ok := s.handles[handle].(*dirHandle)
+	if !ok {
+		return s.sendStatus(id, StatusFailure, "invalid handle")
+	}
+	if len(dh.entries) == 0 {
+		return s.sendStatus(id, StatusEOF, "EOF")
+	}
+	batch := dh.entries
+	if len(batch) > 100 {
+		batch = batch[:100]
+	}
+	dh.entries = dh.entries[len(batch):]
+
+	p := newPacket(fxpName)
+	p.uint32(id)
+	p.uint32(uint32(len(batch)))
+	for _, fi := range batch {
+		p.string(fi.Name())
+		p.string(fi.Name())
+		p.attrs(fileAttrs(fi))
+	}
+	return writePacket(s.w, p)
+}
+
+// fileAttrs converts local file attributes for sending.
+func fileAttrs(fi os.FileInfo) *attrs {
+	a := &attrs{
+		flags: attrSize | attrPermissions | attrACModTime,
+		size:  uint64(fi.Size()),
+		mode:  fromFileMode(fi.Mode()),
+		atime: uint32(fi.ModTime().Unix()),
+		mtime: uint32(fi.ModTime().Unix()),
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		a.flags |= attrUIDGID
+		a.uid = st.Uid
+		a.gid = st.Gid
+		a.atime = uint32(st.Atim.Sec)
+	}
+	return a
+}
+
+func (s *server) sendHandle(id uint32, h interface{}) error {
+	s.next++
+	handle := strconv.Itoa(s.next)
+	s.handles[handle] = h
+	p := newPacket(fxpHandle)
+	p.uint32(id)
+	p.string(handle)
+	return writePacket(s.w, p)
+}
+
+func (s *server) sendAttrs(id uint32, fi os.FileInfo) error {
+	p := newPacket(fxpAttrs)
+	p.uint32(id)
+	p.attrs(fileAttrs(fi))
+	return writePacket(s.w, p)
+}
+
+func (s *server) sendName(id uint32, name string, a *attrs) error {
+	if a == nil {
+		a = &attrs{}
+	}
+	p := newPacket(fxpName)
+	p.uint32(id)
+	p.uint32(1)
+	p.string(name)
+	p.string(name)
+	p.attrs(a)
+	return writePacket(s.w, p)
+}
+
+// sendError sends the status matching err, which may be nil.
+func (s *server) sendError(id uint32, err error) error {
+	switch {
+	case err == nil:
+		return s.sendStatus(id, StatusOK, "Success")
+	case os.IsNotExist(err):
+		return s.sendStatus(id, StatusNoSuchFile, err.Error())
+	case os.IsPermission(err):
+		return s.sendStatus(id, StatusPermissionDenied, err.Error())
+	case err == errShortPacket:
+		return s.sendStatus(id, StatusBadMessage, err.Error())
+	default:
+		return s.sendStatus(id, StatusFailure, err.Error())
+	}
+}
+
+func (s *server) sendStatus(id uint32, code uint32, msg string) error {
+	p := newPacket(fxpStatus)
+	p.uint32(id)
+	p.uint32(code)
+	p.string(msg)
+	p.string("")
+	return writePacket(s.w, p)
+}
@@ -0,0 +1,317 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+// TransferOptions controls Upload and Download. Modes and modification
+// times are always preserved.
+type TransferOptions struct {
+	// PreserveOwner copies the numeric owner and group of each file.
+	// Otherwise files are owned by whoever the receiving side runs as.
+	PreserveOwner bool
+
+	// Verify reads each regular file back after copying it and
+	// compares its SHA-256 checksum with that of the data sent.
+	Verify bool
+
+	// Progress, if set, is called before copying each regular file and
+	// after each chunk of it is copied.
+	Progress func(Progress)
+}
+
+// Progress reports how much of a file has been copied.
+type Progress struct {
+	Path  string // source path
+	Bytes int64  // bytes copied so far
+	Size  int64  // size of the file when the copy started
+}
+
+// dirAttrs are applied to directories after their contents are copied,
+// so read-only modes and modification times stick.
+type dirAttrs struct {
+	path string
+	fi   os.FileInfo
+}
+
+// Upload copies the local file or directory tree local to remote.
+// Special files such as devices and sockets are skipped.
+func (c *Client) Upload(local, remote string, opts TransferOptions) error {
+	var dirs []dirAttrs
+	err := filepath.Walk(local, func(src string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(local, src)
+		if err != nil {
+			return err
+		}
+		dst := path.Join(remote, filepath.ToSlash(rel))
+
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			if err := c.MkdirAll(dst, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttrs{dst, fi})
+		case mode&os.ModeSymlink != 0:
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			if err := c.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return c.Symlink(target, dst)
+		case mode.IsRegular():
+			if err := c.uploadFile(src, dst, fi, opts); err != nil {
+				return err
+			}
+			return c.setAttrs(dst, fi, opts)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := c.setAttrs(dirs[i].path, dirs[i].fi, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) uploadFile(src, dst string, fi os.FileInfo, opts TransferOptions) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.Create(dst)
+	if err != nil {
+		return err
+	}
+	sum, err := copyFile(out, in, src, fi.Size(), opts)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Verify {
+		f, err := c.Open(dst)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return verify(f, dst, sum)
+	}
+	return nil
+}
+
+// setAttrs applies the owner, mode and times of fi to the remote dst.
+func (c *Client) setAttrs(dst string, fi os.FileInfo, opts TransferOptions) error {
+	if opts.PreserveOwner {
+		uid, gid, ok := localOwner(fi)
+		if !ok {
+			return fmt.Errorf("sftp: no owner known for %s", dst)
+		}
+		if err := c.Chown(dst, uid, gid); err != nil {
+			return err
+		}
+	}
+	if err := c.Chmod(dst, fi.Mode()); err != nil {
+		return err
+	}
+	return c.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// Download copies the remote file or directory tree remote to local.
+// Special files such as devices and sockets are skipped.
+func (c *Client) Download(remote, local string, opts TransferOptions) error {
+	fi, err := c.Lstat(remote)
+	if err != nil {
+		return err
+	}
+	var dirs []dirAttrs
+	if err := c.download(remote, local, fi, opts, &dirs); err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := setLocalAttrs(dirs[i].path, dirs[i].fi, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) download(src, dst string, fi os.FileInfo, opts TransferOptions, dirs *[]dirAttrs) error {
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		if err := os.MkdirAll(dst, 0700); err != nil {
+			return err
+		}
+		entries, err := c.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err := c.download(path.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), entry, opts, dirs)
+			if err != nil {
+				return err
+			}
+		}
+		*dirs = append(*dirs, dirAttrs{dst, fi})
+	case mode&os.ModeSymlink != 0:
+		target, err := c.ReadLink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+		if opts.PreserveOwner {
+			st := fi.Sys().(*FileStat)
+			return os.Lchown(dst, int(st.UID), int(st.GID))
+		}
+	case mode.IsRegular():
+		if err := c.downloadFile(src, dst, fi, opts); err != nil {
+			return err
+		}
+		return setLocalAttrs(dst, fi, opts)
+	}
+	return nil
+}
+
+func (c *Client) downloadFile(src, dst string, fi os.FileInfo, opts TransferOptions) error {
+	in, err := c.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	sum, err := copyFile(out, in, src, fi.Size(), opts)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Verify {
+		f, err := os.Open(dst)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return verify(f, dst, sum)
+	}
+	return nil
+}
+
+// setLocalAttrs applies the owner, mode and times of the remote fi to
+// the local dst.
+func setLocalAttrs(dst string, fi os.FileInfo, opts TransferOptions) error {
+	if opts.PreserveOwner {
+		st := fi.Sys().(*FileStat)
+		if err := os.Chown(dst, int(st.UID), int(st.GID)); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(dst, fi.Mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// copyFile copies src to dst, reporting progress, and returns the
+// SHA-256 checksum of the data copied. The remote side of the copy keeps
+// several requests outstanding.
+func copyFile(dst io.Writer, src io.Reader, name string, size int64, opts TransferOptions) ([]byte, error) {
+	p := &progressWriter{h: sha256.New(), name: name, size: size, report: opts.Progress}
+	if p.report != nil {
+		p.report(Progress{Path: name, Size: size})
+	}
+	var err error
+	if f, ok := dst.(*File); ok {
+		_, err = f.ReadFrom(io.TeeReader(src, p))
+	} else {
+		_, err = src.(*File).WriteTo(io.MultiWriter(dst, p))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.h.Sum(nil), nil
+}
+
+// progressWriter checksums the data copied by copyFile and reports
+// progress after each chunk.
+type progressWriter struct {
+	h      hash.Hash
+	name   string
+	copied int64
+	size   int64
+	report func(Progress)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.h.Write(b)
+	p.copied += int64(len(b))
+	if p.report != nil {
+		p.report(Progress{Path: p.name, Bytes: p.copied, Size: p.size})
+	}
+	return len(b), nil
+}
+
+// verify checks that the contents of r have the checksum sum.
+func verify(r io.Reader, name string, sum []byte) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, sum) {
+		return fmt.Errorf("sftp: checksum mismatch for %s: copied %x, found %x", name, sum, got)
+	}
+	return nil
+}
+
+// localOwner returns the numeric owner and group of a local file.
+func localOwner(fi os.FileInfo) (int, int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTree creates a small tree with a read-only directory, an
+// executable, a symlink and an old modification time.
+func writeTree(t *testing.T, root string) {
+	files := []struct {
+		name string
+		data string
+		mode os.FileMode
+	}{
+		{"bin/kolet", "#!/bin/sh\n", 0755},
+		{"log/messages", "hello\n", 0640},
+		{"log/journal/system.journal", "", 0600},
+	}
+	for _, f := range files {
+		name := filepath.Join(root, f.name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(f.data), f.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("messages", filepath.Join(root, "log/current")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Unix(1400000000, 0)
+	if err := os.Chtimes(filepath.Join(root, "log/messages"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(root, "bin"), 0555); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// compareTrees checks that want and got hold the same files, modes,
+// contents, link targets and modification times.
+func compareTrees(t *testing.T, want, got string) {
+	err := filepath.Walk(want, func(src string, wfi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(want, src)
+		gfi, err := os.Lstat(filepath.Join(got, rel))
+		if err != nil {
+			t.Errorf("%s: %v", rel, err)
+			return nil
+		}
+		if gfi.Mode() != wfi.Mode() {
+			t.Errorf("%s: mode %v, expected %v", rel, gfi.Mode(), wfi.Mode())
+		}
+		switch {
+		case wfi.Mode()&os.ModeSymlink != 0:
+			wt, _ := os.Readlink(src)
+			gt, _ := os.Readlink(filepath.Join(got, rel))
+			if wt != gt {
+				t.Errorf("%s: link to %q, expected %q", rel, gt, wt)
+			}
+			return nil
+		case wfi.Mode().IsRegular():
+			wd, _ := ioutil.ReadFile(src)
+			gd, _ := ioutil.ReadFile(filepath.Join(got, rel))
+			if string(wd) != string(gd) {
+				t.Errorf("%s: contents %q, expected %q", rel, gd, wd)
+			}
+		}
+		if gfi.ModTime().Unix() != wfi.ModTime().Unix() {
+			t.Errorf("%s: mtime %v, expected %v", rel, gfi.ModTime(), wfi.ModTime())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadDownload(t *testing.T) {
+	for _, server := range testServers {
+		t.Run(server, func(t *testing.T) {
+			c, dir, cleanup := newTestClient(t, server)
+			defer cleanup()
+			testUploadDownload(t, c, dir)
+		})
+	}
+}
+
+func testUploadDownload(t *testing.T, c *Client, dir string) { // let RemoveAll into the read-only directories
+	defer filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chmod(p, 0755)
+		}
+		return nil
+	})
+
+	src := filepath.Join(dir, "src")
+	writeTree(t, src)
+
+	progress := make(map[string]Progress)
+	opts := TransferOptions{
+		PreserveOwner: true,
+		Verify:        true,
+		Progress:      func(p Progress) { progress[p.Path] = p },
+	}
+	remote := filepath.Join(dir, "remote")
+	if err := c.Upload(src, remote, opts); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	compareTrees(t, src, remote)
+
+	messages := filepath.Join(src, "log/messages")
+	if p := progress[messages]; p.Bytes != 6 || p.Size != 6 {
+		t.Errorf("last progress for %s was %+v", messages, p)
+	}
+	if len(progress) != 3 {
+		t.Errorf("progress reported for %d files, expected 3", len(progress))
+	}
+
+	local := filepath.Join(dir, "local")
+	if err := c.Download(remote, local, opts); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	compareTrees(t, src, local)
+
+	// single files work too, and overwrite
+	file := filepath.Join(dir, "kolet")
+	for i := 0; i < 2; i++ {
+		if err := c.Upload(filepath.Join(src, "bin/kolet"), file, TransferOptions{}); err != nil {
+			t.Fatalf("Upload of a file failed: %v", err)
+		}
+	}
+	if fi, err := os.Stat(file); err != nil || fi.Mode() != 0755 {
+		t.Errorf("uploaded file: %v, %v", fi, err)
+	}
+}
+
+func TestDownloadMissing(t *testing.T) {
+	for _, server := range testServers {
+		t.Run(server, func(t *testing.T) {
+			c, dir, cleanup := newTestClient(t, server)
+			defer cleanup()
+
+			err := c.Download(filepath.Join(dir, "missing"), filepath.Join(dir, "local"), TransferOptions{})
+			if !os.IsNotExist(err) {
+				t.Errorf("Download of a missing file returned %v", err)
+			}
+		})
+	}
+}
@@ -15,13 +15,16 @@
 package network
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
@@ -31,6 +34,9 @@ const (
 	defaultPort = 22
 	defaultUser = "core"
 	rsaKeySize  = 2048
+
+	// how long to wait for a cached connection to answer a keepalive
+	keepaliveTimeout = 10 * time.Second
 )
 
 // Dialer is an interface for anything compatible with net.Dialer
@@ -40,6 +46,9 @@ type Dialer interface {
 
 // SSHAgent can manage keys, updates cloud config, and loves ponies.
 // The embedded dialer is used for establishing new SSH connections.
+//
+// The host key of each host is recorded on first connect and verified on
+// later ones.
 type SSHAgent struct {
 	agent.Agent
 	Dialer
@@ -47,29 +56,48 @@ type SSHAgent struct {
 	Socket   string
 	sockDir  string
 	listener *net.UnixListener
+	imported *importingAgent // if keys of the user's agent are offered
+
+	mu       sync.Mutex
+	hostKeys map[string]ssh.PublicKey
+	expected map[string]func() []string // fingerprints by address
+	clients  map[string]*cachedClient
 }
 
-// NewSSHAgent constructs a new SSHAgent using dialer to create ssh
-// connections.
+// cachedClient is a connection shared by CachedClient callers.
+type cachedClient struct {
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewSSHAgent constructs a new SSHAgent with a single RSA key using
+// dialer to create ssh connections.
 func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
-	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	return NewSSHAgentWithOptions(dialer, SSHAgentOptions{})
+}
+
+// NewSSHAgentWithOptions constructs a new SSHAgent with the keys given by
+// opts using dialer to create ssh connections.
+func NewSSHAgentWithOptions(dialer Dialer, opts SSHAgentOptions) (*SSHAgent, error) {
+	keyring, err := newKeyring(opts.KeyTypes)
 	if err != nil {
 		return nil, err
 	}
 
-	addedkey := agent.AddedKey{
-		PrivateKey: key,
-		Comment:    "core@default",
-	}
-
-	keyring := agent.NewKeyring()
-	err = keyring.Add(addedkey)
-	if err != nil {
-		return nil, err
+	var imported *importingAgent
+	if opts.ImportAgent {
+		imported, err = importAgent(keyring)
+		if err != nil {
+			return nil, err
+		}
+		keyring = imported
 	}
 
 	sockDir, err := ioutil.TempDir("", "mantle-ssh-")
 	if err != nil {
+		if imported != nil {
+			imported.conn.Close()
+		}
 		return nil, err
 	}
 
@@ -78,6 +106,9 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 	sockAddr := &net.UnixAddr{Name: sockPath, Net: "unix"}
 	listener, err := net.ListenUnix("unix", sockAddr)
 	if err != nil {
+		if imported != nil {
+			imported.conn.Close()
+		}
 		os.RemoveAll(sockDir)
 		return nil, err
 	}
@@ -89,6 +120,10 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 		Socket:   sockPath,
 		sockDir:  sockDir,
 		listener: listener,
+		imported: imported,
+		hostKeys: make(map[string]ssh.PublicKey),
+		expected: make(map[string]func() []string),
+		clients:  make(map[string]*cachedClient),
 	}
 
 	go func() {
@@ -104,12 +139,154 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 	return a, nil
 }
 
-// Close closes the unix socket of the agent.
+// Close closes the unix socket of the agent and any cached clients.
 func (a *SSHAgent) Close() error {
+	a.mu.Lock()
+	clients := a.clients
+	a.clients = make(map[string]*cachedClient)
+	a.mu.Unlock()
+	for _, cc := range clients {
+		cc.close()
+	}
+	if a.imported != nil {
+		a.imported.conn.Close()
+	}
+
 	a.listener.Close()
 	return os.RemoveAll(a.sockDir)
 }
 
+// HostKeyFingerprint returns the SHA256 fingerprint of key in the format
+// printed by ssh-keygen -l.
+func HostKeyFingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// checkHostKey is the ssh.HostKeyCallback of all clients. It records the
+// first host key seen for each address and rejects any other. If the
+// address has expected fingerprints, the first key must match one.
+func (a *SSHAgent) checkHostKey(addr string, remote net.Addr, key ssh.PublicKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if known, ok := a.hostKeys[addr]; ok {
+		if !bytes.Equal(known.Marshal(), key.Marshal()) {
+			return fmt.Errorf("host key of %s changed from %s to %s", addr, HostKeyFingerprint(known), HostKeyFingerprint(key))
+		}
+		return nil
+	}
+	if expected := a.expected[addr]; expected != nil {
+		if fingerprints := expected(); len(fingerprints) > 0 {
+			fingerprint := HostKeyFingerprint(key)
+			found := false
+			for _, f := range fingerprints {
+				if f == fingerprint {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("host key of %s is %s, expected one of %s", addr, fingerprint, strings.Join(fingerprints, ", "))
+			}
+		}
+	}
+	a.hostKeys[addr] = key
+	return nil
+}
+
+// ExpectHostKeys makes the first connection to host verify its host key
+// against the fingerprints returned by expected instead of trusting it.
+// If expected returns none, e.g. because the machine hasn't printed its
+// keys yet, the key is trusted as usual.
+func (a *SSHAgent) ExpectHostKeys(host string, expected func() []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expected[ensurePortSuffix(host, defaultPort)] = expected
+}
+
+// HostKey returns the host key recorded for host, or nil if it hasn't
+// been connected to.
+func (a *SSHAgent) HostKey(host string) ssh.PublicKey {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.hostKeys[ensurePortSuffix(host, defaultPort)]
+}
+
+// ForgetHost forgets the recorded and expected host keys of host and
+// closes its cached client, so that its address can be reused by a new
+// machine.
+func (a *SSHAgent) ForgetHost(host string) {
+	addr := ensurePortSuffix(host, defaultPort)
+	a.mu.Lock()
+	delete(a.hostKeys, addr)
+	delete(a.expected, addr)
+	cc := a.clients[addr]
+	delete(a.clients, addr)
+	a.mu.Unlock()
+	if cc != nil {
+		cc.close()
+	}
+}
+
+// CachedClient returns a client connected to host via SSH that is shared
+// by all callers and must not be closed. If the connection was lost, for
+// example because the host rebooted, a new one is made.
+func (a *SSHAgent) CachedClient(host string) (*ssh.Client, error) {
+	addr := ensurePortSuffix(host, defaultPort)
+	a.mu.Lock()
+	cc, ok := a.clients[addr]
+	if !ok {
+		cc = &cachedClient{}
+		a.clients[addr] = cc
+	}
+	a.mu.Unlock()
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.client != nil {
+		if alive(cc.client) {
+			return cc.client, nil
+		}
+		cc.client.Close()
+		cc.client = nil
+	}
+
+	client, err := a.NewClient(host)
+	if err != nil {
+		return nil, err
+	}
+	cc.client = client
+	return client, nil
+}
+
+func (cc *cachedClient) close() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.client != nil {
+		cc.client.Close()
+		cc.client = nil
+	}
+}
+
+// alive reports whether client's connection answers a keepalive. A host
+// that went away without closing the connection may never answer, so
+// give up after keepaliveTimeout.
+func alive(client *ssh.Client) bool {
+	result := make(chan error, 1)
+	go func() {
+		// servers reply to unknown requests with a failure, which is
+		// just as good
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err == nil
+	case <-time.After(keepaliveTimeout):
+		return false
+	}
+}
+
 // Add port to host if not already set.
 func ensurePortSuffix(host string, port int) string {
 	switch {
@@ -128,8 +305,9 @@ func ensurePortSuffix(host string, port int) string {
 
 func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (*ssh.Client, error) {
 	sshcfg := ssh.ClientConfig{
-		User: user,
-		Auth: auth,
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: a.checkHostKey,
 	}
 	addr := ensurePortSuffix(host, defaultPort)
 	tcpconn, err := a.Dial("tcp", addr)
@@ -139,6 +317,7 @@ func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (*
 
 	sshconn, chans, reqs, err := ssh.NewClientConn(tcpconn, addr, &sshcfg)
 	if err != nil {
+		tcpconn.Close()
 		return nil, err
 	}
 
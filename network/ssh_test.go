@@ -16,8 +16,11 @@ package network
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
 	"net"
+	"sync"
 	"testing"
 
 	"golang.org/x/crypto/ssh"
@@ -93,3 +96,208 @@ func TestSSHNewClient(t *testing.T) {
 	// Oh god... I give up for now.
 	t.Skip("Implementation incomplete")
 }
+
+// testServer is an SSH server on localhost that accepts any client and
+// opens sessions that do nothing.
+type testServer struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	hostKey ssh.Signer
+	conns   []net.Conn
+}
+
+func newTestServer(t *testing.T) *testServer {
+	hostKey, err := ssh.ParsePrivateKey(testHostKeyBytes)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey failed: %v", err)
+	}
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &testServer{listener: listener, hostKey: hostKey}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		cfg := ssh.ServerConfig{NoClientAuth: true}
+		cfg.AddHostKey(s.hostKey)
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(conn, &cfg)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			for newChannel := range chans {
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go ssh.DiscardRequests(requests)
+				defer channel.Close()
+			}
+		}()
+	}
+}
+
+// setHostKey makes the server present a new host key.
+func (s *testServer) setHostKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.hostKey = signer
+	s.mu.Unlock()
+}
+
+// dropConns closes all connections to the server, as a reboot would.
+func (s *testServer) dropConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	n := len(s.conns)
+	s.conns = nil
+	return n
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+	s.dropConns()
+}
+
+func TestSSHHostKeyVerification(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	host := s.listener.Addr().String()
+
+	a, err := NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+	defer a.Close()
+
+	client, err := a.NewClient(host)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	client.Close()
+	if a.HostKey(host) == nil {
+		t.Fatalf("host key wasn't recorded")
+	}
+
+	if client, err = a.NewClient(host); err != nil {
+		t.Fatalf("NewClient with the same host key failed: %v", err)
+	}
+	client.Close()
+
+	s.setHostKey(t)
+	if client, err = a.NewClient(host); err == nil {
+		client.Close()
+		t.Fatalf("NewClient accepted a changed host key")
+	}
+
+	a.ForgetHost(host)
+	if client, err = a.NewClient(host); err != nil {
+		t.Fatalf("NewClient failed after ForgetHost: %v", err)
+	}
+	client.Close()
+}
+
+func TestSSHExpectHostKeys(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	host := s.listener.Addr().String()
+
+	a, err := NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+	defer a.Close()
+
+	var fingerprints []string
+	a.ExpectHostKeys(host, func() []string { return fingerprints })
+
+	fingerprints = []string{"SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}
+	if client, err := a.NewClient(host); err == nil {
+		client.Close()
+		t.Fatalf("NewClient accepted an unexpected host key")
+	}
+	if a.HostKey(host) != nil {
+		t.Fatalf("unexpected host key was recorded")
+	}
+
+	fingerprints = append(fingerprints, HostKeyFingerprint(s.hostKey.PublicKey()))
+	client, err := a.NewClient(host)
+	if err != nil {
+		t.Fatalf("NewClient rejected an expected host key: %v", err)
+	}
+	client.Close()
+
+	// Nothing printed yet: trust on first use.
+	a.ForgetHost(host)
+	fingerprints = nil
+	a.ExpectHostKeys(host, func() []string { return fingerprints })
+	if client, err = a.NewClient(host); err != nil {
+		t.Fatalf("NewClient failed without expected host keys: %v", err)
+	}
+	client.Close()
+}
+
+func TestSSHCachedClient(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	host := s.listener.Addr().String()
+
+	a, err := NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+	defer a.Close()
+
+	first, err := a.CachedClient(host)
+	if err != nil {
+		t.Fatalf("CachedClient failed: %v", err)
+	}
+	second, err := a.CachedClient(host)
+	if err != nil {
+		t.Fatalf("CachedClient failed: %v", err)
+	}
+	if first != second {
+		t.Errorf("CachedClient didn't reuse the connection")
+	}
+	session, err := second.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	session.Close()
+
+	if n := s.dropConns(); n != 1 {
+		t.Errorf("got %d connections, expected 1", n)
+	}
+	third, err := a.CachedClient(host)
+	if err != nil {
+		t.Fatalf("CachedClient failed to reconnect: %v", err)
+	}
+	if third == first {
+		t.Errorf("CachedClient returned a closed connection")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// KeyType is a type of SSH key for an SSHAgent to generate.
+type KeyType string
+
+const (
+	KeyRSA     KeyType = "rsa"
+	KeyECDSA   KeyType = "ecdsa" // on the P-256 curve
+	KeyEd25519 KeyType = "ed25519"
+)
+
+// KeyTypes lists the supported key types.
+var KeyTypes = []KeyType{KeyRSA, KeyECDSA, KeyEd25519}
+
+// SSHAgentOptions configures the keys of an SSHAgent.
+type SSHAgentOptions struct {
+	// KeyTypes are the keys to generate, in order. The first key is
+	// named "core@default" and the others "core@<type>-<n>". Defaults
+	// to a single RSA key.
+	KeyTypes []KeyType
+
+	// ImportAgent also offers the keys of the agent at $SSH_AUTH_SOCK,
+	// after the generated ones.
+	ImportAgent bool
+}
+
+func generateKey(keyType KeyType) (interface{}, error) {
+	switch keyType {
+	case KeyRSA:
+		return rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case KeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unknown SSH key type %q", keyType)
+}
+
+// newKeyring returns a keyring holding newly generated keys of the given
+// types.
+func newKeyring(keyTypes []KeyType) (agent.Agent, error) {
+	if len(keyTypes) == 0 {
+		keyTypes = []KeyType{KeyRSA}
+	}
+
+	keyring := agent.NewKeyring()
+	for i, keyType := range keyTypes {
+		key, err := generateKey(keyType)
+		if err != nil {
+			return nil, err
+		}
+		comment := "core@default"
+		if i > 0 {
+			comment = fmt.Sprintf("core@%s-%d", keyType, i)
+		}
+		err = keyring.Add(agent.AddedKey{
+			PrivateKey: key,
+			Comment:    comment,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keyring, nil
+}
+
+// importingAgent is a keyring that also offers the keys of another
+// agent, such as the user's. Keys are only ever added to the keyring.
+type importingAgent struct {
+	agent.Agent
+	imported agent.Agent
+	conn     net.Conn
+}
+
+// importAgent returns keyring extended with the keys of the agent at
+// $SSH_AUTH_SOCK.
+func importAgent(keyring agent.Agent) (*importingAgent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("importing SSH agent keys: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("importing SSH agent keys: %v", err)
+	}
+	return &importingAgent{
+		Agent:    keyring,
+		imported: agent.NewClient(conn),
+		conn:     conn,
+	}, nil
+}
+
+func (a *importingAgent) List() ([]*agent.Key, error) {
+	keys, err := a.Agent.List()
+	if err != nil {
+		return nil, err
+	}
+	imported, err := a.imported.List()
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, imported...), nil
+}
+
+func (a *importingAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	sig, err := a.Agent.Sign(key, data)
+	if err != nil {
+		return a.imported.Sign(key, data)
+	}
+	return sig, nil
+}
+
+func (a *importingAgent) Signers() ([]ssh.Signer, error) {
+	signers, err := a.Agent.Signers()
+	if err != nil {
+		return nil, err
+	}
+	imported, err := a.imported.Signers()
+	if err != nil {
+		return nil, err
+	}
+	return append(signers, imported...), nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSSHAgentKeyTypes(t *testing.T) {
+	a, err := NewSSHAgentWithOptions(&net.Dialer{}, SSHAgentOptions{
+		KeyTypes: []KeyType{KeyEd25519, KeyECDSA, KeyRSA},
+	})
+	if err != nil {
+		t.Fatalf("NewSSHAgentWithOptions failed: %v", err)
+	}
+	defer a.Close()
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	expected := []struct {
+		format  string
+		comment string
+	}{
+		{ssh.KeyAlgoED25519, "core@default"},
+		{ssh.KeyAlgoECDSA256, "core@ecdsa-1"},
+		{ssh.KeyAlgoRSA, "core@rsa-2"},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, e := range expected {
+		if keys[i].Format != e.format || keys[i].Comment != e.comment {
+			t.Errorf("key %d is %s %s, expected %s %s", i, keys[i].Format, keys[i].Comment, e.format, e.comment)
+		}
+	}
+
+	if _, err := NewSSHAgentWithOptions(&net.Dialer{}, SSHAgentOptions{
+		KeyTypes: []KeyType{"dsa"},
+	}); err == nil {
+		t.Errorf("NewSSHAgentWithOptions accepted an unknown key type")
+	}
+}
+
+func TestSSHAgentImportAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-ssh-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	user, err := newKeyring([]KeyType{KeyEd25519})
+	if err != nil {
+		t.Fatalf("newKeyring failed: %v", err)
+	}
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(user, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	a, err := NewSSHAgentWithOptions(&net.Dialer{}, SSHAgentOptions{
+		ImportAgent: true,
+	})
+	if err != nil {
+		t.Fatalf("NewSSHAgentWithOptions failed: %v", err)
+	}
+	defer a.Close()
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Format != ssh.KeyAlgoRSA || keys[1].Format != ssh.KeyAlgoED25519 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// Signing with the imported key must go through the user's agent.
+	sig, err := a.Sign(keys[1], []byte("data"))
+	if err != nil {
+		t.Fatalf("Sign with imported key failed: %v", err)
+	}
+	if err := keys[1].Verify([]byte("data"), sig); err != nil {
+		t.Errorf("bad signature from imported key: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accounting records the cloud resources created by this process
+// so that their cost can be estimated and leaked resources found.
+package accounting
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of resources.
+const (
+	Instance      = "instance"
+	SSHKey        = "ssh-key"
+	SecurityGroup = "security-group"
+	Object        = "object"
+	ResourceGroup = "resource-group"
+)
+
+// Resource is a cloud resource created by this process.
+type Resource struct {
+	Platform   string     `json:"platform"`
+	Kind       string     `json:"kind"`
+	ID         string     `json:"id"`
+	Type       string     `json:"type,omitempty"`   // e.g. the instance type
+	Region     string     `json:"region,omitempty"` // region, zone or facility
+	Bytes      int64      `json:"bytes,omitempty"`  // size of uploaded objects
+	Persistent bool       `json:"persistent,omitempty"`
+	Created    time.Time  `json:"created"`
+	Destroyed  *time.Time `json:"destroyed,omitempty"`
+}
+
+type key struct {
+	platform, kind, id string
+}
+
+var (
+	mu        sync.Mutex
+	resources = map[key]*Resource{}
+)
+
+// Created records that r was created now. Persistent resources are meant
+// to outlive the run and are not reported as leaked.
+func Created(r Resource) {
+	if r.Created.IsZero() {
+		r.Created = time.Now()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	resources[key{r.Platform, r.Kind, r.ID}] = &r
+}
+
+// Destroyed records that a resource was destroyed now. Resources that
+// weren't recorded by Created are ignored.
+func Destroyed(platform, kind, id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if r, ok := resources[key{platform, kind, id}]; ok && r.Destroyed == nil {
+		now := time.Now()
+		r.Destroyed = &now
+	}
+}
+
+// Entry is a Resource in a Report.
+type Entry struct {
+	Resource
+	Hours         float64 `json:"hours"`
+	EstimatedCost float64 `json:"estimated_cost"`
+	Priced        bool    `json:"priced"` // whether a price was known
+	Leaked        bool    `json:"leaked,omitempty"`
+}
+
+// Report summarizes the recorded resources.
+type Report struct {
+	Currency           string  `json:"currency"`
+	TotalEstimatedCost float64 `json:"total_estimated_cost"`
+	Leaked             int     `json:"leaked"`
+	Resources          []Entry `json:"resources"`
+}
+
+// NewReport returns a Report of the resources recorded so far. Resources
+// that haven't been destroyed are counted until now and, unless they are
+// Persistent, reported as leaked.
+func NewReport() *Report {
+	now := time.Now()
+	report := &Report{
+		Currency:  "USD",
+		Resources: []Entry{},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range resources {
+		end := now
+		if r.Destroyed != nil {
+			end = *r.Destroyed
+		}
+		e := Entry{
+			Resource: *r,
+			Hours:    end.Sub(r.Created).Hours(),
+			Leaked:   r.Destroyed == nil && !r.Persistent,
+		}
+		e.EstimatedCost, e.Priced = estimate(&e)
+		report.TotalEstimatedCost += e.EstimatedCost
+		if e.Leaked {
+			report.Leaked++
+		}
+		report.Resources = append(report.Resources, e)
+	}
+
+	sort.Slice(report.Resources, func(i, j int) bool {
+		return report.Resources[i].Created.Before(report.Resources[j].Created)
+	})
+	return report
+}
+
+// WriteFile writes a Report of the recorded resources to path as JSON.
+func WriteFile(path string) (*Report, error) {
+	report := NewReport()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(report); err != nil {
+		return nil, err
+	}
+	return report, f.Close()
+}
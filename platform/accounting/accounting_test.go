@@ -0,0 +1,85 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	created := time.Now().Add(-2 * time.Hour)
+	Created(Resource{Platform: "aws", Kind: Instance, ID: "i-1", Type: "t2.micro", Created: created})
+	Created(Resource{Platform: "aws", Kind: Instance, ID: "i-2", Type: "t2.micro", Created: created})
+	Created(Resource{Platform: "aws", Kind: SecurityGroup, ID: "sg-1", Persistent: true, Created: created})
+	Created(Resource{Platform: "gce", Kind: Instance, ID: "odd", Type: "unknown", Created: created})
+	Destroyed("aws", Instance, "i-1")
+	Destroyed("gce", Instance, "odd")
+	Destroyed("aws", Instance, "never-created")
+
+	dir, err := ioutil.TempDir("", "accounting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "resources.json")
+
+	report, err := WriteFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Resources) != 4 {
+		t.Fatalf("got %d resources, expected 4", len(report.Resources))
+	}
+	if report.Leaked != 1 {
+		t.Errorf("got %d leaked resources, expected 1", report.Leaked)
+	}
+	for _, e := range report.Resources {
+		switch e.ID {
+		case "i-2":
+			if !e.Leaked {
+				t.Errorf("i-2 not reported as leaked")
+			}
+		case "sg-1":
+			if e.Leaked || !e.Priced || e.EstimatedCost != 0 {
+				t.Errorf("unexpected security group entry %+v", e)
+			}
+		case "odd":
+			if e.Priced {
+				t.Errorf("unknown instance type reported as priced")
+			}
+		}
+	}
+	want := 2 * 2 * hourlyPrices["aws"]["t2.micro"]
+	if d := report.TotalEstimatedCost - want; d < -0.001 || d > 0.001 {
+		t.Errorf("got total %v, expected about %v", report.TotalEstimatedCost, want)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Leaked != report.Leaked || len(decoded.Resources) != len(report.Resources) {
+		t.Errorf("%v doesn't match the returned report", path)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+// hourlyPrices are approximate on-demand USD prices per hour of the
+// instance types kola commonly uses. They are estimates for comparing
+// runs, not bills.
+var hourlyPrices = map[string]map[string]float64{
+	"aws": {
+		"t2.micro":  0.0116,
+		"t2.small":  0.023,
+		"t2.medium": 0.0464,
+		"m4.large":  0.10,
+		"m4.xlarge": 0.20,
+		"m5.large":  0.096,
+		"c4.large":  0.10,
+		"c5.large":  0.085,
+		"i3.large":  0.156,
+	},
+	"azure": {
+		"Standard_A1":     0.06,
+		"Standard_D1_v2":  0.073,
+		"Standard_D2_v2":  0.146,
+		"Standard_D2s_v3": 0.096,
+	},
+	"do": {
+		"512mb": 0.00744,
+		"1gb":   0.01488,
+		"2gb":   0.02976,
+		"4gb":   0.05952,
+		"8gb":   0.11905,
+	},
+	"gce": {
+		"f1-micro":      0.0076,
+		"g1-small":      0.0257,
+		"n1-standard-1": 0.0475,
+		"n1-standard-2": 0.095,
+		"n1-standard-4": 0.19,
+	},
+	"packet": {
+		"baremetal_0":  0.07,
+		"baremetal_1":  0.40,
+		"baremetal_2":  1.25,
+		"baremetal_2a": 0.50,
+		"baremetal_3":  1.75,
+		"c1.small.x86": 0.40,
+		"c1.large.arm": 0.50,
+		"t1.small.x86": 0.07,
+	},
+}
+
+// storagePrices are approximate USD prices per GB-month of object
+// storage.
+var storagePrices = map[string]float64{
+	"aws": 0.023,
+	"gce": 0.026,
+}
+
+// free are kinds of resources that cost nothing by themselves.
+var free = map[string]bool{
+	SSHKey:        true,
+	SecurityGroup: true,
+	ResourceGroup: true,
+}
+
+// estimate returns the estimated cost of e, and whether its price is
+// known. Instances on platforms we don't pay for, like esx, are free.
+func estimate(e *Entry) (float64, bool) {
+	switch {
+	case free[e.Kind]:
+		return 0, true
+	case e.Kind == Object:
+		price, ok := storagePrices[e.Platform]
+		const hoursPerMonth = 730
+		return float64(e.Bytes) / 1e9 * price * e.Hours / hoursPerMonth, ok
+	case e.Kind == Instance:
+		prices, ok := hourlyPrices[e.Platform]
+		if !ok {
+			return 0, e.Platform == "esx"
+		}
+		price, ok := prices[e.Type]
+		return price * e.Hours, ok
+	}
+	return 0, false
+}
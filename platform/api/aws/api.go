@@ -15,11 +15,13 @@
 package aws
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
@@ -28,6 +30,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/throttle"
 )
 
 var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/aws")
@@ -71,7 +74,13 @@ type API struct {
 // preflight check is recommended via api.PreflightCheck
 // Note that this method may modify Options to update the AMI ID
 func New(opts *Options) (*API, error) {
-	awsCfg := aws.Config{Region: aws.String(opts.Region)}
+	// The SDK retries throttled requests itself.
+	limiter := throttle.ForPlatform("aws")
+	awsCfg := aws.Config{
+		Region:     aws.String(opts.Region),
+		HTTPClient: &http.Client{Transport: limiter.Transport(nil, nil)},
+		MaxRetries: aws.Int(limiter.MaxRetries()),
+	}
 	if opts.AccessKeyID != "" {
 		awsCfg.Credentials = credentials.NewStaticCredentials(opts.AccessKeyID, opts.SecretKey, "")
 	} else if opts.CredentialsFile != "" {
@@ -85,6 +94,11 @@ func New(opts *Options) (*API, error) {
 	if err != nil {
 		return nil, err
 	}
+	sess.Handlers.AfterRetry.PushFront(func(r *request.Request) {
+		if r.IsErrorThrottle() {
+			limiter.Throttled(r.WillRetry())
+		}
+	})
 
 	opts.AMI = resolveAMI(opts.AMI, opts.Region)
 
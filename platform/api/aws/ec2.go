@@ -23,6 +23,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 
+	"github.com/coreos/mantle/platform/accounting"
 	"github.com/coreos/mantle/util"
 )
 
@@ -31,6 +32,14 @@ func (a *API) AddKey(name, key string) error {
 		KeyName:           &name,
 		PublicKeyMaterial: []byte(key),
 	})
+	if err == nil {
+		accounting.Created(accounting.Resource{
+			Platform: "aws",
+			Kind:     accounting.SSHKey,
+			ID:       name,
+			Region:   a.opts.Region,
+		})
+	}
 
 	return err
 }
@@ -39,6 +48,9 @@ func (a *API) DeleteKey(name string) error {
 	_, err := a.ec2.DeleteKeyPair(&ec2.DeleteKeyPairInput{
 		KeyName: &name,
 	})
+	if err == nil {
+		accounting.Destroyed("aws", accounting.SSHKey, name)
+	}
 
 	return err
 }
@@ -102,6 +114,13 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 	ids := make([]string, len(reservations.Instances))
 	for i, inst := range reservations.Instances {
 		ids[i] = *inst.InstanceId
+		accounting.Created(accounting.Resource{
+			Platform: "aws",
+			Kind:     accounting.Instance,
+			ID:       ids[i],
+			Type:     a.opts.InstanceType,
+			Region:   a.opts.Region,
+		})
 	}
 
 	// loop until all machines are online
@@ -192,6 +211,9 @@ func (a *API) TerminateInstances(ids []string) error {
 	if _, err := a.ec2.TerminateInstances(input); err != nil {
 		return err
 	}
+	for _, id := range ids {
+		accounting.Destroyed("aws", accounting.Instance, id)
+	}
 
 	return nil
 }
@@ -270,6 +292,13 @@ func (a *API) createSecurityGroup(name string) (string, error) {
 		return "", err
 	}
 	plog.Debugf("created security group %v", *sg.GroupId)
+	accounting.Created(accounting.Resource{
+		Platform:   "aws",
+		Kind:       accounting.SecurityGroup,
+		ID:         *sg.GroupId,
+		Region:     a.opts.Region,
+		Persistent: true,
+	})
 
 	allowedIngresses := []ec2.AuthorizeSecurityGroupIngressInput{
 		{
@@ -453,6 +453,24 @@ func (a *API) GrantLaunchPermission(imageID string, userIDs []string) error {
 	return nil
 }
 
+func (a *API) RevokeLaunchPermission(imageID string, userIDs []string) error {
+	arg := &ec2.ModifyImageAttributeInput{
+		Attribute:        aws.String("launchPermission"),
+		ImageId:          aws.String(imageID),
+		LaunchPermission: &ec2.LaunchPermissionModifications{},
+	}
+	for _, userID := range userIDs {
+		arg.LaunchPermission.Remove = append(arg.LaunchPermission.Remove, &ec2.LaunchPermission{
+			UserId: aws.String(userID),
+		})
+	}
+	_, err := a.ec2.ModifyImageAttribute(arg)
+	if err != nil {
+		return fmt.Errorf("couldn't revoke launch permission: %v", err)
+	}
+	return nil
+}
+
 func (a *API) CopyImage(sourceImageID string, regions []string) (map[string]string, error) {
 	type result struct {
 		region  string
@@ -631,6 +649,66 @@ func (a *API) FindImage(name string) (string, error) {
 	return "", nil
 }
 
+// ListImages returns the images we own that have all of the given tags.
+// An empty tag value matches any value.
+func (a *API) ListImages(tags map[string]string) ([]*ec2.Image, error) {
+	var filters []*ec2.Filter
+	for key, value := range tags {
+		if value == "" {
+			filters = append(filters, &ec2.Filter{
+				Name:   aws.String("tag-key"),
+				Values: aws.StringSlice([]string{key}),
+			})
+		} else {
+			filters = append(filters, &ec2.Filter{
+				Name:   aws.String("tag:" + key),
+				Values: aws.StringSlice([]string{value}),
+			})
+		}
+	}
+	describeRes, err := a.ec2.DescribeImages(&ec2.DescribeImagesInput{
+		Filters: filters,
+		Owners:  aws.StringSlice([]string{"self"}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't describe images: %v", err)
+	}
+	return describeRes.Images, nil
+}
+
+// DeleteImage deregisters the specified image and deletes the EBS
+// snapshots backing it. Snapshots still in use by another image, such as
+// the HVM and PV AMIs made from one snapshot, are left alone.
+func (a *API) DeleteImage(imageID string) error {
+	image, err := a.describeImage(imageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.ec2.DeregisterImage(&ec2.DeregisterImageInput{
+		ImageId: aws.String(imageID),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't deregister image %v: %v", imageID, err)
+	}
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs == nil || mapping.Ebs.SnapshotId == nil {
+			continue
+		}
+		_, err := a.ec2.DeleteSnapshot(&ec2.DeleteSnapshotInput{
+			SnapshotId: mapping.Ebs.SnapshotId,
+		})
+		if awserr, ok := err.(awserr.Error); ok && awserr.Code() == "InvalidSnapshot.InUse" {
+			plog.Infof("snapshot %v still in use, not deleting", *mapping.Ebs.SnapshotId)
+		} else if err != nil {
+			return fmt.Errorf("couldn't delete snapshot %v: %v", *mapping.Ebs.SnapshotId, err)
+		}
+	}
+
+	return nil
+}
+
 func (a *API) describeImage(imageID string) (*ec2.Image, error) {
 	describeRes, err := a.ec2.DescribeImages(&ec2.DescribeImagesInput{
 		ImageIds: aws.StringSlice([]string{imageID}),
@@ -641,6 +719,24 @@ func (a *API) describeImage(imageID string) (*ec2.Image, error) {
 	return describeRes.Images[0], nil
 }
 
+// IsImagePublic reports whether everyone has launch permission on the
+// specified image.
+func (a *API) IsImagePublic(imageID string) (bool, error) {
+	res, err := a.ec2.DescribeImageAttribute(&ec2.DescribeImageAttributeInput{
+		Attribute: aws.String("launchPermission"),
+		ImageId:   aws.String(imageID),
+	})
+	if err != nil {
+		return false, fmt.Errorf("couldn't describe launch permissions on %v: %v", imageID, err)
+	}
+	for _, perm := range res.LaunchPermissions {
+		if perm.Group != nil && *perm.Group == "all" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Grant everyone launch permission on the specified image and create-volume
 // permission on its underlying snapshot.
 func (a *API) PublishImage(imageID string) error {
@@ -697,3 +793,50 @@ func (a *API) PublishImage(imageID string) error {
 
 	return nil
 }
+
+// Revoke everyone's launch permission on the specified image and
+// create-volume permission on its underlying snapshot, undoing
+// PublishImage.
+func (a *API) UnpublishImage(imageID string) error {
+	_, err := a.ec2.ModifyImageAttribute(&ec2.ModifyImageAttributeInput{
+		Attribute: aws.String("launchPermission"),
+		ImageId:   aws.String(imageID),
+		LaunchPermission: &ec2.LaunchPermissionModifications{
+			Remove: []*ec2.LaunchPermission{
+				&ec2.LaunchPermission{
+					Group: aws.String("all"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't revoke launch permission on %v: %v", imageID, err)
+	}
+
+	image, err := a.describeImage(imageID)
+	if err != nil {
+		return err
+	}
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs == nil {
+			continue
+		}
+		_, err = a.ec2.ModifySnapshotAttribute(&ec2.ModifySnapshotAttributeInput{
+			Attribute:  aws.String("createVolumePermission"),
+			SnapshotId: mapping.Ebs.SnapshotId,
+			CreateVolumePermission: &ec2.CreateVolumePermissionModifications{
+				Remove: []*ec2.CreateVolumePermission{
+					&ec2.CreateVolumePermission{
+						Group: aws.String("all"),
+					},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't revoke create volume permission on %v: %v", *mapping.Ebs.SnapshotId, err)
+		}
+		break
+	}
+
+	return nil
+}
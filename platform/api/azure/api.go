@@ -15,45 +15,312 @@
 package azure
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/management"
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+
+	"github.com/coreos/mantle/platform/api/throttle"
+)
+
+const (
+	DefaultActiveDirectoryURL = "https://login.microsoftonline.com/"
+	DefaultResourceManagerURL = "https://management.azure.com/"
+
+	// Publisher details shown for the community galleries that images
+	// are shared through.
+	DefaultGalleryPublisherURI     = "https://coreos.com/"
+	DefaultGalleryPublisherContact = "security@coreos.com"
+	DefaultGalleryEULA             = "https://coreos.com/legal/"
+
+	// how long to wait between polls of a long-running operation when
+	// Azure doesn't tell us
+	defaultPollInterval = 10 * time.Second
+)
+
+// Resource Manager versions each resource provider's API separately.
+// Every request for a provider uses the same version.
+const (
+	computeAPIVersion       = "2022-03-01" // images, VMs and disks
+	galleryAPIVersion       = "2022-03-03" // galleries, including sharing
+	networkAPIVersion       = "2022-01-01"
+	resourcesAPIVersion     = "2021-04-01" // resource groups
+	storageAPIVersion       = "2021-09-01"
+	subscriptionsAPIVersion = "2021-01-01" // locations
 )
 
 var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/azure")
 )
 
+// API is a client for Azure Resource Manager.
 type API struct {
-	client management.Client
-	opts   *Options
+	client       *http.Client
+	opts         *Options
+	pollInterval time.Duration
+}
+
+// Error is an error response from Azure Resource Manager.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("azure: %s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
 }
 
-// New creates a new Azure client. If no publish settings file is provided or
-// can't be parsed, an anonymous client is created.
 func New(opts *Options) (*API, error) {
-	conf := management.DefaultConfig()
-	conf.APIVersion = "2015-04-01"
+	if opts.SubscriptionID == "" {
+		return nil, errors.New("azure: subscription ID is required")
+	}
+	if opts.TenantID == "" || opts.ClientID == "" || opts.ClientSecret == "" {
+		return nil, errors.New("azure: service principal credentials are required")
+	}
+
+	if opts.ActiveDirectoryURL == "" {
+		opts.ActiveDirectoryURL = DefaultActiveDirectoryURL
+	}
 
-	if opts.ManagementURL != "" {
-		conf.ManagementURL = opts.ManagementURL
+	if opts.ResourceManagerURL == "" {
+		opts.ResourceManagerURL = DefaultResourceManagerURL
 	}
 
 	if opts.StorageEndpointSuffix == "" {
 		opts.StorageEndpointSuffix = storage.DefaultBaseURL
 	}
 
-	client, err := management.NewClientFromConfig(opts.SubscriptionID, opts.ManagementCertificate, conf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create azure client: %v", err)
+	if opts.GalleryPublisherURI == "" {
+		opts.GalleryPublisherURI = DefaultGalleryPublisherURI
 	}
 
-	api := &API{
-		client: client,
+	if opts.GalleryPublisherContact == "" {
+		opts.GalleryPublisherContact = DefaultGalleryPublisherContact
+	}
+
+	if opts.GalleryEULA == "" {
+		opts.GalleryEULA = DefaultGalleryEULA
+	}
+
+	src := &tokenSource{
+		client: http.DefaultClient,
 		opts:   opts,
 	}
 
+	client := oauth2.NewClient(context.Background(), oauth2.ReuseTokenSource(nil, src))
+	client.Transport = throttle.ForPlatform("azure").Transport(client.Transport, throttle.TooManyRequests)
+
+	api := &API{
+		client:       client,
+		opts:         opts,
+		pollInterval: defaultPollInterval,
+	}
+
 	return api, nil
 }
+
+// tokenSource fetches Resource Manager tokens for a service principal
+// using the OAuth2 client credentials grant.
+type tokenSource struct {
+	client *http.Client
+	opts   *Options
+}
+
+func (ts *tokenSource) Token() (*oauth2.Token, error) {
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/token", strings.TrimSuffix(ts.opts.ActiveDirectoryURL, "/"), ts.opts.TenantID)
+	resp, err := ts.client.PostForm(tokenURL, map[string][]string{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {ts.opts.ClientID},
+		"client_secret": {ts.opts.ClientSecret},
+		"resource":      {ts.opts.ResourceManagerURL},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("azure: fetching token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("azure: fetching token: %s: %s", resp.Status, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		// Azure AD v1 encodes this as a string
+		ExpiresIn json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("azure: decoding token: %v", err)
+	}
+	expiresIn, err := token.ExpiresIn.Int64()
+	if err != nil {
+		return nil, fmt.Errorf("azure: decoding token expiry: %v", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
+
+// resourceID returns the ID of a resource in the configured resource
+// group, e.g. resourceID("Microsoft.Compute", "images", name).
+func (a *API) resourceID(provider string, path ...string) string {
+	return a.groupResourceID(a.opts.ResourceGroup, provider, path...)
+}
+
+// groupResourceID returns the ID of a resource in the named resource
+// group.
+func (a *API) groupResourceID(group, provider string, path ...string) string {
+	return fmt.Sprintf("%s/providers/%s/%s", a.groupID(group), provider, strings.Join(path, "/"))
+}
+
+func (a *API) groupID(group string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", a.opts.SubscriptionID, group)
+}
+
+// request sends a request for a resource ID to Resource Manager, waits
+// for any resulting long-running operation, and decodes the resulting
+// resource into out if it is non-nil.
+func (a *API) request(method, id, apiVersion string, in, out interface{}) error {
+	resp, err := a.send(method, a.url(id, apiVersion), in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	async := resp.Header.Get("Azure-AsyncOperation")
+	location := resp.Header.Get("Location")
+	if async == "" && (resp.StatusCode != http.StatusAccepted || location == "") {
+		if out == nil || resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	if err := a.wait(async, location, a.retryAfter(resp)); err != nil {
+		return fmt.Errorf("%s %s: %v", method, id, err)
+	}
+	if out == nil || method == "DELETE" {
+		return nil
+	}
+	return a.request("GET", id, apiVersion, nil, out)
+}
+
+func (a *API) url(id, apiVersion string) string {
+	return fmt.Sprintf("%s%s?api-version=%s", strings.TrimSuffix(a.opts.ResourceManagerURL, "/"), id, apiVersion)
+}
+
+func (a *API) send(method, url string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	plog.Debugf("%s %s", method, url)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var azerr struct {
+			Error Error `json:"error"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(data, &azerr); err != nil || azerr.Error.Code == "" {
+			azerr.Error.Code = resp.Status
+			azerr.Error.Message = string(data)
+		}
+		azerr.Error.StatusCode = resp.StatusCode
+		return nil, &azerr.Error
+	}
+
+	return resp, nil
+}
+
+// wait polls a long-running operation until it finishes. async is the
+// Azure-AsyncOperation URL if one was returned, otherwise location is
+// polled until it stops returning 202 Accepted.
+func (a *API) wait(async, location string, interval time.Duration) error {
+	for {
+		time.Sleep(interval)
+
+		if async != "" {
+			resp, err := a.send("GET", async, nil)
+			if err != nil {
+				return err
+			}
+			var status struct {
+				Status string `json:"status"`
+				Error  *Error `json:"error"`
+			}
+			err = json.NewDecoder(resp.Body).Decode(&status)
+			interval = a.retryAfter(resp)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+
+			switch status.Status {
+			case "Succeeded":
+				return nil
+			case "Failed", "Canceled":
+				if status.Error != nil {
+					return status.Error
+				}
+				return fmt.Errorf("operation %s", strings.ToLower(status.Status))
+			}
+			plog.Debugf("operation %s", strings.ToLower(status.Status))
+		} else {
+			resp, err := a.send("GET", location, nil)
+			if err != nil {
+				return err
+			}
+			interval = a.retryAfter(resp)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				return nil
+			}
+		}
+	}
+}
+
+func (a *API) retryAfter(resp *http.Response) time.Duration {
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return a.pollInterval
+}
+
+func isNotFoundError(err error) bool {
+	azerr, ok := err.(*Error)
+	return ok && azerr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,297 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorded is a request received by the test Resource Manager.
+type recorded struct {
+	Method     string
+	Path       string
+	APIVersion string
+	Body       map[string]interface{}
+}
+
+// testARM is a fake Resource Manager that serves responses from handler
+// and records every request it receives.
+type testARM struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []recorded
+}
+
+func newTestAPI(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*API, *testARM) {
+	arm := &testARM{}
+	arm.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recorded{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			APIVersion: r.URL.Query().Get("api-version"),
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&rec.Body); err != nil {
+				t.Errorf("%s %s: decoding body: %v", r.Method, r.URL.Path, err)
+			}
+		}
+		arm.mu.Lock()
+		arm.requests = append(arm.requests, rec)
+		arm.mu.Unlock()
+		handler(w, r)
+	}))
+
+	api := &API{
+		client: http.DefaultClient,
+		opts: &Options{
+			SubscriptionID:          "sub",
+			ResourceGroup:           "group",
+			Location:                "westus",
+			ResourceManagerURL:      arm.URL + "/",
+			GalleryPublisherURI:     DefaultGalleryPublisherURI,
+			GalleryPublisherContact: DefaultGalleryPublisherContact,
+			GalleryEULA:             DefaultGalleryEULA,
+		},
+		pollInterval: time.Millisecond,
+	}
+	return api, arm
+}
+
+func (arm *testARM) recorded() []recorded {
+	arm.mu.Lock()
+	defer arm.mu.Unlock()
+	return append([]recorded(nil), arm.requests...)
+}
+
+const testImagePath = "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Compute/images/image"
+
+func TestRequest(t *testing.T) {
+	api, arm := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case testImagePath:
+			fmt.Fprint(w, `{"name": "image", "location": "westus", "properties": {"provisioningState": "Succeeded"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": {"code": "ResourceNotFound", "message": "not here"}}`)
+		}
+	})
+	defer arm.Close()
+
+	image, err := api.GetImage("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Name != "image" || image.Properties.ProvisioningState != "Succeeded" {
+		t.Errorf("unexpected image %+v", image)
+	}
+	if reqs := arm.recorded(); len(reqs) != 1 || reqs[0].APIVersion != computeAPIVersion {
+		t.Errorf("unexpected requests %+v", reqs)
+	}
+
+	_, err = api.GetImage("missing")
+	azerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %#v", err)
+	}
+	if azerr.StatusCode != http.StatusNotFound || azerr.Code != "ResourceNotFound" || azerr.Message != "not here" {
+		t.Errorf("unexpected error %+v", azerr)
+	}
+	if exists, err := api.ImageExists("missing"); err != nil || exists {
+		t.Errorf("ImageExists(missing) = %v, %v", exists, err)
+	}
+}
+
+func TestRequestAsyncOperation(t *testing.T) {
+	for _, tt := range []struct {
+		final string
+		fail  bool
+	}{
+		{final: `{"status": "Succeeded"}`},
+		{final: `{"status": "Failed", "error": {"code": "InternalError", "message": "boom"}}`, fail: true},
+		{final: `{"status": "Canceled"}`, fail: true},
+	} {
+		var mu sync.Mutex
+		polls := 0
+		api, arm := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/operations/1":
+				mu.Lock()
+				polls++
+				n := polls
+				mu.Unlock()
+				if n < 3 {
+					fmt.Fprint(w, `{"status": "InProgress"}`)
+				} else {
+					fmt.Fprint(w, tt.final)
+				}
+			case r.Method == "PUT":
+				w.Header().Set("Azure-AsyncOperation", "http://"+r.Host+"/operations/1")
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"name": "image", "properties": {"provisioningState": "Creating"}}`)
+			default:
+				fmt.Fprint(w, `{"name": "image", "properties": {"provisioningState": "Succeeded"}}`)
+			}
+		})
+
+		image, err := api.CreateImage("image", "https://account.blob.core.windows.net/vhds/image.vhd", nil)
+		arm.Close()
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.final)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.final, err)
+		}
+		if polls != 3 {
+			t.Errorf("%s: polled %d times, expected 3", tt.final, polls)
+		}
+		// The resource is fetched again once the operation finishes.
+		if image.Properties.ProvisioningState != "Succeeded" {
+			t.Errorf("%s: unexpected image %+v", tt.final, image)
+		}
+	}
+}
+
+func TestRequestLocation(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	api, arm := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/operations/2":
+			mu.Lock()
+			polls++
+			n := polls
+			mu.Unlock()
+			if n < 2 {
+				w.WriteHeader(http.StatusAccepted)
+			}
+		case r.Method == "DELETE":
+			w.Header().Set("Location", "http://"+r.Host+"/operations/2")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer arm.Close()
+
+	if err := api.DeleteImage("image"); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 2 {
+		t.Errorf("polled %d times, expected 2", polls)
+	}
+}
+
+func TestReplicateAndShareImage(t *testing.T) {
+	api, arm := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	defer arm.Close()
+
+	if err := api.ReplicateImage("image", "CoreOS", "Alpha", "1688.0.0", "westus", "eastus"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.ShareImage("CoreOS", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.ShareImage("CoreOS", "everyone"); err == nil {
+		t.Error("unknown permission was accepted")
+	}
+
+	gallery := "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Compute/galleries/CoreOS"
+	reqs := arm.recorded()
+	var paths []string
+	for _, req := range reqs {
+		paths = append(paths, req.Method+" "+req.Path)
+		if req.APIVersion != galleryAPIVersion {
+			t.Errorf("%s %s: api-version %q, expected %q", req.Method, req.Path, req.APIVersion, galleryAPIVersion)
+		}
+	}
+	expected := []string{
+		"PUT " + gallery,
+		"PUT " + gallery + "/images/Alpha",
+		"PUT " + gallery + "/images/Alpha/versions/1688.0.0",
+		"POST " + gallery + "/share",
+	}
+	if strings.Join(paths, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected requests:\n%s\nexpected:\n%s", strings.Join(paths, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// Community sharing only works on galleries created with a
+	// community sharing profile.
+	props := reqs[0].Body["properties"].(map[string]interface{})
+	sharing, ok := props["sharingProfile"].(map[string]interface{})
+	if !ok || sharing["permissions"] != "Community" {
+		t.Fatalf("gallery created without community sharing: %v", props)
+	}
+	info, ok := sharing["communityGalleryInfo"].(map[string]interface{})
+	if !ok || info["publicNamePrefix"] != "CoreOS" || info["publisherUri"] != DefaultGalleryPublisherURI ||
+		info["publisherContact"] != DefaultGalleryPublisherContact || info["eula"] != DefaultGalleryEULA {
+		t.Errorf("unexpected community gallery info: %v", sharing["communityGalleryInfo"])
+	}
+
+	version, err := json.Marshal(reqs[2].Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedVersion := `{"location":"westus","properties":{` +
+		`"publishingProfile":{"excludeFromLatest":false,"targetRegions":[` +
+		`{"name":"westus","regionalReplicaCount":1},{"name":"eastus","regionalReplicaCount":1}]},` +
+		`"storageProfile":{"source":{"id":"` + testImagePath + `"}}}}`
+	if string(version) != expectedVersion {
+		t.Errorf("unexpected image version:\n%s\nexpected:\n%s", version, expectedVersion)
+	}
+
+	if op := reqs[3].Body["operationType"]; op != "EnableCommunity" {
+		t.Errorf("shared with operation %v, expected EnableCommunity", op)
+	}
+}
+
+func TestExcludeImageVersion(t *testing.T) {
+	api, arm := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	defer arm.Close()
+
+	if err := api.ExcludeImageVersion("CoreOS", "Alpha", "1688.0.0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the flag is sent, leaving the source and regions of the
+	// version as they were.
+	reqs := arm.recorded()
+	if len(reqs) != 1 {
+		t.Fatalf("unexpected requests %+v", reqs)
+	}
+	update, err := json.Marshal(reqs[0].Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Compute/galleries/CoreOS/images/Alpha/versions/1688.0.0"
+	expected := `{"properties":{"publishingProfile":{"excludeFromLatest":true}}}`
+	if reqs[0].Method != "PATCH" || reqs[0].Path != path || string(update) != expected {
+		t.Errorf("sent %s %s %s, expected PATCH %s %s", reqs[0].Method, reqs[0].Path, update, path, expected)
+	}
+}
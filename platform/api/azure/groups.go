@@ -0,0 +1,116 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"time"
+
+	"github.com/coreos/mantle/platform/accounting"
+)
+
+const (
+	// tags marking resources created by mantle, used by GC
+	createdByTag   = "createdBy"
+	createdByValue = "mantle"
+)
+
+type resourceGroup struct {
+	ID       string            `json:"id,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Location string            `json:"location"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// CreateResourceGroup creates a resource group named after prefix in the
+// configured location and returns its name.
+func (a *API) CreateResourceGroup(prefix string) (string, error) {
+	b := make([]byte, 5)
+	rand.Read(b)
+	name := fmt.Sprintf("%s-%x", prefix, b)
+
+	group := resourceGroup{
+		Location: a.opts.Location,
+		Tags: map[string]string{
+			createdByTag: createdByValue,
+			CreatedTag:   time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	plog.Debugf("Creating resource group %q", name)
+	if err := a.request("PUT", a.groupID(name), resourcesAPIVersion, &group, nil); err != nil {
+		return "", fmt.Errorf("creating resource group %q: %v", name, err)
+	}
+	accounting.Created(accounting.Resource{
+		Platform: "azure",
+		Kind:     accounting.ResourceGroup,
+		ID:       name,
+		Region:   a.opts.Location,
+	})
+	return name, nil
+}
+
+// TerminateResourceGroup starts deleting a resource group and everything
+// in it. It doesn't wait for the deletion to finish.
+func (a *API) TerminateResourceGroup(name string) error {
+	plog.Debugf("Terminating resource group %q", name)
+
+	resp, err := a.send("DELETE", a.url(a.groupID(name), resourcesAPIVersion), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	accounting.Destroyed("azure", accounting.ResourceGroup, name)
+	return nil
+}
+
+// GC deletes resource groups created by mantle more than gracePeriod ago.
+func (a *API) GC(gracePeriod time.Duration) error {
+	threshold := time.Now().Add(-gracePeriod)
+
+	filter := fmt.Sprintf("tagName eq '%s' and tagValue eq '%s'", createdByTag, createdByValue)
+	url := a.url("/subscriptions/"+a.opts.SubscriptionID+"/resourcegroups", resourcesAPIVersion) +
+		"&$filter=" + neturl.QueryEscape(filter)
+	for url != "" {
+		resp, err := a.send("GET", url, nil)
+		if err != nil {
+			return fmt.Errorf("listing resource groups: %v", err)
+		}
+		var page struct {
+			Value    []resourceGroup `json:"value"`
+			NextLink string          `json:"nextLink"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("listing resource groups: %v", err)
+		}
+
+		for _, group := range page.Value {
+			created, err := time.Parse(time.RFC3339, group.Tags[CreatedTag])
+			if err != nil || created.After(threshold) {
+				continue
+			}
+			if err := a.TerminateResourceGroup(group.Name); err != nil {
+				return fmt.Errorf("couldn't terminate resource group %q: %v", group.Name, err)
+			}
+		}
+		url = page.NextLink
+	}
+	return nil
+}
@@ -15,54 +15,125 @@
 package azure
 
 import (
-	"encoding/xml"
-	"fmt"
-
-	"github.com/Azure/azure-sdk-for-go/management"
+	"encoding/json"
+	"net/http"
+	"time"
 )
 
-// OSImage struct for https://msdn.microsoft.com/en-us/library/azure/jj157192.aspx call.
-//
-// XXX: the field ordering is important!
-type OSImage struct {
-	XMLName           xml.Name `xml:"http://schemas.microsoft.com/windowsazure OSImage"`
-	Category          string   `xml:",omitempty"` // Public || Private || MSDN
-	Label             string   `xml:",omitempty"` // Specifies an identifier for the image.
-	MediaLink         string   `xml:",omitempty"` // Specifies the location of the vhd file for the image. The storage account where the vhd is located must be associated with the specified subscription.
-	Name              string   // Specifies the name of the operating system image. This is the name that is used when creating one or more virtual machines using the image.
-	OS                string   // Linux || Windows
-	Eula              string   `xml:",omitempty"` // Specifies the End User License Agreement that is associated with the image. The value for this element is a string, but it is recommended that the value be a URL that points to a EULA.
-	Description       string   `xml:",omitempty"` // Specifies the description of the image.
-	ImageFamily       string   `xml:",omitempty"` // Specifies a value that can be used to group images.
-	PublishedDate     string   `xml:",omitempty"` // Specifies the date when the image was added to the image repository.
-	ShowInGui         bool     // Specifies whether the image should appear in the image gallery.
-	PrivacyURI        string   `xml:"PrivacyUri,omitempty"`   // Specifies the URI that points to a document that contains the privacy policy related to the image.
-	IconURI           string   `xml:"IconUri,omitempty"`      // Specifies the Uri to the icon that is displayed for the image in the Management Portal.
-	RecommendedVMSize string   `xml:",omitempty"`             // Specifies the size to use for the virtual machine that is created from the image.
-	SmallIconURI      string   `xml:"SmallIconUri,omitempty"` // Specifies the URI to the small icon that is displayed when the image is presented in the Microsoft Azure Management Portal.
-	Language          string   `xml:",omitempty"`             // Specifies the language of the image.
+// CreatedTag records when CreateImage made an image, since managed
+// images don't report their creation time.
+const CreatedTag = "Created"
+
+// Image is a managed image, see
+// https://docs.microsoft.com/en-us/rest/api/compute/images
+type Image struct {
+	ID         string            `json:"id,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Location   string            `json:"location"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Properties ImageProperties   `json:"properties"`
+}
+
+type ImageProperties struct {
+	StorageProfile    ImageStorageProfile `json:"storageProfile"`
+	ProvisioningState string              `json:"provisioningState,omitempty"`
+}
 
-	LogicalSizeInGB   float64 `xml:",omitempty"` //Specifies the size, in GB, of the image.
-	Location          string  `xml:",omitempty"` // The geo-location in which this media is located. The Location value is derived from storage account that contains the blob in which the media is located. If the storage account belongs to an affinity group the value is NULL.
-	AffinityGroup     string  `xml:",omitempty"` // Specifies the affinity in which the media is located. The AffinityGroup value is derived from storage account that contains the blob in which the media is located. If the storage account does not belong to an affinity group the value is NULL and the element is not displayed in the response. This value is NULL for platform images.
-	IsPremium         string  `xml:",omitempty"` // Indicates whether the image contains software or associated services that will incur charges above the core price for the virtual machine. For additional details, see the PricingDetailLink element.
-	PublisherName     string  `xml:",omitempty"` // The name of the publisher of the image. All user images have a publisher name of User.
-	PricingDetailLink string  `xml:",omitempty"` // Specifies a URL for an image with IsPremium set to true, which contains the pricing details for a virtual machine that is created from the image.
+type ImageStorageProfile struct {
+	OSDisk ImageOSDisk `json:"osDisk"`
 }
 
-var azureImageShareURL = "services/images/%s/share?permission=%s"
+type ImageOSDisk struct {
+	OSType  string `json:"osType"`
+	OSState string `json:"osState"`
+	BlobURI string `json:"blobUri,omitempty"`
+}
+
+// Created returns the time recorded in the image's CreatedTag, or the
+// zero time if there isn't one.
+func (i *Image) Created() time.Time {
+	t, _ := time.Parse(time.RFC3339, i.Tags[CreatedTag])
+	return t
+}
+
+// CreateImage creates a generalized Linux managed image from a VHD blob.
+// The blob's storage account must be in the configured location.
+func (a *API) CreateImage(name, blobURI string, tags map[string]string) (*Image, error) {
+	image := Image{
+		Location: a.opts.Location,
+		Tags: map[string]string{
+			CreatedTag: time.Now().UTC().Format(time.RFC3339),
+		},
+		Properties: ImageProperties{
+			StorageProfile: ImageStorageProfile{
+				OSDisk: ImageOSDisk{
+					OSType:  "Linux",
+					OSState: "Generalized",
+					BlobURI: blobURI,
+				},
+			},
+		},
+	}
+	for k, v := range tags {
+		image.Tags[k] = v
+	}
 
-func (a *API) ShareImage(image, permission string) error {
-	url := fmt.Sprintf(azureImageShareURL, image, permission)
-	op, err := a.client.SendAzurePutRequest(url, "", nil)
+	var created Image
+	err := a.request("PUT", a.resourceID("Microsoft.Compute", "images", name), computeAPIVersion, &image, &created)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &created, nil
+}
+
+func (a *API) GetImage(name string) (*Image, error) {
+	var image Image
+	err := a.request("GET", a.resourceID("Microsoft.Compute", "images", name), computeAPIVersion, nil, &image)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (a *API) ImageExists(name string) (bool, error) {
+	_, err := a.GetImage(name)
+	if isNotFoundError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListImages returns the managed images in the configured resource group.
+func (a *API) ListImages() ([]*Image, error) {
+	var images []*Image
+	url := a.url(a.resourceID("Microsoft.Compute", "images"), computeAPIVersion)
+	for url != "" {
+		resp, err := a.send("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Value    []*Image `json:"value"`
+			NextLink string   `json:"nextLink"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, page.Value...)
+		url = page.NextLink
+	}
+	return images, nil
+}
 
-	return a.client.WaitForOperation(op, nil)
+func (a *API) DeleteImage(name string) error {
+	return a.request("DELETE", a.resourceID("Microsoft.Compute", "images", name), computeAPIVersion, nil, nil)
 }
 
 func IsConflictError(err error) bool {
-	azerr, ok := err.(management.AzureError)
-	return ok && azerr.Code == "ConflictError"
+	azerr, ok := err.(*Error)
+	return ok && (azerr.StatusCode == http.StatusConflict || azerr.Code == "Conflict")
 }
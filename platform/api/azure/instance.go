@@ -0,0 +1,190 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/mantle/platform/accounting"
+)
+
+// Machine is an instance created by CreateInstance.
+type Machine struct {
+	ID               string
+	PublicIPAddress  string
+	PrivateIPAddress string
+}
+
+func (a *API) vmname() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", a.opts.BaseName, b)
+}
+
+// imageID returns the resource ID of the configured image, which may be
+// given as the name of a managed image in the configured resource group.
+func (a *API) imageID() string {
+	if strings.HasPrefix(a.opts.Image, "/subscriptions/") {
+		return a.opts.Image
+	}
+	return a.resourceID("Microsoft.Compute", "images", a.opts.Image)
+}
+
+func (a *API) mkinstance(name, userdata, sshkey, nicID string) map[string]interface{} {
+	return map[string]interface{}{
+		"location": a.opts.Location,
+		"tags": map[string]string{
+			createdByTag: createdByValue,
+		},
+		"properties": map[string]interface{}{
+			"hardwareProfile": map[string]string{
+				"vmSize": a.opts.Size,
+			},
+			"storageProfile": map[string]interface{}{
+				"imageReference": subResource{ID: a.imageID()},
+				"osDisk": map[string]interface{}{
+					"name":         name,
+					"createOption": "FromImage",
+					"managedDisk": map[string]string{
+						"storageAccountType": "Standard_LRS",
+					},
+				},
+			},
+			"osProfile": map[string]interface{}{
+				"computerName":  name,
+				"adminUsername": "core",
+				"customData":    base64.StdEncoding.EncodeToString([]byte(userdata)),
+				"linuxConfiguration": map[string]interface{}{
+					"disablePasswordAuthentication": true,
+					"ssh": map[string]interface{}{
+						"publicKeys": []map[string]string{
+							{
+								"path":    "/home/core/.ssh/authorized_keys",
+								"keyData": sshkey,
+							},
+						},
+					},
+				},
+			},
+			"networkProfile": map[string]interface{}{
+				"networkInterfaces": []subResource{{ID: nicID}},
+			},
+			"diagnosticsProfile": map[string]interface{}{
+				"bootDiagnostics": map[string]bool{
+					"enabled": true,
+				},
+			},
+		},
+	}
+}
+
+// CreateInstance creates an instance in resourceGroup attached to the
+// subnet from PrepareNetworkResources. Azure requires an SSH key even if
+// it will never be used.
+func (a *API) CreateInstance(userdata, sshkey, resourceGroup, subnetID string) (*Machine, error) {
+	name := a.vmname()
+
+	plog.Debugf("Creating instance %q", name)
+
+	nicID, err := a.createNIC(name, resourceGroup, subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	id := a.groupResourceID(resourceGroup, "Microsoft.Compute", "virtualMachines", name)
+	if err := a.request("PUT", id, computeAPIVersion, a.mkinstance(name, userdata, sshkey, nicID), nil); err != nil {
+		a.TerminateInstance(name, resourceGroup)
+		return nil, fmt.Errorf("failed to create instance %q: %v", name, err)
+	}
+	accounting.Created(accounting.Resource{
+		Platform: "azure",
+		Kind:     accounting.Instance,
+		ID:       name,
+		Type:     a.opts.Size,
+		Region:   a.opts.Location,
+	})
+
+	intIP, extIP, err := a.instanceIPs(name, resourceGroup)
+	if err != nil {
+		a.TerminateInstance(name, resourceGroup)
+		return nil, err
+	}
+
+	plog.Debugf("Created instance %q", name)
+
+	return &Machine{
+		ID:               name,
+		PublicIPAddress:  extIP,
+		PrivateIPAddress: intIP,
+	}, nil
+}
+
+// TerminateInstance deletes an instance along with its disk and network
+// resources.
+func (a *API) TerminateInstance(name, resourceGroup string) error {
+	plog.Debugf("Terminating instance %q", name)
+
+	id := a.groupResourceID(resourceGroup, "Microsoft.Compute", "virtualMachines", name)
+	if err := a.request("DELETE", id, computeAPIVersion, nil, nil); err != nil && !isNotFoundError(err) {
+		return err
+	}
+	accounting.Destroyed("azure", accounting.Instance, name)
+
+	diskID := a.groupResourceID(resourceGroup, "Microsoft.Compute", "disks", name)
+	if err := a.request("DELETE", diskID, computeAPIVersion, nil, nil); err != nil && !isNotFoundError(err) {
+		return err
+	}
+
+	if err := a.deleteNIC(name, resourceGroup); err != nil && !isNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// GetConsoleOutput returns the serial console log captured by boot
+// diagnostics.
+func (a *API) GetConsoleOutput(name, resourceGroup string) (string, error) {
+	var diag struct {
+		SerialConsoleLogBlobURI string `json:"serialConsoleLogBlobUri"`
+	}
+	id := a.groupResourceID(resourceGroup, "Microsoft.Compute", "virtualMachines", name, "retrieveBootDiagnosticsData")
+	if err := a.request("POST", id, computeAPIVersion, nil, &diag); err != nil {
+		return "", fmt.Errorf("failed to retrieve boot diagnostics for %q: %v", name, err)
+	}
+	if diag.SerialConsoleLogBlobURI == "" {
+		return "", fmt.Errorf("no serial console log for %q", name)
+	}
+
+	// the blob URI carries its own SAS token, so don't send ours
+	resp, err := http.Get(diag.SerialConsoleLogBlobURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve console output for %q: %v", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to retrieve console output for %q: %s", name, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
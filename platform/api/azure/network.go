@@ -0,0 +1,145 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"fmt"
+)
+
+const (
+	virtualNetworkPrefix = "10.0.0.0/16"
+	subnetPrefix         = "10.0.0.0/24"
+)
+
+type subResource struct {
+	ID string `json:"id"`
+}
+
+type publicIPAddress struct {
+	Location   string `json:"location"`
+	Properties struct {
+		PublicIPAllocationMethod string `json:"publicIPAllocationMethod"`
+		IPAddress                string `json:"ipAddress,omitempty"`
+	} `json:"properties"`
+}
+
+type networkInterface struct {
+	Location   string `json:"location"`
+	Properties struct {
+		IPConfigurations []networkInterfaceIPConfiguration `json:"ipConfigurations"`
+	} `json:"properties"`
+}
+
+type networkInterfaceIPConfiguration struct {
+	Name       string `json:"name"`
+	Properties struct {
+		PrivateIPAddress          string       `json:"privateIPAddress,omitempty"`
+		PrivateIPAllocationMethod string       `json:"privateIPAllocationMethod"`
+		Subnet                    subResource  `json:"subnet"`
+		PublicIPAddress           *subResource `json:"publicIPAddress,omitempty"`
+	} `json:"properties"`
+}
+
+// PrepareNetworkResources creates the virtual network and subnet that
+// instances in a resource group attach to, and returns the subnet ID.
+func (a *API) PrepareNetworkResources(resourceGroup string) (string, error) {
+	vnet := map[string]interface{}{
+		"location": a.opts.Location,
+		"properties": map[string]interface{}{
+			"addressSpace": map[string]interface{}{
+				"addressPrefixes": []string{virtualNetworkPrefix},
+			},
+			"subnets": []interface{}{
+				map[string]interface{}{
+					"name": "kola",
+					"properties": map[string]string{
+						"addressPrefix": subnetPrefix,
+					},
+				},
+			},
+		},
+	}
+
+	id := a.groupResourceID(resourceGroup, "Microsoft.Network", "virtualNetworks", "kola")
+	if err := a.request("PUT", id, networkAPIVersion, vnet, nil); err != nil {
+		return "", fmt.Errorf("creating virtual network: %v", err)
+	}
+	return id + "/subnets/kola", nil
+}
+
+// createNIC creates a public IP address and a network interface using it
+// for an instance, and returns the interface ID.
+func (a *API) createNIC(name, resourceGroup, subnetID string) (string, error) {
+	var ip publicIPAddress
+	ip.Location = a.opts.Location
+	ip.Properties.PublicIPAllocationMethod = "Static"
+
+	ipID := a.groupResourceID(resourceGroup, "Microsoft.Network", "publicIPAddresses", name)
+	if err := a.request("PUT", ipID, networkAPIVersion, &ip, nil); err != nil {
+		return "", fmt.Errorf("creating public IP address: %v", err)
+	}
+
+	var ipConfig networkInterfaceIPConfiguration
+	ipConfig.Name = "ipconfig"
+	ipConfig.Properties.PrivateIPAllocationMethod = "Dynamic"
+	ipConfig.Properties.Subnet.ID = subnetID
+	ipConfig.Properties.PublicIPAddress = &subResource{ID: ipID}
+
+	var nic networkInterface
+	nic.Location = a.opts.Location
+	nic.Properties.IPConfigurations = []networkInterfaceIPConfiguration{ipConfig}
+
+	nicID := a.groupResourceID(resourceGroup, "Microsoft.Network", "networkInterfaces", name)
+	if err := a.request("PUT", nicID, networkAPIVersion, &nic, nil); err != nil {
+		return "", fmt.Errorf("creating network interface: %v", err)
+	}
+	return nicID, nil
+}
+
+// instanceIPs returns the private and public IP addresses of the network
+// interface and public IP address created by createNIC.
+func (a *API) instanceIPs(name, resourceGroup string) (intIP, extIP string, err error) {
+	var nic networkInterface
+	nicID := a.groupResourceID(resourceGroup, "Microsoft.Network", "networkInterfaces", name)
+	if err := a.request("GET", nicID, networkAPIVersion, nil, &nic); err != nil {
+		return "", "", err
+	}
+	for _, ipConfig := range nic.Properties.IPConfigurations {
+		intIP = ipConfig.Properties.PrivateIPAddress
+	}
+
+	var ip publicIPAddress
+	ipID := a.groupResourceID(resourceGroup, "Microsoft.Network", "publicIPAddresses", name)
+	if err := a.request("GET", ipID, networkAPIVersion, nil, &ip); err != nil {
+		return "", "", err
+	}
+	extIP = ip.Properties.IPAddress
+
+	if intIP == "" || extIP == "" {
+		return "", "", fmt.Errorf("instance %q has no IP addresses", name)
+	}
+	return intIP, extIP, nil
+}
+
+// deleteNIC deletes the network interface and public IP address created
+// by createNIC.
+func (a *API) deleteNIC(name, resourceGroup string) error {
+	nicID := a.groupResourceID(resourceGroup, "Microsoft.Network", "networkInterfaces", name)
+	if err := a.request("DELETE", nicID, networkAPIVersion, nil, nil); err != nil {
+		return err
+	}
+	ipID := a.groupResourceID(resourceGroup, "Microsoft.Network", "publicIPAddresses", name)
+	return a.request("DELETE", ipID, networkAPIVersion, nil, nil)
+}
@@ -24,10 +24,35 @@ type Options struct {
 	SubscriptionName string
 	SubscriptionID   string
 
-	// Azure API endpoint. If unset, the Azure SDK default will be used.
-	ManagementURL         string
-	ManagementCertificate []byte
+	// Service principal used to authenticate to Azure Resource Manager.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// Azure Active Directory and Resource Manager endpoints. If unset,
+	// the public Azure cloud is used.
+	ActiveDirectoryURL string
+	ResourceManagerURL string
+
+	// Resource group and location of created resources.
+	ResourceGroup string
+	Location      string
+
+	// Azure profile and subscription name to read credentials from when
+	// they aren't set above. Only used by kola.
+	ConfigPath string
+
+	// Managed image name in ResourceGroup, or full image resource ID, and
+	// VM size of kola instances.
+	Image string
+	Size  string
 
 	// Azure Storage API endpoint suffix. If unset, the Azure SDK default will be used.
 	StorageEndpointSuffix string
+
+	// Publisher details of community galleries created for replicated
+	// images. If unset, the CoreOS defaults are used.
+	GalleryPublisherURI     string
+	GalleryPublisherContact string
+	GalleryEULA             string
 }
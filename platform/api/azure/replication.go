@@ -15,72 +15,174 @@
 package azure
 
 import (
-	"encoding/xml"
 	"fmt"
-
-	"github.com/Azure/azure-sdk-for-go/management/location"
 )
 
-var (
-	azureImageReplicateURL   = "services/images/%s/replicate"
-	azureImageUnreplicateURL = "services/images/%s/unreplicate"
-)
+// Images are replicated by publishing them as versions in a shared image
+// gallery. The gallery is named after the offer and holds one image
+// definition per SKU, so that e.g. the CoreOS alpha 1688.0.0 image is
+// CoreOS/alpha/1688.0.0. Galleries are created shareable with the Azure
+// community so that ShareImage can make them public.
+
+type galleryImageVersion struct {
+	Location   string                        `json:"location"`
+	Properties galleryImageVersionProperties `json:"properties"`
+}
+
+type galleryImageVersionProperties struct {
+	PublishingProfile galleryPublishingProfile `json:"publishingProfile"`
+	StorageProfile    galleryStorageProfile    `json:"storageProfile"`
+}
+
+type galleryPublishingProfile struct {
+	TargetRegions     []galleryTargetRegion `json:"targetRegions,omitempty"`
+	ExcludeFromLatest bool                  `json:"excludeFromLatest"`
+}
 
-type ReplicationInput struct {
-	XMLName         xml.Name `xml:"http://schemas.microsoft.com/windowsazure ReplicationInput"`
-	TargetLocations []string `xml:"TargetLocations>Region"`
-	Offer           string   `xml:"ComputeImageAttributes>Offer"`
-	Sku             string   `xml:"ComputeImageAttributes>Sku"`
-	Version         string   `xml:"ComputeImageAttributes>Version"`
+type galleryStorageProfile struct {
+	Source struct {
+		ID string `json:"id"` // of the managed image
+	} `json:"source"`
+}
+
+type galleryTargetRegion struct {
+	Name                 string `json:"name"`
+	RegionalReplicaCount int    `json:"regionalReplicaCount"`
 }
 
 // Locations returns a slice of Azure Locations, useful for replicating to all Locations.
 func (a *API) Locations() ([]string, error) {
-	lc := location.NewClient(a.client)
-
-	llr, err := lc.ListLocations()
-	if err != nil {
+	var res struct {
+		Value []struct {
+			Name string `json:"name"`
+		} `json:"value"`
+	}
+	id := fmt.Sprintf("/subscriptions/%s/locations", a.opts.SubscriptionID)
+	if err := a.request("GET", id, subscriptionsAPIVersion, nil, &res); err != nil {
 		return nil, err
 	}
 
 	var locations []string
-
-	for _, l := range llr.Locations {
+	for _, l := range res.Value {
 		locations = append(locations, l.Name)
 	}
 
 	return locations, nil
 }
 
+// ReplicateImage publishes the managed image as the given version of the
+// offer and SKU, replicated to regions. The gallery and image definition
+// are created if needed.
 func (a *API) ReplicateImage(image, offer, sku, version string, regions ...string) error {
-	ri := ReplicationInput{
-		TargetLocations: regions,
-		Offer:           offer,
-		Sku:             sku,
-		Version:         version,
+	if err := a.ensureGalleryImage(offer, sku); err != nil {
+		return err
 	}
 
-	data, err := xml.Marshal(&ri)
-	if err != nil {
-		return err
+	var giv galleryImageVersion
+	giv.Location = a.opts.Location
+	giv.Properties.StorageProfile.Source.ID = a.resourceID("Microsoft.Compute", "images", image)
+	for _, region := range regions {
+		giv.Properties.PublishingProfile.TargetRegions = append(giv.Properties.PublishingProfile.TargetRegions, galleryTargetRegion{
+			Name:                 region,
+			RegionalReplicaCount: 1,
+		})
 	}
 
-	url := fmt.Sprintf(azureImageReplicateURL, image)
+	id := a.resourceID("Microsoft.Compute", "galleries", offer, "images", sku, "versions", version)
+	return a.request("PUT", id, galleryAPIVersion, &giv, nil)
+}
 
-	op, err := a.client.SendAzurePutRequest(url, "", data)
-	if err != nil {
-		return err
+// UnreplicateImage removes the given version of the offer and SKU from
+// every region.
+func (a *API) UnreplicateImage(offer, sku, version string) error {
+	id := a.resourceID("Microsoft.Compute", "galleries", offer, "images", sku, "versions", version)
+	return a.request("DELETE", id, galleryAPIVersion, nil, nil)
+}
+
+// ExcludeImageVersion controls whether a version of the offer and SKU is
+// picked when users ask for the latest version.
+func (a *API) ExcludeImageVersion(offer, sku, version string, exclude bool) error {
+	id := a.resourceID("Microsoft.Compute", "galleries", offer, "images", sku, "versions", version)
+
+	// PATCH so the rest of the version, which a PUT would have to
+	// repeat in full, is left alone.
+	update := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"publishingProfile": map[string]interface{}{
+				"excludeFromLatest": exclude,
+			},
+		},
 	}
+	return a.request("PATCH", id, galleryAPIVersion, update, nil)
+}
 
-	return a.client.WaitForOperation(op, nil)
+// ImageVersionExists reports whether a version of the offer and SKU has
+// been published.
+func (a *API) ImageVersionExists(offer, sku, version string) (bool, error) {
+	id := a.resourceID("Microsoft.Compute", "galleries", offer, "images", sku, "versions", version)
+	err := a.request("GET", id, galleryAPIVersion, nil, &galleryImageVersion{})
+	if isNotFoundError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (a *API) UnreplicateImage(image string) error {
-	url := fmt.Sprintf(azureImageUnreplicateURL, image)
-	op, err := a.client.SendAzurePutRequest(url, "", []byte{})
-	if err != nil {
-		return err
+func (a *API) ensureGalleryImage(offer, sku string) error {
+	gallery := map[string]interface{}{
+		"location": a.opts.Location,
+		"properties": map[string]interface{}{
+			"description": offer,
+			"sharingProfile": map[string]interface{}{
+				"permissions": "Community",
+				"communityGalleryInfo": map[string]string{
+					"publisherUri":     a.opts.GalleryPublisherURI,
+					"publisherContact": a.opts.GalleryPublisherContact,
+					"eula":             a.opts.GalleryEULA,
+					"publicNamePrefix": offer,
+				},
+			},
+		},
+	}
+	id := a.resourceID("Microsoft.Compute", "galleries", offer)
+	if err := a.request("PUT", id, galleryAPIVersion, gallery, nil); err != nil {
+		return fmt.Errorf("creating gallery %q: %v", offer, err)
+	}
+
+	definition := map[string]interface{}{
+		"location": a.opts.Location,
+		"properties": map[string]interface{}{
+			"osType":  "Linux",
+			"osState": "Generalized",
+			"identifier": map[string]string{
+				"publisher": offer,
+				"offer":     offer,
+				"sku":       sku,
+			},
+		},
+	}
+	id = a.resourceID("Microsoft.Compute", "galleries", offer, "images", sku)
+	if err := a.request("PUT", id, galleryAPIVersion, definition, nil); err != nil {
+		return fmt.Errorf("creating image definition %q: %v", sku, err)
+	}
+	return nil
+}
+
+// ShareImage sets who can use the images in the gallery of an offer.
+// Permission "public" shares the gallery with the Azure community and
+// "private" limits it to the subscription again.
+func (a *API) ShareImage(offer, permission string) error {
+	var op string
+	switch permission {
+	case "public":
+		op = "EnableCommunity"
+	case "private":
+		op = "Reset"
+	default:
+		return fmt.Errorf("unknown permission %q", permission)
 	}
 
-	return a.client.WaitForOperation(op, nil)
+	id := a.resourceID("Microsoft.Compute", "galleries", offer, "share")
+	return a.request("POST", id, galleryAPIVersion, map[string]string{"operationType": op}, nil)
 }
@@ -15,60 +15,43 @@
 package azure
 
 import (
-	"encoding/xml"
 	"fmt"
 	"net/url"
 	"path"
-
-	"github.com/Azure/azure-sdk-for-go/management"
-	"github.com/Azure/azure-sdk-for-go/management/storageservice"
-)
-
-var (
-	azureImageURL = "services/images"
 )
 
-func (a *API) GetStorageServiceKeys(account string) (storageservice.GetStorageServiceKeysResponse, error) {
-	return storageservice.NewClient(a.client).GetStorageServiceKeys(account)
+type StorageServiceKeys struct {
+	PrimaryKey   string
+	SecondaryKey string
 }
 
-// https://msdn.microsoft.com/en-us/library/azure/jj157192.aspx
-func (a *API) AddOSImage(md *OSImage) error {
-	data, err := xml.Marshal(md)
-	if err != nil {
-		return err
+// GetStorageServiceKeys looks up the access keys of a storage account in
+// the configured resource group.
+func (a *API) GetStorageServiceKeys(account string) (StorageServiceKeys, error) {
+	var res struct {
+		Keys []struct {
+			KeyName string `json:"keyName"`
+			Value   string `json:"value"`
+		} `json:"keys"`
 	}
-
-	op, err := a.client.SendAzurePostRequest(azureImageURL, data)
-	if err != nil {
-		return err
+	id := a.resourceID("Microsoft.Storage", "storageAccounts", account, "listKeys")
+	if err := a.request("POST", id, storageAPIVersion, nil, &res); err != nil {
+		return StorageServiceKeys{}, err
 	}
 
-	return a.client.WaitForOperation(op, nil)
-}
-
-func (a *API) OSImageExists(name string) (bool, error) {
-	url := fmt.Sprintf("%s/%s", azureImageURL, name)
-	response, err := a.client.SendAzureGetRequest(url)
-	if err != nil {
-		if management.IsResourceNotFoundError(err) {
-			return false, nil
+	var keys StorageServiceKeys
+	for _, key := range res.Keys {
+		switch key.KeyName {
+		case "key1":
+			keys.PrimaryKey = key.Value
+		case "key2":
+			keys.SecondaryKey = key.Value
 		}
-
-		return false, err
-	}
-
-	var image OSImage
-
-	if err := xml.Unmarshal(response, &image); err != nil {
-		return false, err
 	}
-
-	if image.Name == name {
-		return true, nil
+	if keys.PrimaryKey == "" {
+		return keys, fmt.Errorf("no primary key found for storage account %q", account)
 	}
-
-	return false, nil
+	return keys, nil
 }
 
 func (a *API) UrlOfBlob(account, container, blob string) *url.URL {
@@ -29,6 +29,8 @@ import (
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/accounting"
+	"github.com/coreos/mantle/platform/api/throttle"
 	"github.com/coreos/mantle/util"
 )
 
@@ -80,7 +82,9 @@ func New(opts *Options) (*API, error) {
 	}
 
 	ctx := context.TODO()
-	client := godo.NewClient(oauth2.NewClient(ctx, &tokenSource{opts.AccessToken}))
+	httpClient := oauth2.NewClient(ctx, &tokenSource{opts.AccessToken})
+	httpClient.Transport = throttle.ForPlatform("do").Transport(httpClient.Transport, throttle.TooManyRequests)
+	client := godo.NewClient(httpClient)
 
 	a := &API{
 		c:    client,
@@ -156,6 +160,13 @@ func (a *API) CreateDroplet(ctx context.Context, name string, sshKeyID int, user
 		return nil, fmt.Errorf("couldn't create droplet: %v", err)
 	}
 	dropletID := droplet.ID
+	accounting.Created(accounting.Resource{
+		Platform: "do",
+		Kind:     accounting.Instance,
+		ID:       strconv.Itoa(dropletID),
+		Type:     a.opts.Size,
+		Region:   a.opts.Region,
+	})
 
 	err = util.WaitUntilReady(5*time.Minute, 10*time.Second, func() (bool, error) {
 		var err error
@@ -236,6 +247,7 @@ func (a *API) DeleteDroplet(ctx context.Context, dropletID int) error {
 	if err != nil {
 		return fmt.Errorf("deleting droplet %d: %v", dropletID, err)
 	}
+	accounting.Destroyed("do", accounting.Instance, strconv.Itoa(dropletID))
 	return nil
 }
 
@@ -298,6 +310,11 @@ func (a *API) AddKey(ctx context.Context, name, key string) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("couldn't create SSH key: %v", err)
 	}
+	accounting.Created(accounting.Resource{
+		Platform: "do",
+		Kind:     accounting.SSHKey,
+		ID:       strconv.Itoa(sshKey.ID),
+	})
 	return sshKey.ID, nil
 }
 
@@ -306,6 +323,7 @@ func (a *API) DeleteKey(ctx context.Context, keyID int) error {
 	if err != nil {
 		return fmt.Errorf("couldn't delete SSH key: %v", err)
 	}
+	accounting.Destroyed("do", accounting.SSHKey, strconv.Itoa(keyID))
 	return nil
 }
 
@@ -39,6 +39,8 @@ import (
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/accounting"
+	"github.com/coreos/mantle/platform/api/throttle"
 	"github.com/coreos/mantle/platform/conf"
 )
 
@@ -154,6 +156,10 @@ func New(opts *Options) (*API, error) {
 	if err != nil {
 		return nil, fmt.Errorf("connecting to ESX: %v", err)
 	}
+	client.Client.RoundTripper = &limitedRoundTripper{
+		limiter: throttle.ForPlatform("esx"),
+		rt:      client.Client.RoundTripper,
+	}
 
 	return &API{
 		options: opts,
@@ -162,6 +168,19 @@ func New(opts *Options) (*API, error) {
 	}, nil
 }
 
+// limitedRoundTripper sends SOAP requests through a throttle.Limiter.
+// ESX doesn't throttle requests, so they aren't retried.
+type limitedRoundTripper struct {
+	limiter *throttle.Limiter
+	rt      soap.RoundTripper
+}
+
+func (l *limitedRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	return l.limiter.Do(ctx, func() error {
+		return l.rt.RoundTrip(ctx, req, res)
+	}, nil)
+}
+
 func getNetworkDevice(net object.NetworkReference) (types.BaseVirtualDevice, error) {
 	backing, err := net.EthernetCardBackingInfo(context.TODO())
 	if err != nil {
@@ -349,6 +368,11 @@ func (a *API) CreateDevice(name string, conf *conf.Conf) (*ESXMachine, error) {
 	if err != nil {
 		return nil, fmt.Errorf("clone base VM operation failed: %v", err)
 	}
+	accounting.Created(accounting.Resource{
+		Platform: "esx",
+		Kind:     accounting.Instance,
+		ID:       name,
+	})
 
 	vm, err := defaults.finder.VirtualMachine(a.ctx, name)
 	if err != nil {
@@ -422,7 +446,11 @@ func (a *API) TerminateDevice(name string) error {
 		return fmt.Errorf("couldn't find VM: %v", err)
 	}
 
-	return a.deleteDevice(vm)
+	if err := a.deleteDevice(vm); err != nil {
+		return err
+	}
+	accounting.Destroyed("esx", accounting.Instance, name)
+	return nil
 }
 
 func (a *API) deleteDevice(vm *object.VirtualMachine) error {
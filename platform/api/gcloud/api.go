@@ -27,6 +27,7 @@ import (
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/throttle"
 )
 
 var (
@@ -86,6 +87,10 @@ func New(opts *Options) (*API, error) {
 		return nil, err
 	}
 
+	limited := *client
+	limited.Transport = throttle.ForPlatform("gce").Transport(client.Transport, throttled)
+	client = &limited
+
 	capi, err := compute.New(client)
 	if err != nil {
 		return nil, err
@@ -100,6 +105,19 @@ func New(opts *Options) (*API, error) {
 	return api, nil
 }
 
+// throttled reports whether resp is a rate limit error.
+// https://cloud.google.com/compute/docs/api-rate-limits
+func throttled(resp *http.Response) bool {
+	if throttle.TooManyRequests(resp) {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	body := string(throttle.PeekBody(resp, 4096))
+	return strings.Contains(body, "rateLimitExceeded") || strings.Contains(body, "RateLimitExceeded")
+}
+
 func (a *API) Client() *http.Client {
 	return a.client
 }
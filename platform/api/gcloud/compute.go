@@ -22,6 +22,8 @@ import (
 
 	"golang.org/x/crypto/ssh/agent"
 	"google.golang.org/api/compute/v1"
+
+	"github.com/coreos/mantle/platform/accounting"
 )
 
 func (a *API) vmname() string {
@@ -115,6 +117,13 @@ func (a *API) CreateInstance(userdata string, keys []*agent.Key) (*compute.Insta
 	if err != nil {
 		return nil, fmt.Errorf("failed to request new GCE instance: %v\n", err)
 	}
+	accounting.Created(accounting.Resource{
+		Platform: "gce",
+		Kind:     accounting.Instance,
+		ID:       name,
+		Type:     a.options.MachineType,
+		Region:   a.options.Zone,
+	})
 
 	doable := a.compute.ZoneOperations.Get(a.options.Project, a.options.Zone, op.Name)
 	if err := a.NewPending(op.Name, doable).Wait(); err != nil {
@@ -135,6 +144,9 @@ func (a *API) TerminateInstance(name string) error {
 	plog.Debugf("Terminating instance %q", name)
 
 	_, err := a.compute.Instances.Delete(a.options.Project, a.options.Zone, name).Do()
+	if err == nil {
+		accounting.Destroyed("gce", accounting.Instance, name)
+	}
 	return err
 }
 
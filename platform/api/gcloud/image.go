@@ -112,6 +112,15 @@ func (a *API) ListImages(ctx context.Context, prefix string) ([]*compute.Image,
 	return images, nil
 }
 
+// GetImage fetches the image with the given name from the project.
+func (a *API) GetImage(name string) (*compute.Image, error) {
+	image, err := a.compute.Images.Get(a.options.Project, name).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Getting GCE image %s failed: %v", name, err)
+	}
+	return image, nil
+}
+
 func (a *API) GetPendingForImage(image *compute.Image) (*Pending, error) {
 	op := a.compute.GlobalOperations.List(a.options.Project)
 	op.Filter(fmt.Sprintf("(targetId eq %v) (operationType eq insert)", image.Id))
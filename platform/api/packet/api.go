@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 
@@ -34,7 +35,9 @@ import (
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/accounting"
 	"github.com/coreos/mantle/platform/api/gcloud"
+	"github.com/coreos/mantle/platform/api/throttle"
 	"github.com/coreos/mantle/platform/conf"
 	"github.com/coreos/mantle/storage"
 	"github.com/coreos/mantle/util"
@@ -158,7 +161,9 @@ func New(opts *Options) (*API, error) {
 		return nil, fmt.Errorf("connecting to Google Storage bucket: %v", err)
 	}
 
-	client := packngo.NewClient("github.com/coreos/mantle", opts.ApiKey, nil)
+	client := packngo.NewClient("github.com/coreos/mantle", opts.ApiKey, &http.Client{
+		Transport: throttle.ForPlatform("packet").Transport(nil, throttle.TooManyRequests),
+	})
 
 	return &API{
 		c:      client,
@@ -195,20 +200,27 @@ func (a *API) CreateDevice(hostname string, conf *conf.Conf, console Console) (*
 	if err != nil {
 		return nil, err
 	}
-	defer a.bucket.Delete(context.TODO(), userdataName)
+	defer a.deleteObject(userdataName)
 
 	// This can't go in userdata because the installed coreos-cloudinit will try to execute it.
 	ipxeScriptName, ipxeScriptURL, err := a.uploadObject(hostname, "application/octet-stream", []byte(a.ipxeScript(userdataURL)))
 	if err != nil {
 		return nil, err
 	}
-	defer a.bucket.Delete(context.TODO(), ipxeScriptName)
+	defer a.deleteObject(ipxeScriptName)
 
 	device, err := a.createDevice(hostname, ipxeScriptURL)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create device: %v", err)
 	}
 	deviceID := device.ID
+	accounting.Created(accounting.Resource{
+		Platform: "packet",
+		Kind:     accounting.Instance,
+		ID:       deviceID,
+		Type:     a.opts.Plan,
+		Region:   a.opts.Facility,
+	})
 
 	if console != nil {
 		err := a.startConsole(deviceID, console)
@@ -245,6 +257,7 @@ func (a *API) DeleteDevice(deviceID string) error {
 	if err != nil {
 		return fmt.Errorf("deleting device %q: %v", deviceID, err)
 	}
+	accounting.Destroyed("packet", accounting.Instance, deviceID)
 	return nil
 }
 
@@ -265,6 +278,11 @@ func (a *API) AddKey(name, key string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("couldn't create SSH key: %v", err)
 	}
+	accounting.Created(accounting.Resource{
+		Platform: "packet",
+		Kind:     accounting.SSHKey,
+		ID:       sshKey.ID,
+	})
 	return sshKey.ID, nil
 }
 
@@ -273,6 +291,7 @@ func (a *API) DeleteKey(keyID string) error {
 	if err != nil {
 		return fmt.Errorf("couldn't delete SSH key: %v", err)
 	}
+	accounting.Destroyed("packet", accounting.SSHKey, keyID)
 	return nil
 }
 
@@ -450,12 +469,27 @@ func (a *API) uploadObject(hostname, contentType string, data []byte) (string, s
 	if err != nil {
 		return "", "", fmt.Errorf("uploading object: %v", err)
 	}
+	// userdata is staged in Google Storage, so it's billed to GCE
+	accounting.Created(accounting.Resource{
+		Platform: "gce",
+		Kind:     accounting.Object,
+		ID:       a.bucket.Name() + "/" + obj.Name,
+		Bytes:    int64(len(data)),
+	})
 
 	// HTTPS causes iPXE to fail on a "permission denied" error
 	url := fmt.Sprintf("http://storage-download.googleapis.com/%v/%v", a.bucket.Name(), obj.Name)
 	return obj.Name, url, nil
 }
 
+func (a *API) deleteObject(name string) {
+	if err := a.bucket.Delete(context.TODO(), name); err != nil {
+		plog.Errorf("Error deleting object %v: %v", name, err)
+		return
+	}
+	accounting.Destroyed("gce", accounting.Object, a.bucket.Name()+"/"+name)
+}
+
 func (a *API) ipxeScript(userdataURL string) string {
 	return fmt.Sprintf(`#!ipxe
 set base-url %s
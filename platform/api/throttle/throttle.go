@@ -0,0 +1,313 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package throttle limits the rate and concurrency of cloud API requests
+// per platform, and retries requests that the platform throttled. Every
+// API client of a platform in the process shares the platform's Limiter.
+package throttle
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/throttle")
+
+// Config sets the limits of a Limiter.
+type Config struct {
+	Rate        float64 // requests per second
+	Concurrency int     // requests in flight at once
+	MaxRetries  int     // retries of a throttled request
+}
+
+// defaults are the limits of each platform, chosen to stay well within
+// the providers' documented API quotas.
+var defaults = map[string]Config{
+	"aws":    {Rate: 10, Concurrency: 16, MaxRetries: 10},
+	"azure":  {Rate: 5, Concurrency: 16, MaxRetries: 8},
+	"do":     {Rate: 1, Concurrency: 4, MaxRetries: 8},
+	"esx":    {Rate: 10, Concurrency: 8},
+	"gce":    {Rate: 10, Concurrency: 16, MaxRetries: 8},
+	"packet": {Rate: 2, Concurrency: 4, MaxRetries: 8},
+}
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Stats counts a Limiter's requests.
+type Stats struct {
+	Requests  uint64 `json:"requests"`  // requests sent, including retries
+	Throttled uint64 `json:"throttled"` // requests the platform throttled
+	Retries   uint64 `json:"retries"`   // throttled requests that were retried
+}
+
+// Limiter spaces out and caps the concurrency of one platform's requests.
+type Limiter struct {
+	config   Config
+	interval time.Duration
+	slots    chan struct{}
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+
+	stats Stats
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*Limiter{}
+)
+
+// ForPlatform returns the Limiter shared by the API clients of platform.
+func ForPlatform(platform string) *Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[platform]
+	if !ok {
+		l = New(defaults[platform])
+		limiters[platform] = l
+	}
+	return l
+}
+
+// AllStats returns the Stats of each platform's Limiter.
+func AllStats() map[string]Stats {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	all := make(map[string]Stats)
+	for platform, l := range limiters {
+		all[platform] = l.Stats()
+	}
+	return all
+}
+
+// New returns a Limiter enforcing config. Zero values are unlimited.
+func New(config Config) *Limiter {
+	l := &Limiter{config: config}
+	if config.Rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / config.Rate)
+	}
+	if config.Concurrency > 0 {
+		l.slots = make(chan struct{}, config.Concurrency)
+	}
+	return l
+}
+
+// Stats returns the Limiter's counters.
+func (l *Limiter) Stats() Stats {
+	return Stats{
+		Requests:  atomic.LoadUint64(&l.stats.Requests),
+		Throttled: atomic.LoadUint64(&l.stats.Throttled),
+		Retries:   atomic.LoadUint64(&l.stats.Retries),
+	}
+}
+
+// acquire waits until a request may start. The returned function must be
+// called once it finishes.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	if err := sleep(ctx, start.Sub(now)); err != nil {
+		release()
+		return nil, err
+	}
+	atomic.AddUint64(&l.stats.Requests, 1)
+	return release, nil
+}
+
+// retry records a throttled request and reports whether it should be
+// retried after its retry'th attempt.
+func (l *Limiter) retry(retry int) bool {
+	retried := retry < l.config.MaxRetries
+	l.Throttled(retried)
+	return retried
+}
+
+// Throttled records a request that was throttled outside of Do and
+// Transport, e.g. by an SDK that does its own retries.
+func (l *Limiter) Throttled(retried bool) {
+	atomic.AddUint64(&l.stats.Throttled, 1)
+	if retried {
+		atomic.AddUint64(&l.stats.Retries, 1)
+	}
+}
+
+// MaxRetries returns how many times a throttled request may be retried.
+func (l *Limiter) MaxRetries() int {
+	return l.config.MaxRetries
+}
+
+// Backoff returns how long to wait before the given retry, with jitter.
+func Backoff(retry int) time.Duration {
+	d := minBackoff << uint(retry)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do calls f under the Limiter, retrying while throttled reports that
+// its error means the platform throttled the call.
+func (l *Limiter) Do(ctx context.Context, f func() error, throttled func(error) bool) error {
+	for retry := 0; ; retry++ {
+		release, err := l.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		err = f()
+		release()
+		if err == nil || throttled == nil || !throttled(err) || !l.retry(retry) {
+			return err
+		}
+		plog.Debugf("request throttled, retrying: %v", err)
+		if err := sleep(ctx, Backoff(retry)); err != nil {
+			return err
+		}
+	}
+}
+
+// Transport returns an http.RoundTripper that sends requests through base
+// under the Limiter, retrying responses that throttled reports were
+// throttled. The Retry-After header of a throttled response is honored
+// up to maxBackoff, and a response isn't retried if the delay would pass
+// the request's deadline. If throttled is nil, requests are never retried.
+func (l *Limiter) Transport(base http.RoundTripper, throttled func(*http.Response) bool) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{l: l, base: base, throttled: throttled}
+}
+
+type transport struct {
+	l         *Limiter
+	base      http.RoundTripper
+	throttled func(*http.Response) bool
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for retry := 0; ; retry++ {
+		// RoundTrippers must not modify the caller's request, so
+		// retries send a copy with a fresh body.
+		r := req
+		if retry > 0 {
+			r = req.WithContext(ctx)
+			if req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+
+		release, err := t.l.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(r)
+		release()
+		if err != nil || t.throttled == nil || !t.throttled(resp) {
+			return resp, err
+		}
+		// the body can't be replayed
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		delay := Backoff(retry)
+		if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && after > 0 {
+			delay = time.Duration(after) * time.Second
+			if delay > maxBackoff {
+				delay = maxBackoff
+			}
+		}
+		// don't wait past the deadline only to fail
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			t.l.Throttled(false)
+			return resp, nil
+		}
+		if !t.l.retry(retry) {
+			return resp, nil
+		}
+		plog.Debugf("%s %s throttled with %s, retrying in %v", req.Method, req.URL, resp.Status, delay)
+		resp.Body.Close()
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// TooManyRequests reports whether resp has status 429, which most
+// providers use for throttled requests.
+func TooManyRequests(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests
+}
+
+// PeekBody returns up to n bytes of resp's body, leaving the body intact
+// for the caller.
+func PeekBody(resp *http.Response, n int64) []byte {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, n))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+	return b
+}
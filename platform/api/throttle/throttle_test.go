@@ -0,0 +1,185 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestTransportRetriesThrottled(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("request %d has body %q", calls, body)
+		}
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	l := New(Config{MaxRetries: 1})
+	client := &http.Client{Transport: l.Transport(nil, TooManyRequests)}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+
+	if stats := l.Stats(); stats != (Stats{Requests: 2, Throttled: 1, Retries: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func throttledResponse(retryAfter string) *http.Response {
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestTransportCopiesRetriedRequests(t *testing.T) {
+	var sent []*http.Request
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req)
+		body, _ := ioutil.ReadAll(req.Body)
+		if string(body) != "payload" {
+			t.Errorf("request %d has body %q", len(sent), body)
+		}
+		if len(sent) == 1 {
+			return throttledResponse("1"), nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	req, err := http.NewRequest("POST", "http://example.com/", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := req.Body
+	l := New(Config{MaxRetries: 1})
+	resp, err := l.Transport(base, TooManyRequests).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	if len(sent) != 2 || sent[0] != req || sent[1] == req {
+		t.Errorf("retry didn't send a copy of the request")
+	}
+	if req.Body != body {
+		t.Errorf("caller's request body was replaced")
+	}
+}
+
+func TestTransportRetryAfterDeadline(t *testing.T) {
+	calls := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return throttledResponse("3600"), nil
+	})
+
+	// Even capped at maxBackoff, the delay doesn't fit before the
+	// deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), maxBackoff/2)
+	defer cancel()
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(Config{MaxRetries: 5})
+	start := time.Now()
+	resp, err := l.Transport(base, TooManyRequests).RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || calls != 1 {
+		t.Errorf("got status %d after %d calls", resp.StatusCode, calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %v for a retry that couldn't make the deadline", elapsed)
+	}
+}
+
+func TestDoGivesUp(t *testing.T) {
+	errThrottled := errors.New("throttled")
+	l := New(Config{})
+	calls := 0
+	err := l.Do(context.Background(), func() error {
+		calls++
+		return errThrottled
+	}, func(err error) bool {
+		return err == errThrottled
+	})
+	if err != errThrottled || calls != 1 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+	if stats := l.Stats(); stats != (Stats{Requests: 1, Throttled: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRate(t *testing.T) {
+	l := New(Config{Rate: 100})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.Do(context.Background(), func() error { return nil }, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request starts immediately
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 requests at 100/s took only %v", elapsed)
+	}
+}
+
+func TestPeekBody(t *testing.T) {
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader("hello world"))}
+	if b := PeekBody(resp, 5); string(b) != "hello" {
+		t.Errorf("peeked %q", b)
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "hello world" {
+		t.Errorf("body is now %q", b)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"sync"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/satori/go.uuid"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/network"
 	"github.com/coreos/mantle/platform/conf"
@@ -39,9 +41,10 @@ var (
 type BaseCluster struct {
 	agent *network.SSHAgent
 
-	machlock   sync.Mutex
-	machmap    map[string]Machine
-	consolemap map[string]string
+	machlock    sync.Mutex
+	machmap     map[string]Machine
+	consolemap  map[string]string
+	hostkeyerrs map[string]error
 
 	name       string
 	rconf      *RuntimeConfig
@@ -55,20 +58,25 @@ func NewBaseCluster(opts *Options, rconf *RuntimeConfig, platform Name, ctPlatfo
 }
 
 func NewBaseClusterWithDialer(opts *Options, rconf *RuntimeConfig, platform Name, ctPlatform string, dialer network.Dialer) (*BaseCluster, error) {
-	agent, err := network.NewSSHAgent(dialer)
+	agentOpts := opts.SSHAgent
+	if len(rconf.SSHKeyTypes) > 0 {
+		agentOpts.KeyTypes = rconf.SSHKeyTypes
+	}
+	agent, err := network.NewSSHAgentWithOptions(dialer, agentOpts)
 	if err != nil {
 		return nil, err
 	}
 
 	bc := &BaseCluster{
-		agent:      agent,
-		machmap:    make(map[string]Machine),
-		consolemap: make(map[string]string),
-		name:       fmt.Sprintf("%s-%s", opts.BaseName, uuid.NewV4()),
-		rconf:      rconf,
-		platform:   platform,
-		ctPlatform: ctPlatform,
-		baseopts:   opts,
+		agent:       agent,
+		machmap:     make(map[string]Machine),
+		consolemap:  make(map[string]string),
+		hostkeyerrs: make(map[string]error),
+		name:        fmt.Sprintf("%s-%s", opts.BaseName, uuid.NewV4()),
+		rconf:       rconf,
+		platform:    platform,
+		ctPlatform:  ctPlatform,
+		baseopts:    opts,
 	}
 
 	return bc, nil
@@ -104,24 +112,21 @@ func (bc *BaseCluster) PasswordSSHClient(ip string, user string, password string
 // SSH executes the given command, cmd, on the given Machine, m. It returns the
 // stdout and stderr of the command and an error.
 // Leading and trailing whitespace is trimmed from each.
+//
+// Commands share one SSH connection per machine where possible; see
+// Machine.SSH.
 func (bc *BaseCluster) SSH(m Machine, cmd string) ([]byte, []byte, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	client, err := bc.SSHClient(m.IP())
-	if err != nil {
-		return nil, nil, err
-	}
-	defer client.Close()
-
-	session, err := client.NewSession()
+	c, err := bc.Start(context.Background(), m, cmd, ExecOptions{
+		Stdin:  bytes.NewReader(nil),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-	defer session.Close()
-
-	session.Stdout = &stdout
-	session.Stderr = &stderr
-	err = session.Run(cmd)
+	err = c.Wait()
 	outBytes := bytes.TrimSpace(stdout.Bytes())
 	errBytes := bytes.TrimSpace(stderr.Bytes())
 	return outBytes, errBytes, err
@@ -147,7 +152,51 @@ func (bc *BaseCluster) DelMach(m Machine) {
 	bc.machlock.Lock()
 	defer bc.machlock.Unlock()
 	delete(bc.machmap, m.ID())
-	bc.consolemap[m.ID()] = m.ConsoleOutput()
+	console := m.ConsoleOutput()
+	bc.consolemap[m.ID()] = console
+	if err := checkConsoleHostKey(bc.agent.HostKey(m.IP()), console); err != nil {
+		bc.hostkeyerrs[m.ID()] = err
+	}
+	bc.agent.ForgetHost(m.IP())
+}
+
+// ExpectConsoleHostKeys makes the first SSH connection to m verify its
+// host key against the fingerprints on its console, as returned by
+// console, if they've been printed by then.
+func (bc *BaseCluster) ExpectConsoleHostKeys(m Machine, console func() string) {
+	bc.agent.ExpectHostKeys(m.IP(), func() []string {
+		return ConsoleHostKeys(console())
+	})
+}
+
+// consoleHostKey matches the host key fingerprints Container Linux prints
+// on the console with the login prompt.
+var consoleHostKey = regexp.MustCompile(`SSH host key: (SHA256:[A-Za-z0-9+/]+)`)
+
+// ConsoleHostKeys returns the SSH host key fingerprints listed in some
+// console output.
+func ConsoleHostKeys(console string) []string {
+	var fingerprints []string
+	for _, match := range consoleHostKey.FindAllStringSubmatch(console, -1) {
+		fingerprints = append(fingerprints, match[1])
+	}
+	return fingerprints
+}
+
+// checkConsoleHostKey returns an error if console lists host keys and
+// key, the host key the machine presented over SSH, isn't one of them.
+func checkConsoleHostKey(key ssh.PublicKey, console string) error {
+	fingerprints := ConsoleHostKeys(console)
+	if key == nil || len(fingerprints) == 0 {
+		return nil
+	}
+	fingerprint := network.HostKeyFingerprint(key)
+	for _, f := range fingerprints {
+		if f == fingerprint {
+			return nil
+		}
+	}
+	return fmt.Errorf("presented SSH host key %s, which isn't on its console", fingerprint)
 }
 
 func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
@@ -244,3 +293,13 @@ func (bc *BaseCluster) ConsoleOutput() map[string]string {
 	}
 	return ret
 }
+
+func (bc *BaseCluster) HostKeyErrors() map[string]error {
+	ret := map[string]error{}
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	for k, v := range bc.hostkeyerrs {
+		ret[k] = v
+	}
+	return ret
+}
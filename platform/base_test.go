@@ -0,0 +1,65 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network"
+)
+
+func TestCheckConsoleHostKey(t *testing.T) {
+	var keys []ssh.PublicKey
+	for i := 0; i < 2; i++ {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := ssh.NewPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, pub)
+	}
+	fingerprint := network.HostKeyFingerprint(keys[0])
+
+	console := fmt.Sprintf("This is localhost (Linux x86_64 4.14.19-coreos) 03:04:05\n"+
+		"SSH host key: %s (RSA)\n"+
+		"SSH host key: SHA256:aZ5cN7Gmbp2N1VmTObWMEmX3bCk0sAv1pS/pQ2IJkmQ (ED25519)\n"+
+		"eth0: 10.0.0.2 fe80::1\n"+
+		"localhost login:", fingerprint)
+	if fingerprints := ConsoleHostKeys(console); !reflect.DeepEqual(fingerprints, []string{fingerprint, "SHA256:aZ5cN7Gmbp2N1VmTObWMEmX3bCk0sAv1pS/pQ2IJkmQ"}) {
+		t.Errorf("unexpected fingerprints %v", fingerprints)
+	}
+
+	if err := checkConsoleHostKey(keys[0], console); err != nil {
+		t.Errorf("listed host key: %v", err)
+	}
+	if err := checkConsoleHostKey(keys[1], console); err == nil {
+		t.Error("unlisted host key was accepted")
+	}
+	if err := checkConsoleHostKey(keys[1], "localhost login:"); err != nil {
+		t.Errorf("console without host keys: %v", err)
+	}
+	if err := checkConsoleHostKey(nil, console); err != nil {
+		t.Errorf("machine never connected to: %v", err)
+	}
+}
@@ -15,6 +15,7 @@
 package conf
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -133,6 +134,22 @@ func (u *UserData) Contains(substr string) bool {
 	return strings.Contains(u.data, substr)
 }
 
+// Equal returns true if u and v hold the same configuration and SSH keys.
+func (u *UserData) Equal(v *UserData) bool {
+	if u == nil || v == nil {
+		return u == v
+	}
+	if u.kind != v.kind || u.data != v.data || len(u.extraKeys) != len(v.extraKeys) {
+		return false
+	}
+	for i, key := range u.extraKeys {
+		if key.Format != v.extraKeys[i].Format || !bytes.Equal(key.Blob, v.extraKeys[i].Blob) {
+			return false
+		}
+	}
+	return true
+}
+
 // Performs a string substitution and returns a new UserData.
 func (u *UserData) Subst(old, new string) *UserData {
 	ret := *u
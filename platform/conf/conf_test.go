@@ -59,3 +59,58 @@ func TestConfCopyKey(t *testing.T) {
 		}
 	}
 }
+
+func TestConfCopyKeys(t *testing.T) {
+	agent, err := network.NewSSHAgentWithOptions(&net.Dialer{}, network.SSHAgentOptions{
+		KeyTypes: []network.KeyType{network.KeyEd25519, network.KeyECDSA},
+	})
+	if err != nil {
+		t.Fatalf("NewSSHAgentWithOptions failed: %v", err)
+	}
+
+	keys, err := agent.List()
+	if err != nil {
+		t.Fatalf("agent.List failed: %v", err)
+	}
+
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.2.0" } }`),
+		Ignition(`{ "ignitionVersion": 1 }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.CopyKeys(keys)
+
+		str := conf.String()
+
+		for _, want := range []string{"ssh-ed25519 ", " core@default", "ecdsa-sha2-nistp256 ", " core@ecdsa-1"} {
+			if !strings.Contains(str, want) {
+				t.Errorf("%q not found in config %d: %s", want, i, str)
+			}
+		}
+	}
+}
+
+func TestUserDataEqual(t *testing.T) {
+	a := Ignition(`{ "ignition": { "version": "2.2.0" } }`)
+	if !a.Equal(Ignition(`{ "ignition": { "version": "2.2.0" } }`)) {
+		t.Errorf("identical userdata not equal")
+	}
+	if a.Equal(ContainerLinuxConfig(`{ "ignition": { "version": "2.2.0" } }`)) {
+		t.Errorf("userdata of different kinds equal")
+	}
+	if a.Equal(nil) || !(*UserData)(nil).Equal(nil) {
+		t.Errorf("nil userdata compared incorrectly")
+	}
+	if a.Equal(a.Subst("2.2.0", "2.1.0")) {
+		t.Errorf("different userdata equal")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+)
+
+// ExecOptions controls a command started with Machine.Start.
+type ExecOptions struct {
+	// Stdin, Stdout and Stderr are connected to the command. Streams
+	// left nil are available as pipes in the Command instead.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// PTY allocates a pseudo-terminal for the command, for interactive
+	// tools. The terminal merges the command's stderr into stdout.
+	PTY bool
+
+	// NewConnection runs the command over a new SSH connection of its
+	// own, and so in a new login session, instead of the connection
+	// shared by the machine's commands.
+	NewConnection bool
+}
+
+// Command is a command running on a machine.
+//
+// Like the pipes of os/exec, Stdout and Stderr must be read as the
+// command runs, or it blocks once the SSH channel's window fills.
+type Command struct {
+	Stdin  io.WriteCloser // nil if ExecOptions.Stdin was set
+	Stdout io.Reader      // nil if ExecOptions.Stdout was set
+	Stderr io.Reader      // nil if ExecOptions.Stderr was set
+
+	session *ssh.Session
+	cleanup func()
+
+	done     chan struct{}
+	mu       sync.Mutex
+	err      error
+	canceled error
+}
+
+// Start starts cmd on m over SSH and returns without waiting for it to
+// finish. Canceling ctx kills the command.
+//
+// Unless opts.NewConnection is set, commands share one SSH connection per
+// machine, so they all run in the login session it was opened with.
+func (bc *BaseCluster) Start(ctx context.Context, m Machine, cmd string, opts ExecOptions) (*Command, error) {
+	var session *ssh.Session
+	if !opts.NewConnection {
+		client, err := bc.agent.CachedClient(m.IP())
+		if err != nil {
+			return nil, err
+		}
+		// The shared connection may have reached sshd's MaxSessions,
+		// in which case we fall back to a connection of our own.
+		session, _ = client.NewSession()
+	}
+
+	cleanup := func() {}
+	if session == nil {
+		client, err := bc.SSHClient(m.IP())
+		if err != nil {
+			return nil, err
+		}
+		session, err = client.NewSession()
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		cleanup = func() { client.Close() }
+	}
+
+	c, err := startCommand(ctx, session, cleanup, cmd, opts)
+	if err != nil {
+		session.Close()
+		cleanup()
+		return nil, err
+	}
+	return c, nil
+}
+
+// SSHNewLogin is like Machine.SSH but runs cmd over a new SSH connection,
+// and so in a new login session. Use it for commands that depend on state
+// only read at login, such as group membership changed with usermod.
+func SSHNewLogin(m Machine, cmd string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	c, err := m.Start(context.Background(), cmd, ExecOptions{
+		Stdin:         bytes.NewReader(nil),
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+		NewConnection: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = c.Wait()
+	return bytes.TrimSpace(stdout.Bytes()), bytes.TrimSpace(stderr.Bytes()), err
+}
+
+// startCommand starts cmd in session. cleanup is called once the
+// command exits.
+func startCommand(ctx context.Context, s *ssh.Session, cleanup func(), cmd string, opts ExecOptions) (*Command, error) {
+	var err error
+	c := &Command{
+		session: s,
+		cleanup: cleanup,
+		done:    make(chan struct{}),
+	}
+	if opts.Stdin != nil {
+		s.Stdin = opts.Stdin
+	} else if c.Stdin, err = s.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if opts.Stdout != nil {
+		s.Stdout = opts.Stdout
+	} else if c.Stdout, err = s.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if opts.Stderr != nil {
+		s.Stderr = opts.Stderr
+	} else if c.Stderr, err = s.StderrPipe(); err != nil {
+		return nil, err
+	}
+
+	if opts.PTY {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.TTY_OP_ISPEED: 38400,
+			ssh.TTY_OP_OSPEED: 38400,
+		}
+		if err := s.RequestPty("xterm", 40, 80, modes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Start(cmd); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		err := s.Wait()
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+		s.Close()
+		c.cleanup()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.kill(ctx.Err())
+		case <-c.done:
+		}
+	}()
+	return c, nil
+}
+
+// kill signals the command to exit and closes its session, making Wait
+// return err.
+func (c *Command) kill(err error) {
+	c.mu.Lock()
+	if c.canceled == nil {
+		c.canceled = err
+	}
+	c.mu.Unlock()
+
+	// sshd only delivers signals since OpenSSH 7.9; closing the
+	// session hangs up commands with a PTY and closes the pipes of
+	// the others.
+	c.session.Signal(ssh.SIGKILL)
+	c.session.Close()
+}
+
+// Signal sends sig to the command.
+func (c *Command) Signal(sig ssh.Signal) error {
+	return c.session.Signal(sig)
+}
+
+// Kill kills the command. Wait then returns context.Canceled.
+func (c *Command) Kill() {
+	c.kill(context.Canceled)
+}
+
+// Done returns a channel that is closed when the command has exited.
+func (c *Command) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait waits for the command to exit. It returns nil if the command
+// exited with status 0, an *ssh.ExitError if it failed, or the
+// context's error if it was killed by canceling it. Wait may be called
+// more than once.
+func (c *Command) Wait() error {
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.canceled != nil {
+		return c.canceled
+	}
+	return c.err
+}
+
+// ExitStatus returns the command's exit status once it has exited, or
+// -1 if it is still running or exited without one, e.g. killed by a
+// signal.
+func (c *Command) ExitStatus() int {
+	select {
+	case <-c.done:
+	default:
+		return -1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch err := c.err.(type) {
+	case nil:
+		return 0
+	case *ssh.ExitError:
+		if err.Signal() != "" {
+			return -1
+		}
+		return err.ExitStatus()
+	}
+	return -1
+}
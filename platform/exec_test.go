@@ -0,0 +1,139 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/network/mockssh"
+)
+
+// execHandler implements a few commands for the mock SSH server.
+func execHandler(s *mockssh.Session) {
+	switch s.Exec {
+	case "cat":
+		io.Copy(s.Stdout, s.Stdin)
+		s.Exit(0)
+	case "follow":
+		// print lines until the session goes away
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(s.Stdout, "line %d\n", i); err != nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	case "hang":
+		io.Copy(ioutil.Discard, s.Stdin)
+		s.Close()
+	default:
+		fmt.Fprintf(s.Stderr, "%s: not found\n", s.Exec)
+		s.Exit(127)
+	}
+}
+
+func startMock(t *testing.T, ctx context.Context, cmd string, opts ExecOptions) *Command {
+	client := mockssh.NewMockClient(execHandler)
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	c, err := startCommand(ctx, session, func() { client.Close() }, cmd, opts)
+	if err != nil {
+		t.Fatalf("starting %q failed: %v", cmd, err)
+	}
+	return c
+}
+
+func TestCommandStreams(t *testing.T) {
+	c := startMock(t, context.Background(), "cat", ExecOptions{})
+	if c.ExitStatus() != -1 {
+		t.Errorf("running command has exit status %d", c.ExitStatus())
+	}
+	if _, err := c.Stdin.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("writing stdin failed: %v", err)
+	}
+	line, err := bufio.NewReader(c.Stdout).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Fatalf("read %q, %v from stdout", line, err)
+	}
+	c.Stdin.Close()
+	if err := c.Wait(); err != nil {
+		t.Errorf("Wait failed: %v", err)
+	}
+	if c.ExitStatus() != 0 {
+		t.Errorf("exit status %d, expected 0", c.ExitStatus())
+	}
+
+	var stderr bytes.Buffer
+	c = startMock(t, context.Background(), "false", ExecOptions{
+		Stdin:  bytes.NewReader(nil),
+		Stdout: ioutil.Discard,
+		Stderr: &stderr,
+	})
+	if _, ok := c.Wait().(*ssh.ExitError); !ok {
+		t.Errorf("Wait returned %v, expected an exit error", c.Wait())
+	}
+	if c.ExitStatus() != 127 {
+		t.Errorf("exit status %d, expected 127", c.ExitStatus())
+	}
+	if stderr.String() != "false: not found\n" {
+		t.Errorf("stderr %q", stderr.String())
+	}
+}
+
+func TestCommandCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := startMock(t, ctx, "follow", ExecOptions{})
+
+	// output streams in before the command exits
+	scanner := bufio.NewScanner(c.Stdout)
+	for i := 0; i < 3; i++ {
+		if !scanner.Scan() {
+			t.Fatalf("output ended early: %v", scanner.Err())
+		}
+		if line := scanner.Text(); line != fmt.Sprintf("line %d", i) {
+			t.Errorf("read %q", line)
+		}
+	}
+	go io.Copy(ioutil.Discard, c.Stdout)
+
+	cancel()
+	select {
+	case <-c.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("command still running after cancel")
+	}
+	if err := c.Wait(); err != context.Canceled {
+		t.Errorf("Wait returned %v, expected %v", err, context.Canceled)
+	}
+
+	c = startMock(t, context.Background(), "hang", ExecOptions{})
+	c.Kill()
+	if err := c.Wait(); err != context.Canceled {
+		t.Errorf("Wait after Kill returned %v", err)
+	}
+	if c.ExitStatus() != -1 {
+		t.Errorf("killed command has exit status %d", c.ExitStatus())
+	}
+}
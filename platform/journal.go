@@ -22,6 +22,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/coreos/pkg/multierror"
 
@@ -31,20 +33,41 @@ import (
 
 // Journal manages recording the journal of a Machine.
 type Journal struct {
-	journal     io.WriteCloser
-	journalRaw  io.WriteCloser
-	journalPath string
-	recorder    *journal.Recorder
-	cancel      context.CancelFunc
+	journal        io.WriteCloser
+	journalRaw     *gzWriteCloser
+	journalPath    string
+	journalRawPath string
+	extra          []io.Closer // outputs of additional formats
+	recorder       *journal.Recorder
+	cancel         context.CancelFunc
+
+	mu      sync.Mutex
+	waiters map[chan journal.Entry][]journal.Matcher
 }
 
-// wrapper that also closes the underlying file
+// wrapper that also closes the underlying file, and that can be flushed
+// while the recorder is writing so that the raw journal can be read back
 type gzWriteCloser struct {
+	mu sync.Mutex
 	*gzip.Writer
 	underlying io.Closer
 }
 
-func (g gzWriteCloser) Close() error {
+func (g *gzWriteCloser) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Writer.Write(p)
+}
+
+func (g *gzWriteCloser) Flush() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Writer.Flush()
+}
+
+func (g *gzWriteCloser) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	var err multierror.Error
 	if e := g.Writer.Close(); e != nil {
 		err = append(err, e)
@@ -55,9 +78,32 @@ func (g gzWriteCloser) Close() error {
 	return err.AsError()
 }
 
+// formatter that also hands each entry to the Journal's waiters
+type notifyFormatter struct {
+	journal.Formatter
+	j *Journal
+}
+
+func (n notifyFormatter) WriteEntry(entry journal.Entry) error {
+	err := n.Formatter.WriteEntry(entry)
+	n.j.notify(entry)
+	return err
+}
+
+// Additional formats NewJournal can record the journal in.
+const (
+	JournalJSON    = journal.FormatJSON    // journal.json
+	JournalVerbose = journal.FormatVerbose // journal-verbose.txt
+	JournalUnits   = "units"               // journal/<unit>.txt
+)
+
+// JournalFormats lists the additional journal formats.
+var JournalFormats = []string{JournalJSON, JournalVerbose, JournalUnits}
+
 // NewJournal creates a Journal recorder that will log to "journal.txt"
-// and "journal-raw.txt.gz" inside the given output directory.
-func NewJournal(dir string) (*Journal, error) {
+// and "journal-raw.txt.gz" inside the given output directory, and also
+// in any of the JournalFormats given.
+func NewJournal(dir string, formats ...string) (*Journal, error) {
 	p := filepath.Join(dir, "journal.txt")
 	j, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
@@ -74,17 +120,48 @@ func NewJournal(dir string) (*Journal, error) {
 	if err != nil {
 		return nil, err
 	}
-	jrzc := gzWriteCloser{
+	jrzc := &gzWriteCloser{
 		underlying: jr,
 		Writer:     jrz,
 	}
 
-	return &Journal{
-		journal:     j,
-		journalRaw:  jrzc,
-		recorder:    journal.NewRecorder(journal.ShortWriter(j), jrzc),
-		journalPath: p,
-	}, nil
+	ret := &Journal{
+		journal:        j,
+		journalRaw:     jrzc,
+		journalPath:    p,
+		journalRawPath: pr,
+		waiters:        make(map[chan journal.Entry][]journal.Matcher),
+	}
+
+	formatters := []journal.Formatter{journal.ShortWriter(j)}
+	for _, format := range formats {
+		var f journal.Formatter
+		switch format {
+		case JournalJSON, JournalVerbose:
+			name := "journal.json"
+			if format == JournalVerbose {
+				name = "journal-verbose.txt"
+			}
+			out, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+			if err != nil {
+				ret.Destroy()
+				return nil, err
+			}
+			ret.extra = append(ret.extra, out)
+			f, _ = journal.NewFormatter(format, out)
+		case JournalUnits:
+			uw := journal.NewUnitWriter(filepath.Join(dir, "journal"), journal.ShortWriter)
+			ret.extra = append(ret.extra, uw)
+			f = uw
+		default:
+			ret.Destroy()
+			return nil, fmt.Errorf("unknown journal format %q", format)
+		}
+		formatters = append(formatters, f)
+	}
+
+	ret.recorder = journal.NewRecorder(notifyFormatter{journal.MultiFormatter(formatters...), ret}, jrzc)
+	return ret, nil
 }
 
 // Start begins/resumes streaming the system journal to journal.txt.
@@ -125,6 +202,87 @@ func (j *Journal) Read() ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
+// Entries returns the recorded journal entries selected by all of the
+// matchers, oldest first. Unlike Read, it includes entries recorded up
+// to the moment it is called.
+func (j *Journal) Entries(matchers ...journal.Matcher) ([]journal.Entry, error) {
+	if err := j.journalRaw.Flush(); err != nil {
+		return nil, fmt.Errorf("flushing raw journal: %v", err)
+	}
+
+	f, err := os.Open(j.journalRawPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading raw journal: %v", err)
+	}
+	defer f.Close()
+
+	z, err := gzip.NewReader(f)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading raw journal: %v", err)
+	}
+
+	var entries []journal.Entry
+	src := journal.NewExportReader(z)
+	for {
+		entry, err := src.ReadEntry()
+		// The stream ends without a gzip trailer while the journal is
+		// still being recorded, possibly in the middle of an entry.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading raw journal: %v", err)
+		}
+		if entry.Match(matchers...) {
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// WaitFor waits up to timeout for an entry selected by all of the
+// matchers to be recorded and returns the first such entry, which may
+// have been recorded before WaitFor was called.
+func (j *Journal) WaitFor(timeout time.Duration, matchers ...journal.Matcher) (journal.Entry, error) {
+	ch := make(chan journal.Entry, 1)
+	j.mu.Lock()
+	j.waiters[ch] = matchers
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		delete(j.waiters, ch)
+		j.mu.Unlock()
+	}()
+
+	entries, err := j.Entries(matchers...)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return entries[0], nil
+	}
+
+	select {
+	case entry := <-ch:
+		return entry, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no matching journal entry after %v", timeout)
+	}
+}
+
+func (j *Journal) notify(entry journal.Entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for ch, matchers := range j.waiters {
+		if entry.Match(matchers...) {
+			select {
+			case ch <- entry:
+			default:
+			}
+		}
+	}
+}
+
 func (j *Journal) Destroy() {
 	if j.cancel != nil {
 		j.cancel()
@@ -138,4 +296,9 @@ func (j *Journal) Destroy() {
 	if err := j.journalRaw.Close(); err != nil {
 		plog.Errorf("Failed to close raw journal: %v", err)
 	}
+	for _, c := range j.extra {
+		if err := c.Close(); err != nil {
+			plog.Errorf("Failed to close journal: %v", err)
+		}
+	}
 }
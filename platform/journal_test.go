@@ -0,0 +1,93 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreos/mantle/network/journal"
+)
+
+const exportEntries = `__REALTIME_TIMESTAMP=1342540861416409
+_SYSTEMD_UNIT=docker.service
+MESSAGE=one
+
+__REALTIME_TIMESTAMP=1342540861416410
+_SYSTEMD_UNIT=etcd-member.service
+MESSAGE=two
+
+__REALTIME_TIMESTAMP=1342540861416411
+_SYSTEMD_UNIT=docker.service
+MESSAGE=thr`
+
+func TestJournalEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := NewJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Destroy()
+
+	entries, err := j.Entries()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("got %v, %v from empty journal", entries, err)
+	}
+
+	if _, err := j.journalRaw.Write([]byte(exportEntries)); err != nil {
+		t.Fatal(err)
+	}
+	// the last entry is incomplete and must be skipped
+	entries, err = j.Entries(journal.Unit("docker.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || string(entries[0][journal.FIELD_MESSAGE]) != "one" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	entry, err := j.WaitFor(time.Second, journal.Unit("etcd-member.service"))
+	if err != nil || string(entry[journal.FIELD_MESSAGE]) != "two" {
+		t.Fatalf("got %v, %v waiting for a recorded entry", entry, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				j.notify(journal.Entry{journal.FIELD_SYSTEMD_UNIT: []byte("locksmithd.service")})
+			}
+		}
+	}()
+	_, err = j.WaitFor(5*time.Second, journal.Unit("locksmithd.service"))
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.WaitFor(10*time.Millisecond, journal.Unit("update-engine.service")); err == nil {
+		t.Fatal("waiting for a missing entry succeeded")
+	}
+}
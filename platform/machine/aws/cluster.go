@@ -110,7 +110,7 @@ func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	if mach.journal, err = platform.NewJournal(mach.dir); err != nil {
+	if mach.journal, err = platform.NewJournal(mach.dir, ac.RuntimeConf().JournalFormats...); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/util"
@@ -64,6 +65,10 @@ func (am *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return am.cluster.SSH(am, cmd)
 }
 
+func (am *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return am.cluster.Start(ctx, am, cmd, opts)
+}
+
 func (am *machine) Reboot() error {
 	return platform.RebootMachine(am, am.journal)
 }
@@ -89,6 +94,10 @@ func (am *machine) Destroy() {
 	am.cluster.DelMach(am)
 }
 
+func (am *machine) Journal() *platform.Journal {
+	return am.journal
+}
+
 func (am *machine) ConsoleOutput() string {
 	return am.console
 }
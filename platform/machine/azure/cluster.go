@@ -0,0 +1,188 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/crypto/ssh"
+
+	ctplatform "github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/mantle/auth"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/azure"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+const (
+	Platform platform.Name = "azure"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/machine/azure")
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	api           *azure.API
+	sshKey        string
+	resourceGroup string
+	subnetID      string
+}
+
+// NewCluster creates an Azure cluster. Each cluster gets its own resource
+// group, which is deleted along with everything in it when the cluster
+// is destroyed.
+func NewCluster(opts *azure.Options, rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	if opts.SubscriptionID == "" {
+		prof, err := auth.ReadAzureProfile(opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read Azure profile: %v", err)
+		}
+		sub := prof.SubscriptionOptions(opts.SubscriptionName)
+		if sub == nil {
+			return nil, fmt.Errorf("Azure subscription named %q doesn't exist in profile", opts.SubscriptionName)
+		}
+		opts.SubscriptionName = sub.SubscriptionName
+		opts.SubscriptionID = sub.SubscriptionID
+		opts.TenantID = sub.TenantID
+		opts.ClientID = sub.ClientID
+		opts.ClientSecret = sub.ClientSecret
+		opts.ActiveDirectoryURL = sub.ActiveDirectoryURL
+		opts.ResourceManagerURL = sub.ResourceManagerURL
+		opts.StorageEndpointSuffix = sub.StorageEndpointSuffix
+	}
+
+	api, err := azure.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := platform.NewBaseCluster(opts.Options, rconf, Platform, ctplatform.Azure)
+	if err != nil {
+		return nil, err
+	}
+
+	var key string
+	if !rconf.NoSSHKeyInMetadata {
+		keys, err := bc.Keys()
+		if err != nil {
+			return nil, err
+		}
+		key = keys[0].String()
+	} else {
+		// Azure requires an SSH key for Linux instances. Provide
+		// one that can never authenticate.
+		key, err = generateFakeKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resourceGroup, err := api.CreateResourceGroup(bc.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	subnetID, err := api.PrepareNetworkResources(resourceGroup)
+	if err != nil {
+		if err := api.TerminateResourceGroup(resourceGroup); err != nil {
+			plog.Errorf("Error terminating resource group %v: %v", resourceGroup, err)
+		}
+		return nil, err
+	}
+
+	return &cluster{
+		BaseCluster:   bc,
+		api:           api,
+		sshKey:        key,
+		resourceGroup: resourceGroup,
+		subnetID:      subnetID,
+	}, nil
+}
+
+// Calling in parallel is ok
+func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := ac.RenderUserData(userdata, map[string]string{
+		"$public_ipv4":  "${COREOS_AZURE_IPV4_VIRTUAL}",
+		"$private_ipv4": "${COREOS_AZURE_IPV4_DYNAMIC}",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := ac.api.CreateInstance(conf.String(), ac.sshKey, ac.resourceGroup, ac.subnetID)
+	if err != nil {
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster: ac,
+		mach:    instance,
+	}
+
+	mach.dir = filepath.Join(ac.RuntimeConf().OutputDir, mach.ID())
+	if err := os.Mkdir(mach.dir, 0777); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	confPath := filepath.Join(mach.dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(mach.dir, ac.RuntimeConf().JournalFormats...); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	ac.AddMach(mach)
+
+	return mach, nil
+}
+
+func (ac *cluster) Destroy() {
+	ac.BaseCluster.Destroy()
+
+	if err := ac.api.TerminateResourceGroup(ac.resourceGroup); err != nil {
+		plog.Errorf("Error terminating resource group %v: %v", ac.resourceGroup, err)
+	}
+}
+
+// generateFakeKey generates a SSH key pair, returns the public key, and
+// discards the private key.
+func generateFakeKey() (string, error) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	sshKey, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(ssh.MarshalAuthorizedKey(sshKey)), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/azure"
+)
+
+type machine struct {
+	cluster *cluster
+	mach    *azure.Machine
+	dir     string
+	journal *platform.Journal
+	console string
+}
+
+func (am *machine) ID() string {
+	return am.mach.ID
+}
+
+func (am *machine) IP() string {
+	return am.mach.PublicIPAddress
+}
+
+func (am *machine) PrivateIP() string {
+	return am.mach.PrivateIPAddress
+}
+
+func (am *machine) RuntimeConf() platform.RuntimeConfig {
+	return am.cluster.RuntimeConf()
+}
+
+func (am *machine) SSHClient() (*ssh.Client, error) {
+	return am.cluster.SSHClient(am.IP())
+}
+
+func (am *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return am.cluster.PasswordSSHClient(am.IP(), user, password)
+}
+
+func (am *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return am.cluster.SSH(am, cmd)
+}
+
+func (am *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return am.cluster.Start(ctx, am, cmd, opts)
+}
+
+func (am *machine) Reboot() error {
+	return platform.RebootMachine(am, am.journal)
+}
+
+func (am *machine) Destroy() {
+	if err := am.saveConsole(); err != nil {
+		plog.Errorf("Error saving console for instance %v: %v", am.ID(), err)
+	}
+
+	if err := am.cluster.api.TerminateInstance(am.ID(), am.cluster.resourceGroup); err != nil {
+		plog.Errorf("Error terminating instance %v: %v", am.ID(), err)
+	}
+
+	if am.journal != nil {
+		am.journal.Destroy()
+	}
+
+	am.cluster.DelMach(am)
+}
+
+func (am *machine) Journal() *platform.Journal {
+	return am.journal
+}
+
+func (am *machine) ConsoleOutput() string {
+	return am.console
+}
+
+func (am *machine) saveConsole() error {
+	var err error
+	am.console, err = am.cluster.api.GetConsoleOutput(am.ID(), am.cluster.resourceGroup)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(am.dir, "console.txt")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	f.WriteString(am.console)
+
+	return nil
+}
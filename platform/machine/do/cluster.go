@@ -123,7 +123,7 @@ func (dc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	if mach.journal, err = platform.NewJournal(dir); err != nil {
+	if mach.journal, err = platform.NewJournal(dir, dc.RuntimeConf().JournalFormats...); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
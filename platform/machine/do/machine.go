@@ -15,11 +15,11 @@
 package do
 
 import (
-	"context"
 	"strconv"
 
 	"github.com/digitalocean/godo"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/platform"
 )
@@ -60,6 +60,10 @@ func (dm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return dm.cluster.SSH(dm, cmd)
 }
 
+func (dm *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return dm.cluster.Start(ctx, dm, cmd, opts)
+}
+
 func (dm *machine) Reboot() error {
 	return platform.RebootMachine(dm, dm.journal)
 }
@@ -76,6 +80,10 @@ func (dm *machine) Destroy() {
 	dm.cluster.DelMach(dm)
 }
 
+func (dm *machine) Journal() *platform.Journal {
+	return dm.journal
+}
+
 func (dm *machine) ConsoleOutput() string {
 	// DigitalOcean provides no API for retrieving ConsoleOutput
 	// return the journal instead to allow for error checks to be run.
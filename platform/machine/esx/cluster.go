@@ -107,7 +107,7 @@ ExecStart=/usr/bin/bash -c 'echo "COREOS_ESX_IPV4_PRIVATE_0=$(ip addr show ens19
 		return nil, err
 	}
 
-	if mach.journal, err = platform.NewJournal(mach.dir); err != nil {
+	if mach.journal, err = platform.NewJournal(mach.dir, ec.RuntimeConf().JournalFormats...); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/api/esx"
@@ -61,6 +62,10 @@ func (em *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return em.cluster.SSH(em, cmd)
 }
 
+func (em *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return em.cluster.Start(ctx, em, cmd, opts)
+}
+
 func (em *machine) Reboot() error {
 	return platform.RebootMachine(em, em.journal)
 }
@@ -85,6 +90,10 @@ func (em *machine) Destroy() {
 	em.cluster.DelMach(em)
 }
 
+func (em *machine) Journal() *platform.Journal {
+	return em.journal
+}
+
 func (em *machine) ConsoleOutput() string {
 	return em.console
 }
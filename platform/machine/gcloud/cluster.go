@@ -105,7 +105,7 @@ func (gc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	if gm.journal, err = platform.NewJournal(gm.dir); err != nil {
+	if gm.journal, err = platform.NewJournal(gm.dir, gc.RuntimeConf().JournalFormats...); err != nil {
 		gm.Destroy()
 		return nil, err
 	}
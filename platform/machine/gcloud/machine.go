@@ -19,6 +19,7 @@ import (
 	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/platform"
 )
@@ -61,6 +62,10 @@ func (gm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return gm.gc.SSH(gm, cmd)
 }
 
+func (gm *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return gm.gc.Start(ctx, gm, cmd, opts)
+}
+
 func (gm *machine) Reboot() error {
 	return platform.RebootMachine(gm, gm.journal)
 }
@@ -81,6 +86,10 @@ func (gm *machine) Destroy() {
 	gm.gc.DelMach(gm)
 }
 
+func (gm *machine) Journal() *platform.Journal {
+	return gm.journal
+}
+
 func (gm *machine) ConsoleOutput() string {
 	return gm.console
 }
@@ -140,7 +140,7 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	if mach.journal, err = platform.NewJournal(dir); err != nil {
+	if mach.journal, err = platform.NewJournal(dir, pc.RuntimeConf().JournalFormats...); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
@@ -18,6 +18,7 @@ import (
 	"strings"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/platform"
 	"github.com/packethost/packngo"
@@ -60,6 +61,10 @@ func (pm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return pm.cluster.SSH(pm, cmd)
 }
 
+func (pm *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return pm.cluster.Start(ctx, pm, cmd, opts)
+}
+
 func (pm *machine) Reboot() error {
 	return platform.RebootMachine(pm, pm.journal)
 }
@@ -76,6 +81,10 @@ func (pm *machine) Destroy() {
 	pm.cluster.DelMach(pm)
 }
 
+func (pm *machine) Journal() *platform.Journal {
+	return pm.journal
+}
+
 func (pm *machine) ConsoleOutput() string {
 	if pm.console == nil {
 		return ""
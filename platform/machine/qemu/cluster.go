@@ -132,7 +132,7 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options Machin
 		}
 	}
 
-	journal, err := platform.NewJournal(dir)
+	journal, err := platform.NewJournal(dir, qc.RuntimeConf().JournalFormats...)
 	if err != nil {
 		return nil, err
 	}
@@ -257,6 +257,13 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options Machin
 		return nil, err
 	}
 
+	// The console is written as the machine boots, so the host keys it
+	// lists can be checked before the first connection trusts one.
+	qc.ExpectConsoleHostKeys(qm, func() string {
+		buf, _ := ioutil.ReadFile(qm.consolePath)
+		return string(buf)
+	})
+
 	if err := platform.StartMachine(qm, qm.journal); err != nil {
 		qm.Destroy()
 		return nil, err
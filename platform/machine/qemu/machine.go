@@ -18,6 +18,7 @@ import (
 	"io/ioutil"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/local"
@@ -62,6 +63,10 @@ func (m *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return m.qc.SSH(m, cmd)
 }
 
+func (m *machine) Start(ctx context.Context, cmd string, opts platform.ExecOptions) (*platform.Command, error) {
+	return m.qc.Start(ctx, m, cmd, opts)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal)
 }
@@ -82,6 +87,10 @@ func (m *machine) Destroy() {
 	m.qc.DelMach(m)
 }
 
+func (m *machine) Journal() *platform.Journal {
+	return m.journal
+}
+
 func (m *machine) ConsoleOutput() string {
 	return m.console
 }
@@ -18,13 +18,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"path/filepath"
+	"path"
 	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/context"
 
+	"github.com/coreos/mantle/network"
+	"github.com/coreos/mantle/network/sftp"
 	"github.com/coreos/mantle/platform/conf"
 	"github.com/coreos/mantle/util"
 )
@@ -57,9 +59,18 @@ type Machine interface {
 	// PasswordSSHClient establishes a new SSH connection using the provided credentials.
 	PasswordSSHClient(user string, password string) (*ssh.Client, error)
 
-	// SSH runs a single command over a new SSH connection.
+	// SSH runs a single command. Commands share one SSH connection,
+	// and so one login session, per machine; changes that only apply
+	// to new logins, like group membership, aren't seen by later
+	// commands. Use SSHNewLogin for those. If the shared connection
+	// has gone quiet, e.g. across a reboot, checking it can take up to
+	// 10 seconds before a new one is made.
 	SSH(cmd string) ([]byte, []byte, error)
 
+	// Start starts cmd over SSH with streaming I/O and returns without
+	// waiting for it to finish. Canceling ctx kills the command.
+	Start(ctx context.Context, cmd string, opts ExecOptions) (*Command, error)
+
 	// Reboot restarts the machine and waits for it to come back.
 	Reboot() error
 
@@ -70,6 +81,10 @@ type Machine interface {
 	// ConsoleOutput returns the machine's console output if available,
 	// or an empty string.  Only expected to be valid after Destroy().
 	ConsoleOutput() string
+
+	// Journal returns the machine's recorded journal, or nil if it
+	// isn't being recorded.
+	Journal() *Journal
 }
 
 // Cluster represents a cluster of Container Linux machines within a single platform.
@@ -94,6 +109,10 @@ type Cluster interface {
 	// ConsoleOutput returns a map of console output from destroyed
 	// cluster machines.
 	ConsoleOutput() map[string]string
+
+	// HostKeyErrors returns a map of errors verifying the SSH host keys
+	// of destroyed cluster machines against their console output.
+	HostKeyErrors() map[string]error
 }
 
 // SystemdDropin is a userdata type agnostic struct representing a systemd dropin
@@ -107,6 +126,7 @@ type SystemdDropin struct {
 type Options struct {
 	BaseName       string
 	SystemdDropins []SystemdDropin
+	SSHAgent       network.SSHAgentOptions // keys of each cluster's SSH agent
 }
 
 // RuntimeConfig contains cluster-specific configuration.
@@ -117,24 +137,24 @@ type RuntimeConfig struct {
 	NoSSHKeyInMetadata bool // don't add SSH key to platform metadata
 	NoEnableSelinux    bool // don't enable selinux when starting or rebooting a machine
 	AllowFailedUnits   bool // don't fail CheckMachine if a systemd unit has failed
+
+	JournalFormats []string // additional formats to record journals in
+
+	SSHKeyTypes []network.KeyType // if set, overrides the key types of Options.SSHAgent
 }
 
-// Wrap a StdoutPipe as a io.ReadCloser
-type sshPipe struct {
-	s   *ssh.Session
-	c   *ssh.Client
-	err *bytes.Buffer
-	io.Reader
+// sftpFile closes the SFTP client along with the file.
+type sftpFile struct {
+	*sftp.File
+	c *sftp.Client
 }
 
-func (p *sshPipe) Close() error {
-	if err := p.s.Wait(); err != nil {
-		return fmt.Errorf("%s: %s", err, p.err)
-	}
-	if err := p.s.Close(); err != nil {
-		return err
+func (f *sftpFile) Close() error {
+	err := f.File.Close()
+	if cerr := f.c.Close(); err == nil {
+		err = cerr
 	}
-	return p.c.Close()
+	return err
 }
 
 // Copy a file between two machines in a cluster.
@@ -154,72 +174,45 @@ func TransferFile(src Machine, srcPath string, dst Machine, dstPath string) erro
 // ReadFile returns a io.ReadCloser that streams the requested file. The
 // caller should close the reader when finished.
 func ReadFile(m Machine, path string) (io.ReadCloser, error) {
-	client, err := m.SSHClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed creating SSH client: %v", err)
-	}
-
-	session, err := client.NewSession()
-	if err != nil {
-		client.Close()
-		return nil, fmt.Errorf("failed creating SSH session: %v", err)
-	}
-
-	// connect session stdout
-	stdoutPipe, err := session.StdoutPipe()
+	c, err := NewSFTPClient(m)
 	if err != nil {
-		session.Close()
-		client.Close()
 		return nil, err
 	}
 
-	// collect stderr
-	errBuf := bytes.NewBuffer(nil)
-	session.Stderr = errBuf
-
-	// stream file to stdout
-	err = session.Start(fmt.Sprintf("sudo cat %s", path))
+	f, err := c.Open(path)
 	if err != nil {
-		session.Close()
-		client.Close()
+		c.Close()
 		return nil, err
 	}
-
-	// pass stdoutPipe as a io.ReadCloser that cleans up the ssh session
-	// on when closed.
-	return &sshPipe{session, client, errBuf, stdoutPipe}, nil
+	return &sftpFile{f, c}, nil
 }
 
-// InstallFile copies data from in to the path to on m.
+// InstallFile copies data from in to the path to on m, as an executable
+// owned by root.
 func InstallFile(in io.Reader, m Machine, to string) error {
-	dir := filepath.Dir(to)
-	out, stderr, err := m.SSH(fmt.Sprintf("sudo mkdir -p %s", dir))
+	c, err := NewSFTPClient(m)
 	if err != nil {
-		return fmt.Errorf("failed creating directory %s: %s: %s", dir, stderr, err)
+		return err
 	}
+	defer c.Close()
 
-	client, err := m.SSHClient()
-	if err != nil {
-		return fmt.Errorf("failed creating SSH client: %v", err)
+	dir := path.Dir(to)
+	if err := c.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed creating directory %s: %v", dir, err)
 	}
 
-	defer client.Close()
-
-	session, err := client.NewSession()
+	out, err := c.Create(to)
 	if err != nil {
-		return fmt.Errorf("failed creating SSH session: %v", err)
+		return err
 	}
-
-	defer session.Close()
-
-	// write file to fs from stdin
-	session.Stdin = in
-	out, err = session.CombinedOutput(fmt.Sprintf("sudo install -m 0755 /dev/stdin %s", to))
-	if err != nil {
-		return fmt.Errorf("failed executing install: %q: %v", out, err)
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed writing %s: %v", to, err)
 	}
-
-	return nil
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return c.Chmod(to, 0755)
 }
 
 // NewMachines spawns n instances in cluster c, with
@@ -0,0 +1,161 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/network/sftp"
+)
+
+// SFTPServer is run with sudo for each SFTP session, so transfers can
+// reach any file on the machine and create files owned by root.
+const SFTPServer = "/usr/lib64/misc/sftp-server"
+
+// sftpSession ends an SFTP session's sftp-server along with its SSH
+// session and client.
+type sftpSession struct {
+	io.WriteCloser // stdin of sftp-server
+	s              *ssh.Session
+	c              *ssh.Client
+	stderr         *bytes.Buffer
+}
+
+func (s *sftpSession) Close() error {
+	// sftp-server exits when its input ends
+	s.WriteCloser.Close()
+	err := s.s.Wait()
+	if err != nil {
+		err = fmt.Errorf("%s: %v: %s", SFTPServer, err, s.stderr)
+	}
+	s.s.Close()
+	if cerr := s.c.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewSFTPClient starts an SFTP session on m running as root. Relative
+// paths are relative to the home directory of the core user. The caller
+// should close the client when finished.
+func NewSFTPClient(m Machine) (*sftp.Client, error) {
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+	return newSFTPClient(client)
+}
+
+// newSFTPClient starts an SFTP session over client, which the returned
+// sftp.Client takes ownership of.
+func newSFTPClient(client *ssh.Client) (*sftp.Client, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		client.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		client.Close()
+		return nil, err
+	}
+	stderr := bytes.NewBuffer(nil)
+	session.Stderr = stderr
+
+	if err := session.Start("sudo " + SFTPServer); err != nil {
+		session.Close()
+		client.Close()
+		return nil, err
+	}
+
+	c, err := sftp.NewClient(stdout, &sftpSession{stdin, session, client, stderr})
+	if err != nil {
+		session.Close()
+		client.Close()
+		return nil, fmt.Errorf("failed starting SFTP session: %v: %s", err, stderr)
+	}
+	return c, nil
+}
+
+// Upload copies the local file or directory tree local to remote on m.
+// Modes and modification times are preserved; files are owned by root
+// unless opts.PreserveOwner is set.
+func Upload(m Machine, local, remote string, opts sftp.TransferOptions) error {
+	c, err := NewSFTPClient(m)
+	if err != nil {
+		return err
+	}
+	err = c.Upload(local, remote, opts)
+	if cerr := c.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("uploading %s to %s:%s: %v", local, m.ID(), remote, err)
+	}
+	return nil
+}
+
+// Download copies the file or directory tree remote on m to local.
+// Modes and modification times are preserved; files are owned by the
+// current user unless opts.PreserveOwner is set. If ctx is done first,
+// the SSH connection is cut off and ctx.Err() is returned once nothing
+// more will be written to local.
+func Download(ctx context.Context, m Machine, remote, local string, opts sftp.TransferOptions) error {
+	client, err := m.SSHClient()
+	if err != nil {
+		return fmt.Errorf("failed creating SSH client: %v", err)
+	}
+	done := make(chan struct{})
+	canceled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// fails the transfer however unresponsive the machine is
+			client.Close()
+			canceled <- true
+		case <-done:
+			canceled <- false
+		}
+	}()
+
+	c, err := newSFTPClient(client)
+	if err == nil {
+		err = c.Download(remote, local, opts)
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	close(done)
+	if <-canceled {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s:%s to %s: %v", m.ID(), remote, local, err)
+	}
+	return nil
+}
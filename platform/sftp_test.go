@@ -0,0 +1,174 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/network/sftp"
+)
+
+// sftpMachine is a machine whose SSH server serves the local file system
+// with the local sftp-server.
+type sftpMachine struct {
+	Machine
+	t      *testing.T
+	server string
+}
+
+// newSFTPMachine skips the test if OpenSSH's sftp-server isn't installed.
+func newSFTPMachine(t *testing.T) *sftpMachine {
+	for _, server := range []string{SFTPServer, "/usr/lib/openssh/sftp-server", "/usr/libexec/openssh/sftp-server"} {
+		if _, err := os.Stat(server); err == nil {
+			return &sftpMachine{t: t, server: server}
+		}
+	}
+	t.Skip("sftp-server not installed")
+	return nil
+}
+
+func (m *sftpMachine) ID() string {
+	return "sftp"
+}
+
+func (m *sftpMachine) SSHClient() (*ssh.Client, error) {
+	return mockssh.NewMockClient(func(s *mockssh.Session) {
+		if s.Exec != "sudo "+SFTPServer {
+			m.t.Errorf("unexpected command %q", s.Exec)
+			s.Exit(127)
+			return
+		}
+		cmd := exec.Command(m.server)
+		cmd.Stdin = s.Stdin
+		cmd.Stdout = s.Stdout
+		cmd.Stderr = s.Stderr
+		if err := cmd.Run(); err != nil {
+			m.t.Errorf("%s failed: %v", m.server, err)
+			s.Exit(1)
+			return
+		}
+		s.Exit(0)
+	}), nil
+}
+
+// hungMachine is a machine whose sftp-server never answers.
+type hungMachine struct {
+	Machine
+}
+
+func (m hungMachine) ID() string {
+	return "hung"
+}
+
+func (m hungMachine) SSHClient() (*ssh.Client, error) {
+	return mockssh.NewMockClient(func(s *mockssh.Session) {
+		io.Copy(ioutil.Discard, s.Stdin)
+		s.Close()
+	}), nil
+}
+
+func TestDownloadCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Download(ctx, hungMachine{}, "/var/log", filepath.Join(dir, "var-log"), sftp.TransferOptions{})
+	}()
+	select {
+	case err := <-errc:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Download returned %v, expected %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Download ignored its context")
+	}
+}
+
+func TestSFTPTransfers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := newSFTPMachine(t)
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "log", "messages"), []byte("hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := filepath.Join(dir, "remote")
+	if err := Upload(m, src, remote, sftp.TransferOptions{Verify: true}); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	local := filepath.Join(dir, "local")
+	if err := Download(context.Background(), m, remote, local, sftp.TransferOptions{Verify: true}); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(local, "log", "messages"))
+	if err != nil {
+		t.Fatalf("downloaded file missing: %v", err)
+	}
+	if fi.Mode() != 0600 {
+		t.Errorf("downloaded file has mode %v, expected 0600", fi.Mode())
+	}
+
+	// InstallFile and ReadFile keep their old behavior
+	bin := filepath.Join(dir, "bin", "kolet")
+	in, err := os.Open(filepath.Join(src, "log", "messages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err := InstallFile(in, m, bin); err != nil {
+		t.Fatalf("InstallFile failed: %v", err)
+	}
+	if fi, err := os.Stat(bin); err != nil || fi.Mode() != 0755 {
+		t.Errorf("installed file: %v, %v", fi, err)
+	}
+	r, err := ReadFile(m, bin)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("reading file failed: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("closing file failed: %v", err)
+	}
+	if string(data) != "hello\n" {
+		t.Errorf("read %q, expected %q", data, "hello\n")
+	}
+}
@@ -18,29 +18,17 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/coreos/go-omaha/omaha"
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/coreos/mantle/sdk"
-)
-
-const (
-	privateKey = "/usr/share/update_engine/update-payload-key.key.pem"
-	publicKey  = "/usr/share/update_engine/update-payload-key.pub.pem"
+	"github.com/coreos/mantle/update/generator"
 )
 
 var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "sdk/omaha")
 
-func run(name string, arg ...string) error {
-	cmd := exec.Command(name, arg...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 func xmlMarshalFile(path string, v interface{}) error {
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
@@ -82,6 +70,35 @@ func checkUpdate(dir, update_xml string) error {
 	return u.Packages[0].Verify(pkgdir)
 }
 
+// generateFullPayload writes a full update payload for the given /usr
+// partition image and kernel, signed with the developer key.
+func generateFullPayload(out, usr, kernel string) error {
+	var g generator.Generator
+	defer g.Destroy()
+
+	partition, err := generator.FullUpdate(usr)
+	if err != nil {
+		return err
+	}
+	if err := g.Partition(partition); err != nil {
+		partition.Close()
+		return err
+	}
+
+	kern, err := generator.KernelUpdate(kernel)
+	if err != nil {
+		return err
+	}
+	if err := g.Procedure(kern); err != nil {
+		kern.Close()
+		return err
+	}
+
+	return g.Write(out)
+}
+
+// GenerateFullUpdate creates a full update payload and omaha update.xml
+// for the image in dir, unless an up to date one already exists.
 func GenerateFullUpdate(dir string) error {
 	var (
 		update_prefix = filepath.Join(dir, "coreos_production_update")
@@ -97,11 +114,7 @@ func GenerateFullUpdate(dir string) error {
 	}
 
 	plog.Noticef("Generating update payload: %s", update_gz)
-	if err := run("delta_generator",
-		"-new_image", update_bin,
-		"-new_kernel", vmlinuz,
-		"-out_file", update_gz,
-		"-private_key", privateKey); err != nil {
+	if err := generateFullPayload(update_gz, update_bin, vmlinuz); err != nil {
 		return err
 	}
 
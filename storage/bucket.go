@@ -298,6 +298,20 @@ func (b *Bucket) Upload(ctx context.Context, obj *storage.Object, media io.Reade
 	return nil
 }
 
+// Download opens the content of the named object for reading. The caller
+// is responsible for closing the returned ReadCloser.
+func (b *Bucket) Download(ctx context.Context, objName string) (io.ReadCloser, error) {
+	req := b.service.Objects.Get(b.name, objName)
+	req.Context(ctx)
+
+	resp, err := req.Download()
+	if err != nil {
+		return nil, b.apiErr("storage.objects.get", objName, err)
+	}
+
+	return resp.Body, nil
+}
+
 func (b *Bucket) Copy(ctx context.Context, src *storage.Object, dstName string) error {
 	if src.Bucket == "" {
 		panic(fmt.Errorf("src.Bucket is blank: %#v", src))
@@ -34,6 +34,22 @@ var (
 // FullUpdate generates an update Procedure for the given file, embedding its
 // entire contents in the payload so it does not depend any previous state.
 func FullUpdate(path string) (*Procedure, error) {
+	return fullUpdate(path, false)
+}
+
+// KernelUpdate generates a full update Procedure for the given kernel. Unlike
+// FullUpdate the file does not need to be a multiple of BlockSize; the final
+// operation covers the trailing partial block.
+func KernelUpdate(path string) (*Procedure, error) {
+	proc, err := fullUpdate(path, true)
+	if err != nil {
+		return nil, err
+	}
+	proc.Type = metadata.InstallProcedure_KERNEL.Enum()
+	return proc, nil
+}
+
+func fullUpdate(path string, unaligned bool) (*Procedure, error) {
 	source, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -50,7 +66,7 @@ func FullUpdate(path string) (*Procedure, error) {
 		return nil, err
 	}
 
-	scanner := fullScanner{payload: payload, source: source}
+	scanner := fullScanner{payload: payload, source: source, unaligned: unaligned}
 	for err == nil {
 		err = scanner.Scan()
 	}
@@ -79,6 +95,7 @@ func FullUpdate(path string) (*Procedure, error) {
 type fullScanner struct {
 	payload    io.Writer
 	source     io.Reader
+	unaligned  bool // allow a partial final block
 	offset     uint64
 	operations []*metadata.InstallOperation
 }
@@ -97,12 +114,12 @@ func (f *fullScanner) Scan() error {
 	if err != nil {
 		return err
 	}
-	if len(chunk)%BlockSize != 0 {
+	if len(chunk)%BlockSize != 0 && !f.unaligned {
 		return errShortRead
 	}
 
 	startBlock := uint64(f.offset) / BlockSize
-	numBlocks := uint64(len(chunk)) / BlockSize
+	numBlocks := (uint64(len(chunk)) + BlockSize - 1) / BlockSize
 	f.offset += uint64(len(chunk))
 
 	// Try bzip2 compressing the data, hopefully it will shrink!
@@ -154,6 +154,35 @@ func TestFullUpdateScanUnaligned(t *testing.T) {
 	}
 }
 
+func TestFullUpdateScanUnalignedKernel(t *testing.T) {
+	var payload bytes.Buffer
+	scanner := fullScanner{
+		payload:   &payload,
+		source:    bytes.NewReader(testUnaligned),
+		unaligned: true,
+	}
+
+	if err := scanner.Scan(); err != nil {
+		if exec.IsCmdNotFound(err) {
+			t.Skip(err)
+		}
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := scanner.Scan(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	if len(scanner.operations) != 1 {
+		t.Fatalf("unexpected operations: %v", scanner.operations)
+	}
+
+	ext := scanner.operations[0].DstExtents[0]
+	if ext.GetStartBlock() != 0 || ext.GetNumBlocks() != 2 {
+		t.Errorf("unexpected extent: %v", ext)
+	}
+}
+
 func checkFullProc(t *testing.T, source, sourceHash []byte) *Procedure {
 	f, err := ioutil.TempFile("", "")
 	if err != nil {
@@ -42,6 +42,10 @@ var (
 	// ErrProcedureExists indicates that a given procedure type has
 	// already been added to the Generator.
 	ErrProcedureExists = errors.New("generator: procedure already exists")
+
+	// ErrMissingPartition indicates that a procedure was added to the
+	// Generator before the /usr partition procedure.
+	ErrMissingPartition = errors.New("generator: partition procedure must be added first")
 )
 
 // Generator assembles an update payload from a number of sources. Each of
@@ -73,6 +77,24 @@ func (g *Generator) Partition(proc *Procedure) error {
 	return nil
 }
 
+// Procedure adds an additional Procedure, such as a kernel update, to the
+// payload. Only one Procedure of each type may be added, after Partition.
+func (g *Generator) Procedure(proc *Procedure) error {
+	if len(g.payloads) == 0 {
+		return ErrMissingPartition
+	}
+	for _, existing := range g.manifest.Procedures {
+		if existing.GetType() == proc.GetType() {
+			return ErrProcedureExists
+		}
+	}
+
+	g.AddCloser(proc)
+	g.manifest.Procedures = append(g.manifest.Procedures, &proc.InstallProcedure)
+	g.payloads = append(g.payloads, proc)
+	return nil
+}
+
 // Write finalizes the payload, writing it out to the given file path.
 func (g *Generator) Write(path string) (err error) {
 	if err = g.updateOffsets(); err != nil {
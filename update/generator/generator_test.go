@@ -65,6 +65,21 @@ func TestGenerateWithoutPartition(t *testing.T) {
 	}
 }
 
+func TestGenerateProcedureWithoutPartition(t *testing.T) {
+	g := testGenerator{t: t}
+	defer g.Destroy()
+
+	proc := Procedure{
+		InstallProcedure: metadata.InstallProcedure{
+			Type: metadata.InstallProcedure_KERNEL.Enum(),
+		},
+		ReadCloser: ioutil.NopCloser(&bytes.Buffer{}),
+	}
+	if err := g.Procedure(&proc); err != ErrMissingPartition {
+		t.Errorf("expected ErrMissingPartition, got %v", err)
+	}
+}
+
 func TestGenerateOneBlockPartition(t *testing.T) {
 	g := testGenerator{t: t}
 	defer g.Destroy()